@@ -0,0 +1,372 @@
+/*
+ * Copyright (c) 2021 Twintag
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	"github.com/esoptra/v8go-polyfills/domexception"
+)
+
+// aesUsages returns the key usages valid for an AES algorithm
+func aesUsages(name string) []string {
+	if name == string(AES_KW) {
+		return []string{"wrapKey", "unwrapKey"}
+	}
+	return []string{"encrypt", "decrypt", "wrapKey", "unwrapKey"}
+}
+
+// aesJWKAlg returns the jwk "alg" of an AES key, like A256GCM
+func aesJWKAlg(name string, length int) string {
+	switch name {
+	case string(AES_GCM):
+		return fmt.Sprintf("A%dGCM", length)
+	case string(AES_CBC):
+		return fmt.Sprintf("A%dCBC", length)
+	case string(AES_CTR):
+		return fmt.Sprintf("A%dCTR", length)
+	default:
+		return fmt.Sprintf("A%dKW", length)
+	}
+}
+
+func (c *Crypto) generateAESKey(algorithm *AESAlgo, extractable bool, usages []string) (*CryptoKey, error) {
+	if err := checkKeyUsages(algorithm.Name, usages, aesUsages(algorithm.Name)...); err != nil {
+		return nil, err
+	}
+
+	switch algorithm.Length {
+	case 128, 192, 256:
+	default:
+		return nil, newCryptoError(domexception.OperationError, "AES key length must be 128, 192 or 256 bits, got %d", algorithm.Length)
+	}
+
+	key := make([]byte, algorithm.Length/8)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	return newCryptoKey(key, &CryptoKey{
+		Type:        "secret",
+		Extractable: extractable,
+		Algorithm:   algorithm,
+		Usages:      usages,
+	}), nil
+}
+
+func importAESKey(format string, keyData []byte, algorithm *AESAlgo, extractable bool, usages []string) ([]byte, error) {
+	if err := checkKeyUsages(algorithm.Name, usages, aesUsages(algorithm.Name)...); err != nil {
+		return nil, err
+	}
+
+	var key []byte
+	switch format {
+	case "raw":
+		key = keyData
+	case "jwk":
+		jwk := &jsonWebKey{}
+		if err := json.Unmarshal(keyData, jwk); err != nil {
+			return nil, newCryptoError(domexception.DataError, "invalid jwk: %v", err)
+		}
+		if jwk.Kty != "oct" {
+			return nil, newCryptoError(domexception.DataError, "expected jwk kty \"oct\", got %q", jwk.Kty)
+		}
+		k, err := base64.RawURLEncoding.DecodeString(jwk.K)
+		if err != nil {
+			return nil, newCryptoError(domexception.DataError, "invalid jwk k: %v", err)
+		}
+		if jwk.Alg != "" && jwk.Alg != aesJWKAlg(algorithm.Name, len(k)*8) {
+			return nil, newCryptoError(domexception.DataError, "jwk alg %q does not match %s", jwk.Alg, algorithm.Name)
+		}
+		if err := jwk.checkImport("enc", extractable, usages); err != nil {
+			return nil, err
+		}
+		key = k
+	default:
+		return nil, newCryptoError(domexception.NotSupportedError, "format %q not supported for %s keys", format, algorithm.Name)
+	}
+
+	switch len(key) {
+	case 16, 24, 32:
+	default:
+		return nil, newCryptoError(domexception.DataError, "AES key data must be 128, 192 or 256 bits, got %d", len(key)*8)
+	}
+
+	algorithm.Length = len(key) * 8
+	return key, nil
+}
+
+func exportAESKey(format string, key *cryptoKeyArg, raw interface{}) ([]byte, error) {
+	k, ok := raw.([]byte)
+	if !ok {
+		return nil, newCryptoError(domexception.InvalidAccessError, "expected an AES key, got %T", raw)
+	}
+
+	switch format {
+	case "raw":
+		return k, nil
+	case "jwk":
+		return json.Marshal(&jsonWebKey{
+			Kty:    "oct",
+			K:      base64.RawURLEncoding.EncodeToString(k),
+			Alg:    aesJWKAlg(key.Algorithm.Name, len(k)*8),
+			KeyOps: key.Usages,
+			Ext:    &key.Extractable,
+		})
+	default:
+		return nil, newCryptoError(domexception.NotSupportedError, "format %q not supported for %s keys", format, key.Algorithm.Name)
+	}
+}
+
+func aesBlock(raw interface{}) (cipher.Block, error) {
+	key, ok := raw.([]byte)
+	if !ok {
+		return nil, newCryptoError(domexception.InvalidAccessError, "expected an AES key, got %T", raw)
+	}
+	return aes.NewCipher(key)
+}
+
+// newGCM creates the AEAD of the AesGcmParams, Go can't combine a custom
+// iv length with a custom tag length
+func newGCM(block cipher.Block, params *cipherParams) (cipher.AEAD, error) {
+	switch params.TagLength {
+	case 96, 104, 112, 120, 128:
+	case 32, 64:
+		return nil, newCryptoError(domexception.NotSupportedError, "AES-GCM tagLength %d is not supported", params.TagLength)
+	default:
+		return nil, newCryptoError(domexception.OperationError, "invalid AES-GCM tagLength %d", params.TagLength)
+	}
+
+	switch {
+	case len(params.Iv) == 0:
+		return nil, newCryptoError(domexception.OperationError, "AES-GCM iv can't be empty")
+	case len(params.Iv) == 12:
+		return cipher.NewGCMWithTagSize(block, params.TagLength/8)
+	case params.TagLength != 128:
+		return nil, newCryptoError(domexception.NotSupportedError, "AES-GCM tagLength %d needs a 96 bits iv", params.TagLength)
+	default:
+		return cipher.NewGCMWithNonceSize(block, len(params.Iv))
+	}
+}
+
+func checkCounter(params *cipherParams, size int) error {
+	if len(params.Counter) != aes.BlockSize {
+		return newCryptoError(domexception.OperationError, "AES-CTR counter must be 16 bytes, got %d", len(params.Counter))
+	}
+	if params.Length <= 0 || params.Length > 128 {
+		return newCryptoError(domexception.OperationError, "AES-CTR length must be between 1 and 128, got %d", params.Length)
+	}
+
+	blocks := uint64(size+aes.BlockSize-1) / aes.BlockSize
+	if params.Length < 64 && blocks > uint64(1)<<uint(params.Length) {
+		return newCryptoError(domexception.OperationError, "AES-CTR counter of %d bits would wrap around", params.Length)
+	}
+	return nil
+}
+
+// incrementCounter adds one to the rightmost length bits of ctr, the other bits are the nonce
+func incrementCounter(ctr []byte, length int) {
+	for i := len(ctr) - 1; i >= 0 && length > 0; i-- {
+		bits := 8
+		if length < 8 {
+			bits = length
+		}
+		mask := byte(1<<uint(bits) - 1)
+		v := (ctr[i] + 1) & mask
+		ctr[i] = ctr[i]&^mask | v
+		if v != 0 {
+			return
+		}
+		length -= bits
+	}
+}
+
+// aesCTR encrypts or decrypts data in counter mode, wrapping the counter
+// within its length bits as WebCrypto requires
+func aesCTR(block cipher.Block, params *cipherParams, data []byte) ([]byte, error) {
+	if err := checkCounter(params, len(data)); err != nil {
+		return nil, err
+	}
+
+	ctr := make([]byte, aes.BlockSize)
+	copy(ctr, params.Counter)
+	stream := make([]byte, aes.BlockSize)
+	out := make([]byte, len(data))
+
+	for i := 0; i < len(data); i += aes.BlockSize {
+		block.Encrypt(stream, ctr)
+		for j := i; j < len(data) && j < i+aes.BlockSize; j++ {
+			out[j] = data[j] ^ stream[j-i]
+		}
+		incrementCounter(ctr, params.Length)
+	}
+
+	return out, nil
+}
+
+func aesEncrypt(params *cipherParams, raw interface{}, data []byte) ([]byte, error) {
+	block, err := aesBlock(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	switch params.Name {
+	case string(AES_GCM):
+		gcm, err := newGCM(block, params)
+		if err != nil {
+			return nil, err
+		}
+		return gcm.Seal(nil, params.Iv, data, params.AdditionalData), nil
+	case string(AES_CBC):
+		if len(params.Iv) != aes.BlockSize {
+			return nil, newCryptoError(domexception.OperationError, "AES-CBC iv must be 16 bytes, got %d", len(params.Iv))
+		}
+		// PKCS#7 padding
+		pad := aes.BlockSize - len(data)%aes.BlockSize
+		out := make([]byte, len(data)+pad)
+		copy(out, data)
+		for i := len(data); i < len(out); i++ {
+			out[i] = byte(pad)
+		}
+		cipher.NewCBCEncrypter(block, params.Iv).CryptBlocks(out, out)
+		return out, nil
+	default:
+		return aesCTR(block, params, data)
+	}
+}
+
+func aesDecrypt(params *cipherParams, raw interface{}, data []byte) ([]byte, error) {
+	block, err := aesBlock(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	switch params.Name {
+	case string(AES_GCM):
+		gcm, err := newGCM(block, params)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) < gcm.Overhead() {
+			return nil, newCryptoError(domexception.OperationError, "AES-GCM data is shorter than the tag")
+		}
+		return gcm.Open(nil, params.Iv, data, params.AdditionalData)
+	case string(AES_CBC):
+		if len(params.Iv) != aes.BlockSize {
+			return nil, newCryptoError(domexception.OperationError, "AES-CBC iv must be 16 bytes, got %d", len(params.Iv))
+		}
+		if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+			return nil, newCryptoError(domexception.OperationError, "AES-CBC data must be a multiple of 16 bytes")
+		}
+		out := make([]byte, len(data))
+		cipher.NewCBCDecrypter(block, params.Iv).CryptBlocks(out, data)
+
+		pad := int(out[len(out)-1])
+		if pad == 0 || pad > aes.BlockSize {
+			return nil, newCryptoError(domexception.OperationError, "AES-CBC invalid padding")
+		}
+		for _, b := range out[len(out)-pad:] {
+			if int(b) != pad {
+				return nil, newCryptoError(domexception.OperationError, "AES-CBC invalid padding")
+			}
+		}
+		return out[:len(out)-pad], nil
+	default:
+		return aesCTR(block, params, data)
+	}
+}
+
+// kwIV is the default initial value of RFC 3394
+var kwIV = []byte{0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6}
+
+// aesKWWrap wraps data with the AES key wrap algorithm of RFC 3394
+func aesKWWrap(raw interface{}, data []byte) ([]byte, error) {
+	block, err := aesBlock(raw)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 16 || len(data)%8 != 0 {
+		return nil, newCryptoError(domexception.OperationError, "AES-KW data must be a multiple of 8 bytes and at least 16 bytes, got %d", len(data))
+	}
+
+	n := len(data) / 8
+	a := make([]byte, 8)
+	copy(a, kwIV)
+	r := make([]byte, len(data))
+	copy(r, data)
+	b := make([]byte, aes.BlockSize)
+
+	for j := 0; j < 6; j++ {
+		for i := 0; i < n; i++ {
+			copy(b, a)
+			copy(b[8:], r[i*8:(i+1)*8])
+			block.Encrypt(b, b)
+			t := uint64(n*j + i + 1)
+			binary.BigEndian.PutUint64(a, binary.BigEndian.Uint64(b[:8])^t)
+			copy(r[i*8:], b[8:])
+		}
+	}
+
+	return append(a, r...), nil
+}
+
+// aesKWUnwrap reverses aesKWWrap, failing when the integrity check doesn't match
+func aesKWUnwrap(raw interface{}, data []byte) ([]byte, error) {
+	block, err := aesBlock(raw)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 24 || len(data)%8 != 0 {
+		return nil, newCryptoError(domexception.OperationError, "AES-KW wrapped data must be a multiple of 8 bytes and at least 24 bytes, got %d", len(data))
+	}
+
+	n := len(data)/8 - 1
+	a := make([]byte, 8)
+	copy(a, data[:8])
+	r := make([]byte, len(data)-8)
+	copy(r, data[8:])
+	b := make([]byte, aes.BlockSize)
+
+	for j := 5; j >= 0; j-- {
+		for i := n - 1; i >= 0; i-- {
+			t := uint64(n*j + i + 1)
+			binary.BigEndian.PutUint64(b, binary.BigEndian.Uint64(a)^t)
+			copy(b[8:], r[i*8:(i+1)*8])
+			block.Decrypt(b, b)
+			copy(a, b[:8])
+			copy(r[i*8:], b[8:])
+		}
+	}
+
+	if subtle.ConstantTimeCompare(a, kwIV) != 1 {
+		return nil, newCryptoError(domexception.OperationError, "AES-KW integrity check failed")
+	}
+	return r, nil
+}
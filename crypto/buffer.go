@@ -0,0 +1,150 @@
+/*
+ * Copyright (c) 2021 Twintag
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package crypto
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/esoptra/v8go"
+)
+
+type bufferView struct {
+	Buffer *v8go.ArrayBuffer
+	Offset int64
+	Length int64
+}
+
+// getBufferView returns the buffer, byteOffset and byteLength of a typed array or DataView
+func getBufferView(v *v8go.Value) (*bufferView, error) {
+	if !v.IsArrayBufferView() {
+		return nil, errors.New("expected a TypedArray or a DataView")
+	}
+
+	obj, err := v.AsObject()
+	if err != nil {
+		return nil, err
+	}
+
+	buffer, err := obj.Get("buffer")
+	if err != nil {
+		return nil, err
+	}
+	offset, err := obj.Get("byteOffset")
+	if err != nil {
+		return nil, err
+	}
+	length, err := obj.Get("byteLength")
+	if err != nil {
+		return nil, err
+	}
+
+	return &bufferView{
+		Buffer: buffer.ArrayBuffer(),
+		Offset: offset.Integer(),
+		Length: length.Integer(),
+	}, nil
+}
+
+// getBufferSource copies the bytes of an ArrayBuffer, a typed array or a DataView
+func getBufferSource(v *v8go.Value) ([]byte, error) {
+	if v == nil {
+		return nil, errors.New("expected an ArrayBuffer, a TypedArray or a DataView")
+	}
+
+	if v.IsArrayBuffer() {
+		return v.ArrayBuffer().GetBytes(), nil
+	}
+
+	if !v.IsArrayBufferView() {
+		return nil, errors.New("expected an ArrayBuffer, a TypedArray or a DataView")
+	}
+
+	view, err := getBufferView(v)
+	if err != nil {
+		return nil, err
+	}
+
+	data := view.Buffer.GetBytes()
+	if view.Offset+view.Length > int64(len(data)) {
+		return nil, fmt.Errorf("view of %d bytes at offset %d exceeds its buffer", view.Length, view.Offset)
+	}
+
+	return data[view.Offset : view.Offset+view.Length], nil
+}
+
+// newArrayBuffer creates an ArrayBuffer holding b in the realm of ctx.
+// v8go allocates new buffers in the isolate's internal context, so the bytes
+// are copied through the script's Uint8Array for `instanceof ArrayBuffer` to hold.
+func newArrayBuffer(ctx *v8go.Context, b []byte) (*v8go.Value, error) {
+	ab := v8go.NewArrayBuffer(ctx, int64(len(b)))
+	if len(b) > 0 {
+		ab.PutBytes(b)
+	}
+
+	ctor, err := ctx.Global().Get("Uint8Array")
+	if err != nil {
+		return nil, err
+	}
+	fn, err := ctor.AsFunction()
+	if err != nil {
+		return nil, err
+	}
+
+	view, err := fn.NewInstance(ab.Value)
+	if err != nil {
+		return nil, err
+	}
+	copied, err := view.MethodCall("slice")
+	if err != nil {
+		return nil, err
+	}
+	copiedObj, err := copied.AsObject()
+	if err != nil {
+		return nil, err
+	}
+
+	return copiedObj.Get("buffer")
+}
+
+// getBufferSourceMember copies the BufferSource member name of a dictionary,
+// ok is false when the member is missing or undefined
+func getBufferSourceMember(obj *v8go.Object, name string) (data []byte, ok bool, err error) {
+	if !obj.Has(name) {
+		return nil, false, nil
+	}
+
+	v, err := obj.Get(name)
+	if err != nil {
+		return nil, false, err
+	}
+	if v.IsUndefined() {
+		return nil, false, nil
+	}
+
+	data, err = getBufferSource(v)
+	if err != nil {
+		return nil, false, fmt.Errorf("%s: %w", name, err)
+	}
+	return data, true, nil
+}
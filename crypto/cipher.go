@@ -0,0 +1,213 @@
+/*
+ * Copyright (c) 2021 Twintag
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package crypto
+
+import (
+	"fmt"
+
+	"github.com/esoptra/v8go"
+	"github.com/esoptra/v8go-polyfills/domexception"
+	"github.com/esoptra/v8go-polyfills/eventloop"
+)
+
+// cipherParams holds the algorithm parameters of encrypt and decrypt
+type cipherParams struct {
+	Name           string
+	Label          []byte // RSA-OAEP
+	Iv             []byte // AES-GCM and AES-CBC
+	AdditionalData []byte // AES-GCM
+	TagLength      int    // AES-GCM, 128 when missing
+	Counter        []byte // AES-CTR
+	Length         int    // AES-CTR
+}
+
+// getCipherParams normalizes the algorithm of encrypt, decrypt, wrapKey or
+// unwrapKey, ops lists the operations the algorithm may support
+func getCipherParams(v *v8go.Value, ops ...string) (*cipherParams, error) {
+	canonical, err := normalizeAlgorithm(v, ops...)
+	if err != nil {
+		return nil, err
+	}
+	params := &cipherParams{Name: canonical}
+	var ok bool
+
+	if !v.IsObject() {
+		return params, nil
+	}
+	obj, err := v.AsObject()
+	if err != nil {
+		return nil, newCryptoError(typeError, "%v", err)
+	}
+
+	if params.Label, _, err = getBufferSourceMember(obj, "label"); err != nil {
+		return nil, newCryptoError(typeError, "%v", err)
+	}
+	if params.AdditionalData, _, err = getBufferSourceMember(obj, "additionalData"); err != nil {
+		return nil, newCryptoError(typeError, "%v", err)
+	}
+
+	switch params.Name {
+	case string(AES_GCM), string(AES_CBC):
+		if params.Iv, ok, err = getBufferSourceMember(obj, "iv"); err != nil {
+			return nil, newCryptoError(typeError, "%v", err)
+		} else if !ok {
+			return nil, newCryptoError(typeError, "%s params: iv is required", params.Name)
+		}
+		if params.TagLength, ok, err = getNumberMember(obj, "tagLength"); err != nil {
+			return nil, newCryptoError(typeError, "%v", err)
+		} else if !ok {
+			params.TagLength = 128
+		}
+	case string(AES_CTR):
+		if params.Counter, ok, err = getBufferSourceMember(obj, "counter"); err != nil {
+			return nil, newCryptoError(typeError, "%v", err)
+		} else if !ok {
+			return nil, newCryptoError(typeError, "AES-CTR params: counter is required")
+		}
+		if params.Length, ok, err = getNumberMember(obj, "length"); err != nil {
+			return nil, newCryptoError(typeError, "%v", err)
+		} else if !ok {
+			return nil, newCryptoError(typeError, "AES-CTR params: length is required")
+		}
+	}
+
+	return params, nil
+}
+
+// getNumberMember reads the integer member name of a dictionary,
+// ok is false when the member is missing or undefined
+func getNumberMember(obj *v8go.Object, name string) (n int, ok bool, err error) {
+	if !obj.Has(name) {
+		return 0, false, nil
+	}
+
+	v, err := obj.Get(name)
+	if err != nil {
+		return 0, false, err
+	}
+	if v.IsUndefined() {
+		return 0, false, nil
+	}
+	if !v.IsNumber() {
+		return 0, false, fmt.Errorf("%s: expected a number", name)
+	}
+
+	return int(v.Integer()), true, nil
+}
+
+func (c *Crypto) encrypt(params *cipherParams, key *cryptoKeyArg, raw interface{}, data []byte) ([]byte, error) {
+	switch params.Name {
+	case string(RSA_OAEP), string(RSA_OAEP_256):
+		return rsaEncrypt(params, key, raw, data)
+	case string(AES_GCM), string(AES_CBC), string(AES_CTR):
+		return aesEncrypt(params, raw, data)
+	default:
+		return nil, newCryptoError(domexception.NotSupportedError, "%s can't be used to encrypt", params.Name)
+	}
+}
+
+func (c *Crypto) decrypt(params *cipherParams, key *cryptoKeyArg, raw interface{}, data []byte) ([]byte, error) {
+	switch params.Name {
+	case string(RSA_OAEP), string(RSA_OAEP_256):
+		return rsaDecrypt(params, key, raw, data)
+	case string(AES_GCM), string(AES_CBC), string(AES_CTR):
+		return aesDecrypt(params, raw, data)
+	default:
+		return nil, newCryptoError(domexception.NotSupportedError, "%s can't be used to decrypt", params.Name)
+	}
+}
+
+type cipherFunc func(params *cipherParams, key *cryptoKeyArg, raw interface{}, data []byte) ([]byte, error)
+
+// cipherFunctionCallback implements encrypt and decrypt, which only differ by their usage
+func (c *Crypto) cipherFunctionCallback(method string, fn cipherFunc) v8go.FunctionCallback {
+	return func(info *v8go.FunctionCallbackInfo) *v8go.Value {
+		ctx := info.Context()
+		iso := ctx.Isolate()
+		resolver, err := v8go.NewPromiseResolver(ctx)
+		if err != nil {
+			strErr, _ := v8go.NewValue(iso, fmt.Sprintf("error creating newPromiseResolver with ctx: %#v", err))
+			return iso.ThrowException(strErr)
+		}
+
+		args := info.Args()
+		if len(args) < 3 {
+			resolver.Reject(newTypeError(ctx, "Failed to execute '%s': 3 arguments required, but only %d present", method, len(args)))
+			return resolver.GetPromise().Value
+		}
+
+		params, err := getCipherParams(args[0], method)
+		if err != nil {
+			resolver.Reject(rejectValue(ctx, method, err))
+			return resolver.GetPromise().Value
+		}
+
+		key, raw, err := c.getCryptoKey(ctx, args[1])
+		if err == nil {
+			err = key.checkUsage(params.Name, method)
+		}
+		if err != nil {
+			resolver.Reject(rejectValue(ctx, method, err))
+			return resolver.GetPromise().Value
+		}
+
+		data, err := getBufferSource(args[2])
+		if err != nil {
+			resolver.Reject(newTypeError(ctx, "Failed to execute '%s': %v", method, err))
+			return resolver.GetPromise().Value
+		}
+
+		eventloop.For(ctx).Go(func() func() {
+			result, err := fn(params, key, raw, data)
+			return func() {
+				if err != nil {
+					resolver.Reject(rejectValue(ctx, method, err))
+					return
+				}
+
+				v, err := newArrayBuffer(ctx, result)
+				if err != nil {
+					resolver.Reject(rejectValue(ctx, method, err))
+					return
+				}
+				resolver.Resolve(v)
+			}
+		})
+
+		return resolver.GetPromise().Value
+	}
+}
+
+// cryptoEncryptFunctionCallback implements https://developer.mozilla.org/en-US/docs/Web/API/SubtleCrypto/encrypt
+// const result = crypto.subtle.encrypt(algorithm, key, data);
+// result is a Promise that fulfills with an ArrayBuffer containing the ciphertext.
+func (c *Crypto) cryptoEncryptFunctionCallback() v8go.FunctionCallback {
+	return c.cipherFunctionCallback("encrypt", c.encrypt)
+}
+
+// cryptoDecryptFunctionCallback implements https://developer.mozilla.org/en-US/docs/Web/API/SubtleCrypto/decrypt
+// const result = crypto.subtle.decrypt(algorithm, key, data);
+// result is a Promise that fulfills with an ArrayBuffer containing the plaintext.
+func (c *Crypto) cryptoDecryptFunctionCallback() v8go.FunctionCallback {
+	return c.cipherFunctionCallback("decrypt", c.decrypt)
+}
@@ -23,19 +23,37 @@
 package crypto
 
 import (
-	"crypto"
-	"crypto/rand"
-	"crypto/rsa"
+	"bytes"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"strings"
 	"sync"
 
 	"github.com/esoptra/v8go"
-	"github.com/esoptra/v8go-polyfills/uuid"
+	"github.com/esoptra/v8go-polyfills/domexception"
+	"github.com/esoptra/v8go-polyfills/eventloop"
 )
 
+// DefaultMaxPBKDF2Iterations is the PBKDF2 iterations cap used unless WithMaxPBKDF2Iterations is given
+const DefaultMaxPBKDF2Iterations = 1000000
+
 type Crypto struct {
-	KeyMap sync.Map
+	// KeyStore holds the keys created by scripts, a MemoryKeyStore without
+	// limits unless WithKeyStore is given
+	KeyStore KeyStore
+	// MaxPBKDF2Iterations bounds the CPU time a single deriveBits call may use
+	MaxPBKDF2Iterations int
+	// HostKeys are registered and exposed on HostKeyBinding when injected
+	HostKeys       map[string]*HostKey
+	HostKeyBinding string
+
+	realmsMu     sync.Mutex
+	realms       map[*v8go.Context]*cryptoKeyRealm
+	hostKeysOnce sync.Once
+	hostKeysErr  error
+	hostKeysMu   sync.Mutex
+	hostKeys     map[string]*StoredKey
 }
 
 type KeyAlgorithm string
@@ -44,115 +62,194 @@ const (
 	RSA1_5       = KeyAlgorithm("RSASSA-PKCS1-v1_5") // RSA-PKCS1v1.5
 	RSA_OAEP     = KeyAlgorithm("RSA-OAEP")          // RSA-OAEP-SHA1
 	RSA_OAEP_256 = KeyAlgorithm("RSA-OAEP-256")      // RSA-OAEP-SHA256
+	RSA_PSS      = KeyAlgorithm("RSA-PSS")           // RSASSA-PSS
+	AES_GCM      = KeyAlgorithm("AES-GCM")
+	AES_CBC      = KeyAlgorithm("AES-CBC")
+	AES_CTR      = KeyAlgorithm("AES-CTR")
+	AES_KW       = KeyAlgorithm("AES-KW")
+	HMAC         = KeyAlgorithm("HMAC")
+	ECDSA        = KeyAlgorithm("ECDSA")
+	ECDH         = KeyAlgorithm("ECDH")
+	Ed25519      = KeyAlgorithm("Ed25519")
+	X25519       = KeyAlgorithm("X25519")
+	PBKDF2       = KeyAlgorithm("PBKDF2")
+	HKDF         = KeyAlgorithm("HKDF")
 )
 
-func NewCrypto(opt ...Option) *Crypto {
-	c := &Crypto{}
+// algorithmNames lists the supported algorithms by their canonical name
+var algorithmNames = []KeyAlgorithm{RSA1_5, RSA_OAEP, RSA_OAEP_256, RSA_PSS, AES_GCM, AES_CBC, AES_CTR, AES_KW, HMAC, ECDSA, ECDH, Ed25519, X25519, PBKDF2, HKDF}
 
-	for _, o := range opt {
-		o.apply(c)
+// normalizeAlgorithmName returns the canonical name of an algorithm, matched case-insensitively
+func normalizeAlgorithmName(name string) (string, bool) {
+	for _, n := range algorithmNames {
+		if strings.EqualFold(string(n), name) {
+			return string(n), true
+		}
 	}
+	return name, false
+}
 
-	return c
+// algorithmOperations lists the operations of each algorithm as registered by
+// the WebCrypto spec, "get key length" sizes the key created by deriveKey
+var algorithmOperations = map[KeyAlgorithm][]string{
+	RSA1_5:       {"sign", "verify", "generateKey", "importKey"},
+	RSA_PSS:      {"sign", "verify", "generateKey", "importKey"},
+	RSA_OAEP:     {"encrypt", "decrypt", "generateKey", "importKey"},
+	RSA_OAEP_256: {"encrypt", "decrypt", "generateKey", "importKey"},
+	AES_GCM:      {"encrypt", "decrypt", "generateKey", "importKey", "get key length"},
+	AES_CBC:      {"encrypt", "decrypt", "generateKey", "importKey", "get key length"},
+	AES_CTR:      {"encrypt", "decrypt", "generateKey", "importKey", "get key length"},
+	AES_KW:       {"wrapKey", "unwrapKey", "generateKey", "importKey", "get key length"},
+	HMAC:         {"sign", "verify", "generateKey", "importKey", "get key length"},
+	ECDSA:        {"sign", "verify", "generateKey", "importKey"},
+	ECDH:         {"deriveBits", "generateKey", "importKey"},
+	Ed25519:      {"sign", "verify", "generateKey", "importKey"},
+	X25519:       {"deriveBits", "generateKey", "importKey"},
+	PBKDF2:       {"deriveBits", "importKey", "get key length"},
+	HKDF:         {"deriveBits", "importKey", "get key length"},
 }
 
-//cryptoVerifyFunctionCallback implements https://developer.mozilla.org/en-US/docs/Web/API/SubtleCrypto/verify
-//const result = crypto.subtle.verify(algorithm, key, signature, data);
-//result is a Promise with a Boolean: true if the signature is valid, false otherwise.
-func (c *Crypto) cryptoVerifyFunctionCallback() v8go.FunctionCallback {
-	return func(info *v8go.FunctionCallbackInfo) *v8go.Value {
-		ctx := info.Context()
-		iso := ctx.Isolate()
-		resolver, err := v8go.NewPromiseResolver(ctx)
-		if err != nil {
-			strErr, _ := v8go.NewValue(iso, fmt.Sprintf("error creating newPromiseResolver with ctx: %#v", err))
-			return iso.ThrowException(strErr)
-		}
-		go func() {
-			passed := false
-			defer func() {
-				v, err := v8go.NewValue(iso, passed)
-				if err != nil {
-					resolver.Reject(newErrorValue(iso, "Error creating newvalue: %#v\n", err))
-					return
-				}
-				resolver.Resolve(v)
-			}()
-			args := info.Args()
-			if len(args) != 4 {
-				resolver.Reject(newErrorValue(iso, "Expected algorithm, key, signature, data (4) arguments\n"))
-				return
-			}
+// normalizeAlgorithm returns the canonical name of an algorithm given as string
+// or dictionary, which must support one of the operations. A malformed
+// algorithm is a TypeError, an unknown or unsupported one a NotSupportedError.
+func normalizeAlgorithm(v *v8go.Value, ops ...string) (string, error) {
+	name, err := getAlgorithmName(v)
+	if err != nil {
+		return "", newCryptoError(typeError, "%v", err)
+	}
 
-			algorithm, _, err := getAlgorithm(args[0])
-			if err != nil {
-				resolver.Reject(newErrorValue(iso, "Error parsing Algorithm arg: %#v\n", err))
-				return
-			}
-			_ = algorithm //Need this in future
-			keyBytes, err := args[1].MarshalJSON()
-			if err != nil {
-				resolver.Reject(newErrorValue(iso, "Error marshalling key arg: %#v\n", err))
-				return
-			}
+	canonical, ok := normalizeAlgorithmName(name)
+	if !ok {
+		return "", newCryptoError(domexception.NotSupportedError, "algorithm %s is not supported", name)
+	}
 
-			if !args[2].IsUint8Array() {
-				resolver.Reject(newErrorValue(iso, "Expecting signature in []byte(ArrayBuffer) format\n"))
-				return
+	for _, op := range ops {
+		for _, supported := range algorithmOperations[KeyAlgorithm(canonical)] {
+			if op == supported {
+				return canonical, nil
 			}
+		}
+	}
+	return "", newCryptoError(domexception.NotSupportedError, "%s does not support %s", canonical, ops[0])
+}
 
-			key := &CryptoKey{}
-			err = json.Unmarshal(keyBytes, key)
-			if err != nil {
-				resolver.Reject(newErrorValue(iso, "Error unmarshalling keybytes arg: %#v\n", err))
-				return
-			}
+func NewCrypto(opt ...Option) *Crypto {
+	c := &Crypto{
+		KeyStore:            NewMemoryKeyStore(0, 0),
+		MaxPBKDF2Iterations: DefaultMaxPBKDF2Iterations,
+	}
 
-			if key.Type == "public" {
-				//this expecting public rsa key
-				pubKey, ok := c.KeyMap.Load(key.Kid)
-				if !ok {
-					resolver.Reject(newErrorValue(iso, "Invalid Key : %#v\n", key))
-					return
-				}
-				sign := args[2].Uint8Array()
-				//fmt.Println("sign", string(sign))
-				payload := args[3].Uint8Array()
-				//fmt.Println("payload", string(payload))
+	for _, o := range opt {
+		o.apply(c)
+	}
 
-				var rsaKey *rsa.PublicKey
+	return c
+}
 
-				if rsaKey, ok = pubKey.(*rsa.PublicKey); !ok {
-					resolver.Reject(newErrorValue(iso, "Invalid Key : %#v\n", pubKey))
-					return
-				}
-				var hash crypto.Hash
-
-				switch algorithm.(*RSAAlgoOut).Hash.Name {
-				case "SHA-256":
-					hash = crypto.SHA256
-				case "SHA-384":
-					hash = crypto.SHA384
-				case "SHA-512":
-					hash = crypto.SHA512
-				default:
-					resolver.Reject(newErrorValue(iso, "unknown/unsupported algorithm"))
-					return
-				}
+// importKey creates a CryptoKey from keyData, the JSON text of a jwk or the bytes of the other formats
+func (c *Crypto) importKey(format string, keyData []byte, algorithm interface{}, extractable bool, usages []string) (*CryptoKey, error) {
+	var (
+		key     interface{}
+		keyType string
+		err     error
+	)
+
+	switch algo := algorithm.(type) {
+	case *RSAAlgoOut:
+		key, keyType, err = importRSAKey(format, keyData, algo, extractable, usages)
+	case *AESAlgo:
+		key, err = importAESKey(format, keyData, algo, extractable, usages)
+		keyType = "secret"
+	case *HMACAlgo:
+		key, err = importHMACKey(format, keyData, algo, extractable, usages)
+		keyType = "secret"
+	case *ECAlgo:
+		key, keyType, err = importECKey(format, keyData, algo, extractable, usages)
+	case *OKPAlgo:
+		key, keyType, err = importOKPKey(format, keyData, algo, extractable, usages)
+	case *KDFAlgo:
+		key, err = importKDFKey(format, keyData, algo, extractable, usages)
+		keyType = "secret"
+	default:
+		err = newCryptoError(domexception.NotSupportedError, "importing %T keys is not supported", algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
 
-				hasher := hash.New()
+	return newCryptoKey(key, &CryptoKey{
+		Type:        keyType,
+		Extractable: extractable,
+		Algorithm:   algorithm,
+		Usages:      usages,
+	}), nil
+}
 
-				// According to documentation, Write() on hash never fails
-				_, _ = hasher.Write(payload)
-				hashed := hasher.Sum(nil)
-				err = rsa.VerifyPKCS1v15(rsaKey, hash, hashed, sign)
-				passed = (err == nil)
-			}
+// getKeyData reads the keyData argument of importKey in the given format
+func getKeyData(format string, v *v8go.Value) ([]byte, error) {
+	switch format {
+	case "jwk":
+		if !v.IsObject() || v.IsArrayBuffer() || v.IsArrayBufferView() {
+			return nil, newCryptoError(typeError, "expected keyData as JsonWebKey object for the jwk format")
+		}
+		data, err := v.MarshalJSON()
+		if err != nil {
+			return nil, newCryptoError(typeError, "error marshalling keyData: %v", err)
+		}
+		return data, nil
+	case "spki", "pkcs8":
+		if v.IsString() {
+			return decodePEM(format, []byte(v.String()))
+		}
+		data, err := getBufferSource(v)
+		if err != nil {
+			return nil, newCryptoError(typeError, "keyData: %v", err)
+		}
+		return decodePEM(format, data)
+	case "raw":
+		data, err := getBufferSource(v)
+		if err != nil {
+			return nil, newCryptoError(typeError, "keyData: %v", err)
+		}
+		return data, nil
+	default:
+		return nil, newCryptoError(typeError, "unknown key format %q", format)
+	}
+}
+
+// pemTypes lists the PEM blocks accepted in place of DER spki and pkcs8 key data
+var pemTypes = map[string][]string{
+	"spki":  {"PUBLIC KEY", "RSA PUBLIC KEY"},
+	"pkcs8": {"PRIVATE KEY", "RSA PRIVATE KEY"},
+}
 
-		}()
+// decodePEM returns the DER bytes of PEM encoded key data, DER data is
+// returned as is
+func decodePEM(format string, data []byte) ([]byte, error) {
+	trimmed := bytes.TrimSpace(data)
+	if !bytes.HasPrefix(trimmed, []byte("-----BEGIN ")) {
+		return data, nil
+	}
 
-		return resolver.GetPromise().Value
+	block, _ := pem.Decode(trimmed)
+	if block == nil {
+		return nil, newCryptoError(domexception.DataError, "invalid PEM encoded %s key data", format)
+	}
+	for _, t := range pemTypes[format] {
+		if block.Type == t {
+			return block.Bytes, nil
+		}
 	}
+	return nil, newCryptoError(domexception.DataError, "PEM block %q can't be imported as %s", block.Type, format)
+}
+
+// newJSONValue converts v to a JS value of the script realm through JSON
+func newJSONValue(ctx *v8go.Context, v interface{}) (*v8go.Value, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return v8go.JSONParse(ctx, string(data))
 }
 
 //cryptoImportKeyFunctionCallback implements https://developer.mozilla.org/en-US/docs/Web/API/SubtleCrypto/importKey
@@ -167,102 +264,73 @@ func (c *Crypto) cryptoImportKeyFunctionCallback() v8go.FunctionCallback {
 			strErr, _ := v8go.NewValue(iso, fmt.Sprintf("error creating newPromiseResolver with ctx: %#v", err))
 			return iso.ThrowException(strErr)
 		}
-		go func() {
-			args := info.Args()
 
-			format := args[0].String()
-			var result interface{}
-			switch format {
-			case "jwk":
-				keyData, err := args[1].AsObject() //object type
-				if err != nil {
-					resolver.Reject(newErrorValue(iso, "error getting keyData %#v", err))
-					return
-				}
-				algorithm, _, err := getAlgorithm(args[2])
-				if err != nil {
-					resolver.Reject(newErrorValue(iso, "Error parsing Algorithm arg: %#v\n", err))
-					return
-				}
+		args := info.Args()
+		if len(args) < 5 {
+			resolver.Reject(newTypeError(ctx, "Failed to execute 'importKey': 5 arguments required, but only %d present", len(args)))
+			return resolver.GetPromise().Value
+		}
 
-				extractable := args[3] //boolean
-				if !extractable.IsBoolean() {
-					resolver.Reject(newErrorValue(iso, "Expected extractable argument as boolean type\n"))
-					return
-				}
+		format := args[0].String()
+		keyData, err := getKeyData(format, args[1])
+		if err != nil {
+			resolver.Reject(rejectValue(ctx, "importKey", err))
+			return resolver.GetPromise().Value
+		}
+
+		algorithm, _, err := getAlgorithm(args[2], "importKey")
+		if err != nil {
+			resolver.Reject(rejectValue(ctx, "importKey", err))
+			return resolver.GetPromise().Value
+		}
+		selector := getJWKSelector(args[2])
+
+		extractable := args[3] //boolean
+		if !extractable.IsBoolean() {
+			resolver.Reject(newTypeError(ctx, "Failed to execute 'importKey': expected extractable argument as boolean type"))
+			return resolver.GetPromise().Value
+		}
+
+		keyUsages, err := getKeyUsages(args[4])
+		if err != nil {
+			resolver.Reject(rejectValue(ctx, "importKey", err))
+			return resolver.GetPromise().Value
+		}
+
+		isExtractable := extractable.Boolean()
+		eventloop.For(ctx).Go(func() func() {
+			var key *CryptoKey
+			if format == "jwk" {
+				keyData, err = selectJWK(keyData, selector, algorithm)
+			}
+			if err == nil {
+				key, err = c.importKey(format, keyData, algorithm, isExtractable, keyUsages)
+			}
 
-				keyUsages := args[4] //array
-				if !keyUsages.IsArray() {
-					resolver.Reject(newErrorValue(iso, "Expected keyUsages argument as array type\n"))
+			return func() {
+				if err != nil {
+					resolver.Reject(rejectValue(ctx, "importKey", err))
 					return
 				}
 
-				keyDataBytes, err := keyData.MarshalJSON()
+				v, err := c.newCryptoKeyValue(ctx, key)
 				if err != nil {
-					resolver.Reject(newErrorValue(iso, "error marshalling keyData %#v", err))
+					resolver.Reject(rejectValue(ctx, "importKey", err))
 					return
 				}
-				//fmt.Println(string(keyDataBytes))
-
-				isKeySet := keyData.Has("keys")
-
-				var key interface{}
-				//this expecting public rsa key
-				if isKeySet {
-					keys, err := parseKeySet(keyDataBytes)
-					if err != nil {
-						resolver.Reject(newErrorValue(iso, "Could not parse DER encoded key (encryption key): %#v", err))
-						return
-					}
-					//select the first key from the set
-					key = keys[0]
-				} else {
-					key, err = parseKey(keyDataBytes)
-					if err != nil {
-						resolver.Reject(newErrorValue(iso, "Could not parse DER encoded key (encryption key): %#v", err))
-						return
-					}
-				}
-				//fmt.Println(key)
-				miniPub := uuid.NewUuid()
-				c.KeyMap.Store(miniPub, key)
-
-				result = &CryptoKey{
-					Type:        "public",
-					Kid:         miniPub,
-					Extractable: extractable.Boolean(),
-					Algorithm:   algorithm,
-					Usages:      keyUsages,
-				}
-
-			default:
-				resolver.Reject(newErrorValue(iso, "format %q not supported", format))
-				return
-			}
-
-			resultBytes, err := json.Marshal(result)
-			if err != nil {
-				resolver.Reject(newErrorValue(iso, "error marshalling jsonKey: %#v", err))
-				return
-			}
-			v, err := v8go.JSONParse(info.Context(), string(resultBytes))
-			if err != nil {
-				resolver.Reject(newErrorValue(iso, "error jsonParse on result: %#v", err))
-				return
+				resolver.Resolve(v)
 			}
-
-			resolver.Resolve(v)
-		}()
+		})
 
 		return resolver.GetPromise().Value
 	}
 }
 
 type RSAAlgoIn struct {
-	Name           string           `json:"name"`                         //"RSA-OAEP",
-	ModulusLength  int              `json:"modulusLength" default:"4096"` // 4096,
-	PublicExponent map[string]uint8 `json:"publicExponent"`               // new Uint8Array([1, 0, 1]),
-	Hash           string           `json:"hash"`                         // "SHA-256"
+	Name           string                  `json:"name"`                         //"RSA-OAEP",
+	ModulusLength  int                     `json:"modulusLength" default:"4096"` // 4096,
+	PublicExponent map[string]uint8        `json:"publicExponent"`               // new Uint8Array([1, 0, 1]),
+	Hash           HashAlgorithmIdentifier `json:"hash"`                         // "SHA-256" or { name: "SHA-256" }
 }
 
 type RSAAlgoOut struct {
@@ -272,6 +340,32 @@ type RSAAlgoOut struct {
 	Hash           HashAlgorithmIdentifier `json:"hash"`                         // "SHA-256"
 }
 
+type AESAlgo struct {
+	Name   string `json:"name"`   //"AES-GCM",
+	Length int    `json:"length"` // 128, 192 or 256
+}
+
+type HMACAlgo struct {
+	Name   string                  `json:"name"`   //"HMAC",
+	Hash   HashAlgorithmIdentifier `json:"hash"`   // "SHA-256" or { name: "SHA-256" }
+	Length int                     `json:"length"` // in bits, the block size of the hash by default
+}
+
+type ECAlgo struct {
+	Name       string `json:"name"`       //"ECDSA",
+	NamedCurve string `json:"namedCurve"` // "P-256", "P-384" or "P-521"
+}
+
+// OKPAlgo is the algorithm of the Ed25519 and X25519 keys
+type OKPAlgo struct {
+	Name string `json:"name"` //"Ed25519",
+}
+
+// KDFAlgo is the algorithm of the PBKDF2 and HKDF base keys
+type KDFAlgo struct {
+	Name string `json:"name"` //"PBKDF2",
+}
+
 type HashAlgorithmIdentifier struct {
 	Name string `json:"name"`
 }
@@ -279,16 +373,19 @@ type HashAlgorithmIdentifier struct {
 //for symmetric algo https://developer.mozilla.org/en-US/docs/Web/API/CryptoKey
 type CryptoKey struct {
 	Type        string      `json:"type"`
-	Kid         string      `json:"kid"` //additional property to refer the actual key
+	Kid         string      `json:"-"` //id of the key material in the KeyStore, never exposed to scripts
 	Extractable bool        `json:"extractable"`
 	Algorithm   interface{} `json:"algorithm"`
-	Usages      interface{} `json:"usages"`
+	Usages      []string    `json:"usages"`
+
+	// key is the material of a new key, until it's put in the KeyStore
+	key interface{}
 }
 
 //for public-key algorithms
 type CryptoKeyPair struct {
-	PrivateKey CryptoKey `json:"privateKey"`
-	PublicKey  CryptoKey `json:"publicKey"`
+	PrivateKey *CryptoKey `json:"privateKey"`
+	PublicKey  *CryptoKey `json:"publicKey"`
 }
 
 //cryptoGenerateKeyFunctionCallback implements https://developer.mozilla.org/en-US/docs/Web/API/SubtleCrypto/generateKey
@@ -303,83 +400,63 @@ func (c *Crypto) cryptoGenerateKeyFunctionCallback() v8go.FunctionCallback {
 			strErr, _ := v8go.NewValue(iso, fmt.Sprintf("error creating newPromiseResolver with ctx: %#v", err))
 			return iso.ThrowException(strErr)
 		}
-		go func() {
-			args := info.Args()
-			if len(args) != 3 {
-				resolver.Reject(newErrorValue(iso, "Expected algorithm, extractable, keyUsages (3) arguments\n"))
-				return
-			}
 
-			algorithm, _, err := getAlgorithm(args[0])
-			if err != nil {
-				resolver.Reject(newErrorValue(iso, "Error parsing Algorithm arg: %#v\n", err))
-				return
-			}
-
-			extractable := args[1] //boolean
-			if !extractable.IsBoolean() {
-				resolver.Reject(newErrorValue(iso, "Expected extractable argument as boolean type\n"))
-				return
-			}
+		args := info.Args()
+		if len(args) < 3 {
+			resolver.Reject(newTypeError(ctx, "Failed to execute 'generateKey': 3 arguments required, but only %d present", len(args)))
+			return resolver.GetPromise().Value
+		}
 
-			keyUsages := args[2] //array
-			if !keyUsages.IsArray() {
-				resolver.Reject(newErrorValue(iso, "Expected keyUsages argument as array type\n"))
-				return
-			}
+		algorithm, _, err := getAlgorithm(args[0], "generateKey")
+		if err != nil {
+			resolver.Reject(rejectValue(ctx, "generateKey", err))
+			return resolver.GetPromise().Value
+		}
 
-			var result interface{}
+		extractable := args[1] //boolean
+		if !extractable.IsBoolean() {
+			resolver.Reject(newTypeError(ctx, "Failed to execute 'generateKey': expected extractable argument as boolean type"))
+			return resolver.GetPromise().Value
+		}
 
-			primeBits := 2048
+		keyUsages, err := getKeyUsages(args[2])
+		if err != nil {
+			resolver.Reject(rejectValue(ctx, "generateKey", err))
+			return resolver.GetPromise().Value
+		}
 
-			rsaAlgo := algorithm.(*RSAAlgoOut)
-			if rsaAlgo.ModulusLength != 0 {
-				primeBits = rsaAlgo.ModulusLength
-			}
-			// The GenerateKey method takes in a reader that returns random bits, and
-			// the number of bits
-			privateKey, err := rsa.GenerateKey(rand.Reader, primeBits) //2048 by default
-			if err != nil {
-				resolver.Reject(newErrorValue(iso, "error generating RSA key: %#v", err))
-				return
+		isExtractable := extractable.Boolean()
+		eventloop.For(ctx).Go(func() func() {
+			var result interface{}
+			switch algo := algorithm.(type) {
+			case *RSAAlgoOut:
+				result, err = c.generateRSAKeyPair(algo, isExtractable, keyUsages)
+			case *AESAlgo:
+				result, err = c.generateAESKey(algo, isExtractable, keyUsages)
+			case *HMACAlgo:
+				result, err = c.generateHMACKey(algo, isExtractable, keyUsages)
+			case *ECAlgo:
+				result, err = c.generateECKeyPair(algo, isExtractable, keyUsages)
+			case *OKPAlgo:
+				result, err = c.generateOKPKeyPair(algo, isExtractable, keyUsages)
+			default:
+				err = newCryptoError(domexception.NotSupportedError, "generating %T keys is not supported", algorithm)
 			}
 
-			//store a pointer reference with the fetcher
-			miniPriv := uuid.NewUuid()
-			c.KeyMap.Store(miniPriv, privateKey)
-			miniPub := uuid.NewUuid()
-			c.KeyMap.Store(miniPub, &privateKey.PublicKey)
-
-			result = &CryptoKeyPair{
-				PrivateKey: CryptoKey{
-					Type:        "private",
-					Kid:         miniPriv,
-					Extractable: extractable.Boolean(),
-					Algorithm:   algorithm,
-					Usages:      keyUsages.Object(),
-				},
-				PublicKey: CryptoKey{
-					Type:        "public",
-					Kid:         miniPub,
-					Extractable: extractable.Boolean(),
-					Algorithm:   algorithm,
-					Usages:      keyUsages.Object(),
-				},
-			}
+			return func() {
+				if err != nil {
+					resolver.Reject(rejectValue(ctx, "generateKey", err))
+					return
+				}
 
-			resultBytes, err := json.Marshal(result)
-			if err != nil {
-				resolver.Reject(newErrorValue(iso, "error marshalling jsonKey: %#v", err))
-				return
-			}
-			v, err := v8go.JSONParse(info.Context(), string(resultBytes))
-			if err != nil {
-				resolver.Reject(newErrorValue(iso, "error jsonParse on result: %#v", err))
-				return
+				v, err := c.newKeyResultValue(ctx, result)
+				if err != nil {
+					resolver.Reject(rejectValue(ctx, "generateKey", err))
+					return
+				}
+				resolver.Resolve(v)
 			}
-
-			resolver.Resolve(v)
-		}()
+		})
 
 		return resolver.GetPromise().Value
 	}
@@ -390,48 +467,84 @@ func newErrorValue(iso *v8go.Isolate, format string, a ...interface{}) *v8go.Val
 	return e
 }
 
-func getAlgorithm(v *v8go.Value) (interface{}, string, error) {
-	algorithm, err := v.AsObject() //object type
+// getAlgorithm normalizes the algorithm argument of generateKey, importKey
+// ("importKey" and unwrapKey) or deriveKey ("get key length") and checks its
+// required members
+func getAlgorithm(v *v8go.Value, op string) (interface{}, string, error) {
+	name, err := normalizeAlgorithm(v, op)
 	if err != nil {
-		return nil, "", fmt.Errorf("expected algorithm argument as Object type: %#v", err)
-	}
-	if !algorithm.Has("name") {
-		return nil, "", fmt.Errorf("missing algorithm's name property")
-	}
-	algoName, err := algorithm.Get("name")
-	if err != nil {
-		return nil, "", fmt.Errorf("missing algorithm's name property:%#v", err)
-	}
-	if algoName.String() == "" {
-		return nil, "", fmt.Errorf("missing algorithm's name property value")
+		return nil, "", err
 	}
-	res, err := algorithm.MarshalJSON()
-	if err != nil {
-		return nil, "", fmt.Errorf("error Marshalling algorithm:%#v", err)
+
+	res := []byte("{}")
+	if v.IsObject() {
+		if res, err = v.MarshalJSON(); err != nil {
+			return nil, "", newCryptoError(typeError, "%v", err)
+		}
 	}
 
 	var result interface{}
-	switch algoName.String() {
-	case string(RSA1_5), string(RSA_OAEP), string(RSA_OAEP_256):
+	switch name {
+	case string(RSA1_5), string(RSA_OAEP), string(RSA_OAEP_256), string(RSA_PSS):
 		rsa := &RSAAlgoIn{}
-		err = json.Unmarshal(res, rsa)
-		if err != nil {
-			return nil, "", fmt.Errorf("error UnMarshalling algorithm:%#v", err)
+		if err := json.Unmarshal(res, rsa); err != nil {
+			return nil, "", newCryptoError(typeError, "%s params: %v", name, err)
+		}
+		if op == "generateKey" {
+			if rsa.ModulusLength == 0 {
+				return nil, "", newCryptoError(typeError, "%s params: modulusLength is required", name)
+			}
+			if len(rsa.PublicExponent) == 0 {
+				return nil, "", newCryptoError(typeError, "%s params: publicExponent is required", name)
+			}
 		}
-		rsaout := &RSAAlgoOut{
-			Name:           rsa.Name,
+		// RSA-OAEP-256 implies SHA-256
+		if name != string(RSA_OAEP_256) || rsa.Hash.Name != "" {
+			if err := normalizeHash(name, &rsa.Hash); err != nil {
+				return nil, "", err
+			}
+		}
+		result = &RSAAlgoOut{
+			Name:           name,
+			ModulusLength:  rsa.ModulusLength,
 			PublicExponent: rsa.PublicExponent,
-			Hash: HashAlgorithmIdentifier{
-				Name: rsa.Hash,
-			},
+			Hash:           rsa.Hash,
 		}
-		if rsa.ModulusLength == 0 {
-			rsaout.ModulusLength = 2048
+	case string(AES_GCM), string(AES_CBC), string(AES_CTR), string(AES_KW):
+		aes := &AESAlgo{}
+		if err := json.Unmarshal(res, aes); err != nil {
+			return nil, "", newCryptoError(typeError, "%s params: %v", name, err)
 		}
-		result = rsaout
-	default:
-		return nil, "", fmt.Errorf("unsupported algorithm - %s is not yet supported", algoName.String())
+		if op != "importKey" && aes.Length == 0 {
+			return nil, "", newCryptoError(typeError, "%s params: length is required", name)
+		}
+		aes.Name = name
+		result = aes
+	case string(HMAC):
+		hmac := &HMACAlgo{}
+		if err := json.Unmarshal(res, hmac); err != nil {
+			return nil, "", newCryptoError(typeError, "%s params: %v", name, err)
+		}
+		if err := normalizeHash(name, &hmac.Hash); err != nil {
+			return nil, "", err
+		}
+		hmac.Name = name
+		result = hmac
+	case string(ECDSA), string(ECDH):
+		ec := &ECAlgo{}
+		if err := json.Unmarshal(res, ec); err != nil {
+			return nil, "", newCryptoError(typeError, "%s params: %v", name, err)
+		}
+		if ec.NamedCurve == "" {
+			return nil, "", newCryptoError(typeError, "%s params: namedCurve is required", name)
+		}
+		ec.Name = name
+		result = ec
+	case string(Ed25519), string(X25519):
+		result = &OKPAlgo{Name: name}
+	case string(PBKDF2), string(HKDF):
+		result = &KDFAlgo{Name: name}
 	}
 
-	return result, algoName.String(), nil
+	return result, name, nil
 }
@@ -23,10 +23,24 @@
 package crypto
 
 import (
+	gocrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/esoptra/v8go"
+	"github.com/esoptra/v8go-polyfills/eventloop"
 
 	"github.com/esoptra/v8go-polyfills/base64"
 	"github.com/esoptra/v8go-polyfills/console"
@@ -46,7 +60,9 @@ func TestCrypto(t *testing.T) {
 	ctx, err := textEncoder.InjectWith(iso, con)
 	if err != nil {
 		t.Error(err)
+		return
 	}
+	defer eventloop.Close(ctx)
 
 	if err := InjectWith(iso, ctx); err != nil {
 		t.Error(err)
@@ -70,12 +86,10 @@ func TestCrypto(t *testing.T) {
 let data = await fetchKeys()
 
 const algo = {
-  name: "RSA-OAEP",
-  modulusLength: 4096,
-  publicExponent: new Uint8Array([1, 0, 1]),
+  name: "RSASSA-PKCS1-v1_5",
   hash: "SHA-256"
 };
-let importedKey = await crypto.subtle.importKey('jwk', data, algo, true, ["encrypt", "decrypt"]);
+let importedKey = await crypto.subtle.importKey('jwk', data, algo, true, ["verify"]);
 //console.log(importedKey.kid);
 
 const token = 'eyJ0eXAiOiJKV1QiLCJhbGciOiJSUzI1NiIsImtpZCI6Im5PbzNaRHJPRFhFSzFqS1doWHNsSFJfS1hFZyJ9.eyJhdWQiOiIwOGQ0NWY3Zi0xNmM5LTQ1ZGUtYmFkZC05NDc3ZGRjZTVlMzYiLCJpc3MiOiJodHRwczovL2xvZ2luLm1pY3Jvc29mdG9ubGluZS5jb20vZWMxMDAyZDctMDM0OC00MGFlLWFlNGUtOTBjMDA1MDZlYWNkL3YyLjAiLCJpYXQiOjE2MjM3NDMzNDcsIm5iZiI6MTYyMzc0MzM0NywiZXhwIjoxNjIzNzQ3MjQ3LCJhaW8iOiJBV1FBbS84VEFBQUFtbEJHSkpMT25BbllSMFRTVFUvdS9NQzhQNDdTSWJncWltY0xva1B0OFpLbGpvdW5IdmJ3M0d4UHJqTnlWNDkrbW5JTUhUNW84R2tXSHprelN4Qk5QSE0vWmVDWFdSc0FITmxtNW1oTURaWEMvWkJ5N3UwT0xVbTMrU0ZBSWR0NiIsImlkcCI6Imh0dHBzOi8vc3RzLndpbmRvd3MubmV0LzU2OTc1MzBiLWRmYzMtNDhlZi1iMWFjLTk4ZTRmZTY4MTI1Mi8iLCJuYW1lIjoiYmFja2tlbSIsIm9pZCI6IjIyNjZhMGYxLWFiZWYtNGRmNC1hY2UwLTNhZDk4NTcxOWRjMCIsInByZWZlcnJlZF91c2VybmFtZSI6Ik1pY2hpZWwuZGViYWNra2VyQHR3aW50YWcuY29tIiwicmgiOiIwLkFRd0Exd0lRN0VnRHJrQ3VUcERBQlFicXpYOWYxQWpKRnQ1RnV0MlVkOTNPWGpZTUFLVS4iLCJzdWIiOiJRR1BSamZrWUhaLTl2MFlrU2lQdm1YX3BhQTAzYzRDbGZrcUlkQWpoMDFvIiwidGlkIjoiZWMxMDAyZDctMDM0OC00MGFlLWFlNGUtOTBjMDA1MDZlYWNkIiwidXRpIjoiOHRaWlB1WHdQVUtPRUVLOGhraWxBQSIsInZlciI6IjIuMCJ9.j58zhFkqOPtcxB-gA1LdLYJYQw_oVZ2vDiZXD6M9nZNWbgAmFFkvN7CuhQFYR5rM9XaGrO-Rn4X6X389aFk-sZKQUOtVqmW4VT8_yT2iSGVspL5BcwWYeR0vEjO_5UNoavSunXz_qOFzzQqUYZ2-ex3KG9x7cL1Tc1kVv2JmAtUB-yK5t5yZU1BzNteIDCC4QEUa_vBxZrTwVEkRW_fT26TonWZTikYvi80COSFlMRiDD-gK2QFHrjcyPvhETTYDzXYhHoJDolcey59ERu9301SE9flTMigVpJlL5SreMIWhy1-vWt5lbCPOA246o3hEa_HAmAVgIdC1t1tSsj61hw'
@@ -109,8 +123,9 @@ Promise.resolve(res)`, "crypto.js")
 		return
 	}
 
-	for proms.State() == v8go.Pending {
-		continue
+	if err := eventloop.For(ctx).RunFor(time.Second * 10); err != nil {
+		t.Error(err)
+		return
 	}
 
 	res := proms.Result().String()
@@ -133,7 +148,9 @@ func TestImportKey(t *testing.T) {
 	ctx, err := textEncoder.InjectWith(iso, con)
 	if err != nil {
 		t.Error(err)
+		return
 	}
+	defer eventloop.Close(ctx)
 
 	if err := InjectWith(iso, ctx); err != nil {
 		t.Error(err)
@@ -150,7 +167,7 @@ func TestImportKey(t *testing.T) {
 				const key = {"kty":"RSA","use":"sig","kid":"l3sQ-50cCH4xBVZLHTGwnSR7680","x5t":"l3sQ-50cCH4xBVZLHTGwnSR7680","n":"sfsXMXWuO-dniLaIELa3Pyqz9Y_rWff_AVrCAnFSdPHa8__Pmkbt_yq-6Z3u1o4gjRpKWnrjxIh8zDn1Z1RS26nkKcNg5xfWxR2K8CPbSbY8gMrp_4pZn7tgrEmoLMkwfgYaVC-4MiFEo1P2gd9mCdgIICaNeYkG1bIPTnaqquTM5KfT971MpuOVOdM1ysiejdcNDvEb7v284PYZkw2imwqiBY3FR0sVG7jgKUotFvhd7TR5WsA20GS_6ZIkUUlLUbG_rXWGl0YjZLS_Uf4q8Hbo7u-7MaFn8B69F6YaFdDlXm_A0SpedVFWQFGzMsp43_6vEzjfrFDJVAYkwb6xUQ","e":"AQAB","x5c":["MIIDBTCCAe2gAwIBAgIQWPB1ofOpA7FFlOBk5iPaNTANBgkqhkiG9w0BAQsFADAtMSswKQYDVQQDEyJhY2NvdW50cy5hY2Nlc3Njb250cm9sLndpbmRvd3MubmV0MB4XDTIxMDIwNzE3MDAzOVoXDTI2MDIwNjE3MDAzOVowLTErMCkGA1UEAxMiYWNjb3VudHMuYWNjZXNzY29udHJvbC53aW5kb3dzLm5ldDCCASIwDQYJKoZIhvcNAQEBBQADggEPADCCAQoCggEBALH7FzF1rjvnZ4i2iBC2tz8qs/WP61n3/wFawgJxUnTx2vP/z5pG7f8qvumd7taOII0aSlp648SIfMw59WdUUtup5CnDYOcX1sUdivAj20m2PIDK6f+KWZ+7YKxJqCzJMH4GGlQvuDIhRKNT9oHfZgnYCCAmjXmJBtWyD052qqrkzOSn0/e9TKbjlTnTNcrIno3XDQ7xG+79vOD2GZMNopsKogWNxUdLFRu44ClKLRb4Xe00eVrANtBkv+mSJFFJS1Gxv611hpdGI2S0v1H+KvB26O7vuzGhZ/AevRemGhXQ5V5vwNEqXnVRVkBRszLKeN/+rxM436xQyVQGJMG+sVECAwEAAaMhMB8wHQYDVR0OBBYEFLlRBSxxgmNPObCFrl+hSsbcvRkcMA0GCSqGSIb3DQEBCwUAA4IBAQB+UQFTNs6BUY3AIGkS2ZRuZgJsNEr/ZEM4aCs2domd2Oqj7+5iWsnPh5CugFnI4nd+ZLgKVHSD6acQ27we+eNY6gxfpQCY1fiN/uKOOsA0If8IbPdBEhtPerRgPJFXLHaYVqD8UYDo5KNCcoB4Kh8nvCWRGPUUHPRqp7AnAcVrcbiXA/bmMCnFWuNNahcaAKiJTxYlKDaDIiPN35yECYbDj0PBWJUxobrvj5I275jbikkp8QSLYnSU/v7dMDUbxSLfZ7zsTuaF2Qx+L62PsYTwLzIFX3M8EMSQ6h68TupFTi5n0M2yIXQgoRoNEDWNJZ/aZMY/gqT02GQGBWrh+/vJ"],"issuer":"https://login.microsoftonline.com/24b080cd-5874-44ab-9862-8d7e0e0781ab/v2.0","alg":"RS256"}
 				const algo = {"name":"RSASSA-PKCS1-v1_5","hash":"SHA-256"}
 	let importedKey = await crypto.subtle.importKey('jwk', key, algo, false, ["verify"]);
-	return importedKey
+	return { type: importedKey.type, algorithm: importedKey.algorithm }
 	};
 	let res = epsilon();
 	Promise.resolve(res)`, "crypto.js")
@@ -164,8 +181,9 @@ func TestImportKey(t *testing.T) {
 		return
 	}
 
-	for proms.State() == v8go.Pending {
-		continue
+	if err := eventloop.For(ctx).RunFor(time.Second * 10); err != nil {
+		t.Error(err)
+		return
 	}
 	if !proms.Result().IsObject() {
 		t.Error("expected object type but got error")
@@ -206,6 +224,7 @@ func TestVerify(t *testing.T) {
 	}
 
 	ctx := v8go.NewContext(iso, con)
+	defer eventloop.Close(ctx)
 	if err := InjectWith(iso, ctx); err != nil {
 		t.Error(err)
 		return
@@ -278,8 +297,9 @@ func TestVerify(t *testing.T) {
 		return
 	}
 
-	for proms.State() == v8go.Pending {
-		continue
+	if err := eventloop.For(ctx).RunFor(time.Second * 10); err != nil {
+		t.Error(err)
+		return
 	}
 	if !proms.Result().IsBoolean() {
 		t.Error("expected boolean in result, but got error")
@@ -291,3 +311,1119 @@ func TestVerify(t *testing.T) {
 	}
 
 }
+
+func newV8ContextWithCrypto(opt ...Option) (*v8go.Context, error) {
+	iso := v8go.NewIsolate()
+	global := v8go.NewObjectTemplate(iso)
+	if err := base64.InjectTo(iso, global); err != nil {
+		return nil, err
+	}
+
+	ctx := v8go.NewContext(iso, global)
+	if err := InjectWith(iso, ctx, opt...); err != nil {
+		return nil, err
+	}
+
+	return ctx, nil
+}
+
+// runAsync runs script and waits for the promise it evaluates to, if any
+func runAsync(ctx *v8go.Context, script string) (*v8go.Value, error) {
+	val, err := ctx.RunScript(script, "crypto_async.js")
+	if err != nil {
+		return nil, err
+	}
+
+	if !val.IsPromise() {
+		return val, nil
+	}
+
+	proms, err := val.AsPromise()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := eventloop.For(ctx).RunFor(time.Second * 10); err != nil {
+		return nil, err
+	}
+
+	if proms.State() == v8go.Rejected {
+		return nil, fmt.Errorf("promise rejected: %s", proms.Result().DetailString())
+	}
+
+	return proms.Result(), nil
+}
+
+func TestGetRandomValues(t *testing.T) {
+	ctx, err := newV8ContextWithCrypto()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer ctx.Isolate().Dispose()
+	defer eventloop.Close(ctx)
+
+	val, err := runAsync(ctx, `
+	const bytes = new Uint8Array(64);
+	const same = crypto.getRandomValues(bytes) === bytes;
+	const words = crypto.getRandomValues(new Uint32Array(new ArrayBuffer(64), 16, 4));
+	const errName = (fn) => { try { fn(); return "none" } catch (e) { return e.name } };
+	JSON.stringify({
+		same,
+		filled: bytes.some(b => b !== 0),
+		words: words.length === 4 && words.some(w => w !== 0),
+		untouched: new Uint8Array(words.buffer, 0, 16).every(b => b === 0) && new Uint8Array(words.buffer, 32).every(b => b === 0),
+		float: errName(() => crypto.getRandomValues(new Float64Array(4))),
+		view: errName(() => crypto.getRandomValues(new DataView(new ArrayBuffer(4)))),
+		array: errName(() => crypto.getRandomValues([1, 2, 3])),
+		quota: errName(() => crypto.getRandomValues(new Uint8Array(65537))),
+		max: errName(() => crypto.getRandomValues(new Uint8Array(65536))),
+	})`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	expected := `{"same":true,"filled":true,"words":true,"untouched":true,"float":"TypeMismatchError","view":"TypeMismatchError","array":"TypeError","quota":"QuotaExceededError","max":"none"}`
+	if val.String() != expected {
+		t.Errorf("expected %s but got %s", expected, val.String())
+	}
+}
+
+func TestRandomUUID(t *testing.T) {
+	ctx, err := newV8ContextWithCrypto()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer ctx.Isolate().Dispose()
+	defer eventloop.Close(ctx)
+
+	val, err := runAsync(ctx, `
+	const re = /^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$/;
+	const a = crypto.randomUUID(), b = crypto.randomUUID();
+	re.test(a) && re.test(b) && a !== b`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !val.Boolean() {
+		t.Error("expected two distinct v4 uuids")
+	}
+}
+
+func TestDigest(t *testing.T) {
+	ctx, err := newV8ContextWithCrypto()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer ctx.Isolate().Dispose()
+	defer eventloop.Close(ctx)
+
+	val, err := runAsync(ctx, `
+	const hex = (buf) => Array.from(new Uint8Array(buf)).map(b => b.toString(16).padStart(2, "0")).join("");
+	const abc = new Uint8Array([0x61, 0x62, 0x63]);
+	const padded = new Uint8Array([0, 0x61, 0x62, 0x63, 0]);
+	(async () => {
+		const sha1 = await crypto.subtle.digest("SHA-1", abc.buffer);
+		const sha256 = await crypto.subtle.digest({ name: "sha-256" }, padded.subarray(1, 4));
+		const view = await crypto.subtle.digest("SHA-256", new DataView(padded.buffer, 1, 3));
+		const sha512 = await crypto.subtle.digest("SHA-512", abc);
+		let unsupported;
+		try { await crypto.subtle.digest("MD5", abc) } catch (e) { unsupported = e.name }
+		return JSON.stringify({
+			isBuffer: sha1 instanceof ArrayBuffer,
+			sha1: hex(sha1),
+			sha256: hex(sha256),
+			view: hex(view) === hex(sha256),
+			sha512: hex(sha512).slice(0, 16),
+			unsupported,
+		});
+	})()`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	expected := `{"isBuffer":true,"sha1":"a9993e364706816aba3e25717850c26c9cd0d89d","sha256":"ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad","view":true,"sha512":"ddaf35a193617aba","unsupported":"NotSupportedError"}`
+	if val.String() != expected {
+		t.Errorf("expected %s but got %s", expected, val.String())
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	ctx, err := newV8ContextWithCrypto()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer ctx.Isolate().Dispose()
+	defer eventloop.Close(ctx)
+
+	val, err := runAsync(ctx, `
+	const errName = async (p) => { try { await p; return "none" } catch (e) { return e.name } };
+	const data = new Uint8Array([1, 2, 3, 4]);
+	(async () => {
+		const pkcs = await crypto.subtle.generateKey({ name: "RSASSA-PKCS1-v1_5", modulusLength: 2048, publicExponent: new Uint8Array([1, 0, 1]), hash: "SHA-256" }, false, ["sign", "verify"]);
+		const sig = await crypto.subtle.sign("RSASSA-PKCS1-v1_5", pkcs.privateKey, data);
+		const pss = await crypto.subtle.generateKey({ name: "RSA-PSS", modulusLength: 1024, publicExponent: new Uint8Array([1, 0, 1]), hash: { name: "SHA-384" } }, false, ["sign", "verify"]);
+		const pssSig = await crypto.subtle.sign({ name: "RSA-PSS", saltLength: 48 }, pss.privateKey, data.buffer);
+		const zeroSig = await crypto.subtle.sign({ name: "RSA-PSS", saltLength: 0 }, pss.privateKey, data);
+		return JSON.stringify({
+			usages: [pkcs.publicKey.usages, pkcs.privateKey.usages],
+			modulusLength: pss.privateKey.algorithm.modulusLength,
+			sigLength: [sig.byteLength, pssSig.byteLength],
+			valid: await crypto.subtle.verify({ name: "RSASSA-PKCS1-v1_5" }, pkcs.publicKey, sig, data),
+			tampered: await crypto.subtle.verify("RSASSA-PKCS1-v1_5", pkcs.publicKey, sig, new Uint8Array([1, 2, 3, 5])),
+			pssValid: await crypto.subtle.verify({ name: "RSA-PSS", saltLength: 48 }, pss.publicKey, new Uint8Array(pssSig), data),
+			pssSalt: await crypto.subtle.verify({ name: "RSA-PSS", saltLength: 32 }, pss.publicKey, pssSig, data),
+			publicSign: await errName(crypto.subtle.sign("RSASSA-PKCS1-v1_5", pkcs.publicKey, data)),
+			mismatch: await errName(crypto.subtle.sign({ name: "RSA-PSS", saltLength: 32 }, pkcs.privateKey, data)),
+			noSalt: await errName(crypto.subtle.sign("RSA-PSS", pss.privateKey, data)),
+			zeroSalt: [
+				await crypto.subtle.verify({ name: "RSA-PSS", saltLength: 0 }, pss.publicKey, zeroSig, data),
+				await crypto.subtle.verify({ name: "RSA-PSS", saltLength: 0 }, pss.publicKey, zeroSig, new Uint8Array([1, 2, 3, 5])),
+				await crypto.subtle.verify({ name: "RSA-PSS", saltLength: 0 }, pss.publicKey, pssSig, data),
+				await crypto.subtle.verify({ name: "RSA-PSS", saltLength: 48 }, pss.publicKey, zeroSig, data),
+			],
+			unknown: await errName(crypto.subtle.sign("RSA-FOO", pss.privateKey, data)),
+		});
+	})()`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	expected := `{"usages":[["verify"],["sign"]],"modulusLength":1024,"sigLength":[256,128],"valid":true,"tampered":false,"pssValid":true,"pssSalt":false,"publicSign":"InvalidAccessError","mismatch":"InvalidAccessError","noSalt":"TypeError","zeroSalt":[true,false,false,false],"unknown":"NotSupportedError"}`
+	if val.String() != expected {
+		t.Errorf("expected %s but got %s", expected, val.String())
+	}
+
+	// Go can't sign without a salt but detects an empty one when verifying
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hasher := gocrypto.SHA256.New()
+	_, _ = hasher.Write([]byte{1, 2, 3, 4})
+	hashed := hasher.Sum(nil)
+	sig, err := pssSignNoSalt(key, gocrypto.SHA256, hashed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rsa.VerifyPSS(&key.PublicKey, gocrypto.SHA256, hashed, sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto}); err != nil {
+		t.Errorf("the signature without salt doesn't verify with Go: %v", err)
+	}
+	if !pssVerifyNoSalt(&key.PublicKey, gocrypto.SHA256, hashed, sig) {
+		t.Error("the signature without salt doesn't verify")
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	ctx, err := newV8ContextWithCrypto()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer ctx.Isolate().Dispose()
+	defer eventloop.Close(ctx)
+
+	val, err := runAsync(ctx, `
+	const errName = async (p) => { try { await p; return "none" } catch (e) { return e.name } };
+	const str = (buf) => String.fromCharCode(...new Uint8Array(buf));
+	const data = new Uint8Array([104, 101, 108, 108, 111]);
+	const label = new Uint8Array([1, 2, 3]);
+	const generate = (hash) => crypto.subtle.generateKey({ name: "RSA-OAEP", modulusLength: 2048, publicExponent: new Uint8Array([1, 0, 1]), hash }, false, ["encrypt", "decrypt"]);
+	(async () => {
+		const sha256 = await generate("SHA-256");
+		const sha512 = await generate({ name: "SHA-512" });
+		const ct = await crypto.subtle.encrypt({ name: "RSA-OAEP", label }, sha256.publicKey, data);
+		const ct512 = await crypto.subtle.encrypt("RSA-OAEP", sha512.publicKey, data.buffer);
+		const oaep256 = await crypto.subtle.generateKey({ name: "RSA-OAEP-256", modulusLength: 2048, publicExponent: new Uint8Array([1, 0, 1]) }, false, ["encrypt", "decrypt"]);
+		const sha1 = await generate("SHA-1");
+		return JSON.stringify({
+			usages: [sha256.publicKey.usages, sha256.privateKey.usages],
+			length: ct.byteLength,
+			plain: str(await crypto.subtle.decrypt({ name: "RSA-OAEP", label: label.buffer }, sha256.privateKey, ct)),
+			plain512: str(await crypto.subtle.decrypt({ name: "rsa-oaep" }, sha512.privateKey, new Uint8Array(ct512))),
+			wrongLabel: await errName(crypto.subtle.decrypt({ name: "RSA-OAEP", label: new Uint8Array([9]) }, sha256.privateKey, ct)),
+			wrongKey: await errName(crypto.subtle.decrypt("RSA-OAEP", sha512.privateKey, ct)),
+			tooLong: await errName(crypto.subtle.encrypt("RSA-OAEP", sha512.publicKey, new Uint8Array(200))),
+			publicDecrypt: await errName(crypto.subtle.decrypt("RSA-OAEP", sha256.publicKey, ct)),
+			badLabel: await errName(crypto.subtle.encrypt({ name: "RSA-OAEP", label: "abc" }, sha256.publicKey, data)),
+			family: [
+				str(await crypto.subtle.decrypt("RSA-OAEP-256", oaep256.privateKey, await crypto.subtle.encrypt({ name: "RSA-OAEP" }, oaep256.publicKey, data))),
+				str(await crypto.subtle.decrypt("RSA-OAEP", sha256.privateKey, await crypto.subtle.encrypt("RSA-OAEP-256", sha256.publicKey, data))),
+			],
+			wrongHash: await errName(crypto.subtle.encrypt("RSA-OAEP-256", sha1.publicKey, data)),
+		});
+	})()`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	expected := `{"usages":[["encrypt"],["decrypt"]],"length":256,"plain":"hello","plain512":"hello","wrongLabel":"OperationError","wrongKey":"OperationError","tooLong":"OperationError","publicDecrypt":"InvalidAccessError","badLabel":"TypeError","family":["hello","hello"],"wrongHash":"InvalidAccessError"}`
+	if val.String() != expected {
+		t.Errorf("expected %s but got %s", expected, val.String())
+	}
+}
+
+func TestExportRSA(t *testing.T) {
+	ctx, err := newV8ContextWithCrypto()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer ctx.Isolate().Dispose()
+	defer eventloop.Close(ctx)
+
+	val, err := runAsync(ctx, `
+	const errName = async (p) => { try { await p; return "none" } catch (e) { return e.name } };
+	const data = new Uint8Array([1, 2, 3, 4]);
+	const rsa = (name, hash, extractable, usages) => crypto.subtle.generateKey({ name, modulusLength: 1024, publicExponent: new Uint8Array([1, 0, 1]), hash }, extractable, usages);
+	(async () => {
+		const pss = await rsa("RSA-PSS", "SHA-256", true, ["sign", "verify"]);
+		const oaep = await rsa("RSA-OAEP", "SHA-256", false, ["encrypt", "decrypt"]);
+		const pkcs = await rsa("RSASSA-PKCS1-v1_5", "SHA-512", true, ["sign", "verify"]);
+		const pub = await crypto.subtle.exportKey("jwk", pss.publicKey);
+		const priv = await crypto.subtle.exportKey("jwk", pss.privateKey);
+		const imported = await crypto.subtle.importKey("jwk", pub, { name: "RSA-PSS", hash: "SHA-256" }, true, ["verify"]);
+		const sig = await crypto.subtle.sign({ name: "RSA-PSS", saltLength: 32 }, pss.privateKey, data);
+		const spki = new Uint8Array(await crypto.subtle.exportKey("spki", pss.publicKey));
+		const pkcs8 = new Uint8Array(await crypto.subtle.exportKey("pkcs8", pss.privateKey));
+		return JSON.stringify({
+			public: [pub.kty, pub.alg, pub.e, pub.key_ops, pub.ext, "d" in pub],
+			private: [priv.alg, priv.n === pub.n, ["d", "p", "q", "dp", "dq", "qi"].every((k) => typeof priv[k] === "string"), priv.key_ops],
+			verify: await crypto.subtle.verify({ name: "RSA-PSS", saltLength: 32 }, imported, sig, data),
+			der: [spki[0], pkcs8[0], spki.length < pkcs8.length],
+			algs: [(await crypto.subtle.exportKey("jwk", oaep.publicKey)).alg, (await crypto.subtle.exportKey("jwk", pkcs.privateKey)).alg],
+			notExtractable: await errName(crypto.subtle.exportKey("jwk", oaep.privateKey)),
+			spkiPrivate: await errName(crypto.subtle.exportKey("spki", pss.privateKey)),
+			pkcs8Public: await errName(crypto.subtle.exportKey("pkcs8", pss.publicKey)),
+			raw: await errName(crypto.subtle.exportKey("raw", pss.publicKey)),
+		});
+	})()`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	expected := `{"public":["RSA","PS256","AQAB",["verify"],true,false],"private":["PS256",true,true,["sign"]],"verify":true,"der":[48,48,true],"algs":["RSA-OAEP-256","RS512"],"notExtractable":"InvalidAccessError","spkiPrivate":"InvalidAccessError","pkcs8Public":"InvalidAccessError","raw":"NotSupportedError"}`
+	if val.String() != expected {
+		t.Errorf("expected %s but got %s", expected, val.String())
+	}
+}
+
+func TestImportRSA(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	spki, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	pkcs8PEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})
+	pkcs1PEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&key.PublicKey)})
+
+	ctx, err := newV8ContextWithCrypto()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer ctx.Isolate().Dispose()
+	defer eventloop.Close(ctx)
+
+	val, err := runAsync(ctx, fmt.Sprintf(`
+	const errName = async (p) => { try { await p; return "none" } catch (e) { return e.name } };
+	const bytes = (h) => new Uint8Array(h.match(/../g).map(b => parseInt(b, 16)));
+	const data = new Uint8Array([1, 2, 3, 4]);
+	const pkcs8PEM = %q, pkcs1PEM = %q, spki = bytes(%q);
+	const pss = { name: "RSA-PSS", hash: "SHA-256" };
+	const params = { name: "RSA-PSS", saltLength: 32 };
+	(async () => {
+		const priv = await crypto.subtle.importKey("pkcs8", pkcs8PEM, pss, true, ["sign"]);
+		const pub = await crypto.subtle.importKey("spki", pkcs1PEM, pss, false, ["verify"]);
+		const der = await crypto.subtle.importKey("spki", spki, pss, true, ["verify"]);
+		const sig = await crypto.subtle.sign(params, priv, data);
+		const privJwk = await crypto.subtle.exportKey("jwk", priv);
+		const fromJwk = await crypto.subtle.importKey("jwk", privJwk, pss, false, ["sign"]);
+
+		const other = await crypto.subtle.generateKey({ name: "RSA-PSS", modulusLength: 1024, publicExponent: new Uint8Array([1, 0, 1]), hash: "SHA-256" }, true, ["sign", "verify"]);
+		const otherSig = await crypto.subtle.sign(params, other.privateKey, data);
+		const otherJwk = await crypto.subtle.exportKey("jwk", other.publicKey);
+		const jwks = { keys: [
+			{ kty: "EC", kid: "ec", crv: "P-256", x: "", y: "" },
+			Object.assign({}, privJwk, { kid: "rs", alg: "RS256", d: undefined, p: undefined, q: undefined, dp: undefined, dq: undefined, qi: undefined, key_ops: undefined }),
+			Object.assign({}, otherJwk, { kid: "old" }),
+			Object.assign({}, await crypto.subtle.exportKey("jwk", der), { kid: "new" }),
+		] };
+		const byKid = await crypto.subtle.importKey("jwk", jwks, Object.assign({ kid: "new" }, pss), false, ["verify"]);
+		const byAlg = await crypto.subtle.importKey("jwk", jwks, pss, false, ["verify"]);
+		const byHeader = await crypto.subtle.importKey("jwk", jwks, { name: "RSASSA-PKCS1-v1_5", hash: "SHA-256", kid: "rs", alg: "RS256" }, false, ["verify"]);
+		return JSON.stringify({
+			types: [priv.type, pub.type, fromJwk.type, byHeader.type],
+			algorithm: [priv.algorithm.modulusLength, priv.algorithm.publicExponent],
+			verify: [await crypto.subtle.verify(params, pub, sig, data), await crypto.subtle.verify(params, der, sig, data), await crypto.subtle.verify(params, pub, await crypto.subtle.sign(params, fromJwk, data), data)],
+			jwks: [await crypto.subtle.verify(params, byKid, sig, data), await crypto.subtle.verify(params, byAlg, otherSig, data)],
+			unknownKid: await errName(crypto.subtle.importKey("jwk", jwks, Object.assign({ kid: "gone" }, pss), false, ["verify"])),
+			wrongPEM: await errName(crypto.subtle.importKey("spki", pkcs8PEM, pss, false, ["verify"])),
+			badDER: await errName(crypto.subtle.importKey("pkcs8", spki, pss, false, ["sign"])),
+			raw: await errName(crypto.subtle.importKey("raw", spki, pss, false, ["verify"])),
+			privateVerify: await errName(crypto.subtle.importKey("pkcs8", pkcs8PEM, pss, false, ["verify"])),
+			publicSign: await errName(crypto.subtle.importKey("spki", spki, pss, false, ["sign"])),
+			wrongAlg: await errName(crypto.subtle.importKey("jwk", privJwk, { name: "RSASSA-PKCS1-v1_5", hash: "SHA-256" }, false, ["sign"])),
+		});
+	})()`, pkcs8PEM, pkcs1PEM, hex.EncodeToString(spki)))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	expected := `{"types":["private","public","private","public"],"algorithm":[1024,{"0":1,"1":0,"2":1}],"verify":[true,true,true],"jwks":[true,true],"unknownKid":"DataError","wrongPEM":"DataError","badDER":"DataError","raw":"NotSupportedError","privateVerify":"SyntaxError","publicSign":"SyntaxError","wrongAlg":"DataError"}`
+	if val.String() != expected {
+		t.Errorf("expected %s but got %s", expected, val.String())
+	}
+}
+
+func TestCryptoKey(t *testing.T) {
+	ctx, err := newV8ContextWithCrypto()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer ctx.Isolate().Dispose()
+	defer eventloop.Close(ctx)
+
+	val, err := runAsync(ctx, `
+	const errName = async (p) => { try { await p; return "none" } catch (e) { return e.name } };
+	const throws = (fn) => { try { fn(); return "none" } catch (e) { return e.name } };
+	const data = new Uint8Array([1, 2, 3]);
+	(async () => {
+		const key = await crypto.subtle.generateKey({ name: "HMAC", hash: "SHA-256" }, false, ["sign"]);
+		const pair = await crypto.subtle.generateKey({ name: "ECDSA", namedCurve: "P-256" }, false, ["sign", "verify"]);
+		const forged = { type: "secret", extractable: false, algorithm: key.algorithm, usages: ["sign"], kid: "x" };
+		key.type = "public";
+		key.algorithm.name = "AES-GCM";
+		const push = throws(() => key.usages.push("verify"));
+		return JSON.stringify({
+			instance: [key instanceof CryptoKey, pair.privateKey instanceof CryptoKey, Object.prototype.toString.call(key)],
+			slots: [key.type, key.extractable, key.algorithm.name, key.algorithm.hash.name, key.usages, key.algorithm === key.algorithm],
+			hidden: [JSON.stringify(key), Object.keys(key).length, Object.getOwnPropertyNames(key).length],
+			push,
+			pair: [pair.publicKey.type, pair.privateKey.usages],
+			construct: throws(() => new CryptoKey()),
+			getter: throws(() => Object.getOwnPropertyDescriptor(CryptoKey.prototype, "type").get.call({})),
+			forged: await errName(crypto.subtle.sign("HMAC", forged, data)),
+			prototype: await errName(crypto.subtle.sign("HMAC", Object.create(CryptoKey.prototype), data)),
+			valid: (await crypto.subtle.sign("HMAC", key, data)).byteLength,
+		});
+	})()`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	expected := `{"instance":[true,true,"[object CryptoKey]"],"slots":["secret",false,"HMAC","SHA-256",["sign"],true],"hidden":["{}",0,0],"push":"TypeError","pair":["public",["sign"]],"construct":"TypeError","getter":"TypeError","forged":"TypeError","prototype":"TypeError","valid":32}`
+	if val.String() != expected {
+		t.Errorf("expected %s but got %s", expected, val.String())
+	}
+}
+
+// countingSigner stands in for a KMS client, it only exposes crypto.Signer
+type countingSigner struct {
+	key   *ecdsa.PrivateKey
+	calls int
+}
+
+func (s *countingSigner) Public() gocrypto.PublicKey {
+	return &s.key.PublicKey
+}
+
+func (s *countingSigner) Sign(rand io.Reader, digest []byte, opts gocrypto.SignerOpts) ([]byte, error) {
+	s.calls++
+	return s.key.Sign(rand, digest, opts)
+}
+
+func TestHostKey(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	signer := &countingSigner{key: ecKey}
+	ecAlgo := &ECAlgo{Name: "ECDSA", NamedCurve: "P-256"}
+	oaep := &RSAAlgoOut{Name: "rsa-oaep", Hash: HashAlgorithmIdentifier{Name: "sha-256"}}
+
+	ctx, err := newV8ContextWithCrypto(
+		WithHostKey("signer", &HostKey{Key: signer, Algorithm: ecAlgo, Usages: []string{"sign"}}),
+		WithHostKey("verifier", &HostKey{Key: &ecKey.PublicKey, Algorithm: ecAlgo, Usages: []string{"verify"}}),
+		WithHostKey("ed", &HostKey{Key: ed25519.NewKeyFromSeed(make([]byte, 32)), Algorithm: &OKPAlgo{Name: "Ed25519"}, Usages: []string{"sign"}}),
+		WithHostKey("rsa", &HostKey{Key: rsaKey, Algorithm: oaep, Usages: []string{"decrypt"}}),
+		WithHostKey("rsaPublic", &HostKey{Key: &rsaKey.PublicKey, Algorithm: oaep, Usages: []string{"encrypt"}}),
+		WithHostKey("hmac", &HostKey{Key: []byte("Jefe"), Algorithm: &HMACAlgo{Hash: HashAlgorithmIdentifier{Name: "SHA-256"}}, Usages: []string{"sign"}}),
+	)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer ctx.Isolate().Dispose()
+	defer eventloop.Close(ctx)
+
+	val, err := runAsync(ctx, `
+	const errName = async (p) => { try { await p; return "none" } catch (e) { return e.name } };
+	const hex = (buf) => Array.from(new Uint8Array(buf)).map(b => b.toString(16).padStart(2, "0")).join("");
+	const ascii = (s) => new Uint8Array(Array.from(s).map(c => c.charCodeAt(0)));
+	const data = new Uint8Array([1, 2, 3]);
+	(async () => {
+		const sig = await crypto.subtle.sign({ name: "ECDSA", hash: "SHA-256" }, env.signer, data);
+		const ct = await crypto.subtle.encrypt("RSA-OAEP", env.rsaPublic, data);
+		return JSON.stringify({
+			keys: Object.keys(env),
+			signer: [env.signer instanceof CryptoKey, env.signer.type, env.signer.extractable, env.signer.usages],
+			verify: await crypto.subtle.verify({ name: "ECDSA", hash: "SHA-256" }, env.verifier, sig, data),
+			ed: (await crypto.subtle.sign("Ed25519", env.ed, data)).byteLength,
+			rsa: [env.rsa.algorithm.name, env.rsa.algorithm.hash.name, env.rsa.algorithm.modulusLength, hex(await crypto.subtle.decrypt("RSA-OAEP", env.rsa, ct))],
+			hmac: [env.hmac.type, env.hmac.algorithm.length, hex(await crypto.subtle.sign("HMAC", env.hmac, ascii("what do ya want for nothing?")))],
+			export: await errName(crypto.subtle.exportKey("jwk", env.signer)),
+			usage: await errName(crypto.subtle.sign({ name: "ECDSA", hash: "SHA-256" }, env.verifier, data)),
+		});
+	})()`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	expected := `{"keys":["ed","hmac","rsa","rsaPublic","signer","verifier"],"signer":[true,"private",false,["sign"]],"verify":true,"ed":64,"rsa":["RSA-OAEP","SHA-256",1024,"010203"],"hmac":["secret",32,"5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"],"export":"InvalidAccessError","usage":"InvalidAccessError"}`
+	if val.String() != expected {
+		t.Errorf("expected %s but got %s", expected, val.String())
+	}
+	if signer.calls != 1 {
+		t.Errorf("expected the signer to be called once, got %d", signer.calls)
+	}
+
+	c := NewCrypto()
+	if _, err := c.RegisterKey("mismatch", &HostKey{Key: rsaKey, Algorithm: ecAlgo, Usages: []string{"sign"}}); err == nil {
+		t.Error("expected an error registering an RSA key as ECDSA")
+	}
+	if _, err := c.RegisterKey("usage", &HostKey{Key: &ecKey.PublicKey, Algorithm: ecAlgo, Usages: []string{"sign"}}); err == nil {
+		t.Error("expected an error registering a public key for sign")
+	}
+
+	// a host key failing to inject fails every call, not only the first one
+	iso := v8go.NewIsolate()
+	defer iso.Dispose()
+	global := v8go.NewObjectTemplate(iso)
+	if err := InjectToGlobal(iso, global, WithHostKey("mismatch", &HostKey{Key: rsaKey, Algorithm: ecAlgo, Usages: []string{"sign"}})); err != nil {
+		t.Error(err)
+		return
+	}
+	failing := v8go.NewContext(iso, global)
+	defer eventloop.Close(failing)
+	for i := 0; i < 2; i++ {
+		if _, err := failing.RunScript(`crypto.randomUUID()`, "hostkey.js"); err == nil || !strings.Contains(err.Error(), `host key "mismatch"`) {
+			t.Errorf("call %d: expected the host key error but got %v", i, err)
+		}
+	}
+}
+
+func TestKeyStore(t *testing.T) {
+	iso := v8go.NewIsolate()
+	defer iso.Dispose()
+
+	now := time.Unix(1700000000, 0)
+	store := NewMemoryKeyStore(time.Minute, 2)
+	store.Now = func() time.Time { return now }
+
+	c := NewCrypto(WithKeyStore(store))
+	global := v8go.NewObjectTemplate(iso)
+	if err := InjectWithCryptoTo(iso, global, c); err != nil {
+		t.Error(err)
+		return
+	}
+
+	ctx1 := v8go.NewContext(iso, global)
+	ctx2 := v8go.NewContext(iso, global)
+	defer eventloop.Close(ctx2)
+
+	script := `
+	const generate = () => crypto.subtle.generateKey({ name: "HMAC", hash: "SHA-256" }, false, ["sign"]);
+	const sign = (key) => crypto.subtle.sign("HMAC", key, new Uint8Array(8)).then(() => "ok", (e) => e.name);
+	(async () => {
+		globalThis.first = await generate();
+		globalThis.second = await generate();
+		return sign(first);
+	})()`
+	for _, ctx := range []*v8go.Context{ctx1, ctx2} {
+		if val, err := runAsync(ctx, script); err != nil || val.String() != "ok" {
+			t.Errorf("expected ok, got %v %v", val, err)
+			return
+		}
+	}
+
+	// a key of ctx1 is unknown to ctx2
+	foreign, err := ctx1.Global().Get("first")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if err := ctx2.Global().Set("foreign", foreign); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// the third key of a context evicts the least recently used one
+	val, err := runAsync(ctx2, `
+	(async () => {
+		const results = [await sign(foreign)];
+		globalThis.third = await generate();
+		results.push(await sign(first), await sign(second), await sign(third));
+		return results.join(" ");
+	})()`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if expected := "InvalidAccessError ok InvalidAccessError ok"; val.String() != expected {
+		t.Errorf("expected %s but got %s", expected, val.String())
+	}
+
+	// keys expire after the TTL
+	now = now.Add(2 * time.Minute)
+	if n := store.Purge(); n != 4 {
+		t.Errorf("expected 4 expired keys, got %d", n)
+	}
+	if val, err := runAsync(ctx1, `sign(first)`); err != nil || val.String() != "InvalidAccessError" {
+		t.Errorf("expected InvalidAccessError, got %v %v", val, err)
+	}
+
+	// releasing a context deletes its keys
+	if _, err := runAsync(ctx1, `generate().then((key) => { globalThis.fresh = key })`); err != nil {
+		t.Error(err)
+		return
+	}
+	count := func(ctx *v8go.Context) int {
+		n := 0
+		store.Range(c.realms[ctx].namespace, func(string, *StoredKey) bool {
+			n++
+			return true
+		})
+		return n
+	}
+	if n := count(ctx1); n != 1 {
+		t.Errorf("expected 1 key in ctx1, got %d", n)
+	}
+	namespace := c.realms[ctx1].namespace
+	eventloop.Close(ctx1)
+	if _, ok := store.namespaces[namespace]; ok {
+		t.Errorf("expected the keys of ctx1 to be deleted")
+	}
+	if _, ok := c.realms[ctx1]; ok {
+		t.Errorf("expected the realm of ctx1 to be deleted")
+	}
+}
+
+func TestInjectToGlobal(t *testing.T) {
+	iso := v8go.NewIsolate()
+	defer iso.Dispose()
+
+	global := v8go.NewObjectTemplate(iso)
+	hmacKey := &HostKey{Key: []byte("Jefe"), Algorithm: &HMACAlgo{Hash: HashAlgorithmIdentifier{Name: "SHA-256"}}, Usages: []string{"sign"}}
+	if err := InjectToGlobal(iso, global, WithHostKey("hmac", hmacKey)); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// every context of the template gets its own CryptoKey class and host keys
+	for i := 0; i < 2; i++ {
+		ctx := v8go.NewContext(iso, global)
+		if err := InitContext(ctx); err != nil {
+			t.Error(err)
+			return
+		}
+
+		// read before any call into crypto
+		val, err := runAsync(ctx, `
+		const throws = (fn) => { try { fn(); return "none" } catch (e) { return e.name } };
+		const interfaces = [crypto instanceof Crypto, crypto.subtle instanceof SubtleCrypto];
+		const tags = [Object.prototype.toString.call(crypto), Object.prototype.toString.call(crypto.subtle)];
+		const host = [typeof env, env.hmac instanceof CryptoKey, env.hmac.type];
+		(async () => {
+			const key = await crypto.subtle.generateKey({ name: "AES-GCM", length: 128 }, false, ["encrypt"]);
+			return JSON.stringify({
+				interfaces: [...interfaces, key instanceof CryptoKey],
+				tags,
+				key: [key.type, key.algorithm.length],
+				host,
+				construct: [throws(() => new Crypto()), throws(() => new SubtleCrypto()), throws(() => new CryptoKey())],
+			});
+		})()`)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		expected := `{"interfaces":[true,true,true],"tags":["[object Crypto]","[object SubtleCrypto]"],"key":["secret",128],"host":["object",true,"secret"],"construct":["TypeError","TypeError","TypeError"]}`
+		if val.String() != expected {
+			t.Errorf("expected %s but got %s", expected, val.String())
+		}
+		eventloop.Close(ctx)
+	}
+}
+
+func TestInjectTo(t *testing.T) {
+	iso := v8go.NewIsolate()
+	defer iso.Dispose()
+
+	ctx := v8go.NewContext(iso)
+	defer eventloop.Close(ctx)
+
+	if err := InjectTo(ctx); err != nil {
+		t.Error(err)
+		return
+	}
+
+	val, err := runAsync(ctx, `
+	const errName = async (p) => { try { await p; return "none" } catch (e) { return e.name } };
+	const methods = ["sign", "verify", "digest", "encrypt", "decrypt", "generateKey", "importKey", "exportKey", "wrapKey", "unwrapKey", "deriveBits", "deriveKey"];
+	(async () => {
+		const key = await crypto.subtle.generateKey({ name: "HMAC", hash: "SHA-256" }, true, ["sign"]);
+		return JSON.stringify({
+			methods: methods.filter((m) => typeof crypto.subtle[m] !== "function"),
+			interfaces: [crypto instanceof Crypto, crypto.subtle instanceof SubtleCrypto, key instanceof CryptoKey],
+			signature: (await crypto.subtle.sign("HMAC", key, new Uint8Array([1]))).byteLength,
+			unsupported: await errName(crypto.subtle.digest("MD5", new Uint8Array([1]))),
+		});
+	})()`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	expected := `{"methods":[],"interfaces":[true,true,true],"signature":32,"unsupported":"NotSupportedError"}`
+	if val.String() != expected {
+		t.Errorf("expected %s but got %s", expected, val.String())
+	}
+}
+
+func TestAES(t *testing.T) {
+	ctx, err := newV8ContextWithCrypto()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer ctx.Isolate().Dispose()
+	defer eventloop.Close(ctx)
+
+	val, err := runAsync(ctx, `
+	const errName = async (p) => { try { await p; return "none" } catch (e) { return e.name } };
+	const hex = (buf) => Array.from(new Uint8Array(buf)).map(b => b.toString(16).padStart(2, "0")).join("");
+	const bytes = (h) => new Uint8Array(h.match(/../g).map(b => parseInt(b, 16)));
+	const data = new Uint8Array([104, 101, 108, 108, 111]);
+	(async () => {
+		const gcm = await crypto.subtle.generateKey({ name: "AES-GCM", length: 256 }, true, ["encrypt", "decrypt"]);
+		const iv = crypto.getRandomValues(new Uint8Array(12));
+		const aad = new Uint8Array([1, 2]);
+		const gcmCt = await crypto.subtle.encrypt({ name: "AES-GCM", iv, additionalData: aad, tagLength: 96 }, gcm, data);
+		const gcmPt = await crypto.subtle.decrypt({ name: "AES-GCM", iv, additionalData: aad, tagLength: 96 }, gcm, gcmCt);
+		const jwk = await crypto.subtle.exportKey("jwk", gcm);
+
+		const cbc = await crypto.subtle.importKey("raw", crypto.getRandomValues(new Uint8Array(16)), "AES-CBC", false, ["encrypt", "decrypt"]);
+		const cbcIv = new Uint8Array(16);
+		const cbcCt = await crypto.subtle.encrypt({ name: "AES-CBC", iv: cbcIv }, cbc, data);
+
+		const ctr = await crypto.subtle.importKey("raw", bytes("2b7e151628aed2a6abf7158809cf4f3c"), { name: "AES-CTR" }, false, ["encrypt", "decrypt"]);
+		const counter = bytes("f0f1f2f3f4f5f6f7f8f9fafbfcfdfeff");
+		const ctrCt = await crypto.subtle.encrypt({ name: "AES-CTR", counter, length: 64 }, ctr, bytes("6bc1bee22e409f96e93d7e117393172aae2d8a571e03ac9c9eb76fac45af8e51"));
+		const wrapped8 = await crypto.subtle.encrypt({ name: "AES-CTR", counter, length: 8 }, ctr, new Uint8Array(32));
+		const direct = await crypto.subtle.encrypt({ name: "AES-CTR", counter: bytes("f0f1f2f3f4f5f6f7f8f9fafbfcfdfe00"), length: 128 }, ctr, new Uint8Array(16));
+
+		const kek = await crypto.subtle.importKey("jwk", { kty: "oct", k: "AAECAwQFBgcICQoLDA0ODw", alg: "A128KW" }, "AES-KW", false, ["wrapKey", "unwrapKey"]);
+		const secret = await crypto.subtle.importKey("raw", bytes("00112233445566778899aabbccddeeff"), "AES-GCM", true, ["encrypt"]);
+		const wrapped = await crypto.subtle.wrapKey("raw", secret, kek, "AES-KW");
+		const unwrapped = await crypto.subtle.unwrapKey("raw", wrapped, kek, { name: "AES-KW" }, "AES-GCM", true, ["decrypt"]);
+
+		return JSON.stringify({
+			gcm: [gcm.type, gcm.algorithm.length, gcmCt.byteLength, hex(gcmPt)],
+			jwk: [jwk.kty, jwk.alg, jwk.key_ops.join(), jwk.ext, jwk.k.length],
+			tampered: await errName(crypto.subtle.decrypt({ name: "AES-GCM", iv, tagLength: 96 }, gcm, gcmCt)),
+			tag32: await errName(crypto.subtle.encrypt({ name: "AES-GCM", iv, tagLength: 32 }, gcm, data)),
+			cbc: [cbcCt.byteLength, hex(await crypto.subtle.decrypt({ name: "AES-CBC", iv: cbcIv }, cbc, cbcCt))],
+			cbcIv: await errName(crypto.subtle.encrypt({ name: "AES-CBC", iv: new Uint8Array(8) }, cbc, data)),
+			ctr: hex(ctrCt),
+			ctrWrap: hex(wrapped8.slice(16)) === hex(direct),
+			ctrLimit: await errName(crypto.subtle.encrypt({ name: "AES-CTR", counter, length: 1 }, ctr, new Uint8Array(48))),
+			wrapped: hex(wrapped),
+			unwrapped: [unwrapped.algorithm.name, unwrapped.usages.join(), hex(await crypto.subtle.exportKey("raw", unwrapped))],
+			corrupt: await errName(crypto.subtle.unwrapKey("raw", new Uint8Array(24), kek, "AES-KW", "AES-GCM", true, ["decrypt"])),
+			notExtractable: await errName(crypto.subtle.exportKey("raw", cbc)),
+			badLength: await errName(crypto.subtle.generateKey({ name: "AES-GCM", length: 100 }, true, ["encrypt"])),
+			badUsage: await errName(crypto.subtle.generateKey({ name: "AES-KW", length: 128 }, true, ["encrypt"])),
+			badRaw: await errName(crypto.subtle.importKey("raw", new Uint8Array(10), "AES-GCM", true, ["encrypt"])),
+			badAlg: await errName(crypto.subtle.importKey("jwk", { kty: "oct", k: "AAECAwQFBgcICQoLDA0ODw", alg: "A256GCM" }, "AES-GCM", true, ["encrypt"])),
+		});
+	})()`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	expected := `{"gcm":["secret",256,17,"68656c6c6f"],"jwk":["oct","A256GCM","encrypt,decrypt",true,43],"tampered":"OperationError","tag32":"NotSupportedError","cbc":[16,"68656c6c6f"],"cbcIv":"OperationError","ctr":"874d6191b620e3261bef6864990db6ce9806f66b7970fdff8617187bb9fffdff","ctrWrap":true,"ctrLimit":"OperationError","wrapped":"1fa68b0a8112b447aef34bd8fb5a7b829d3e862371d2cfe5","unwrapped":["AES-GCM","decrypt","00112233445566778899aabbccddeeff"],"corrupt":"OperationError","notExtractable":"InvalidAccessError","badLength":"OperationError","badUsage":"SyntaxError","badRaw":"DataError","badAlg":"DataError"}`
+	if val.String() != expected {
+		t.Errorf("expected %s but got %s", expected, val.String())
+	}
+}
+
+func TestWrapKey(t *testing.T) {
+	ctx, err := newV8ContextWithCrypto()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer ctx.Isolate().Dispose()
+	defer eventloop.Close(ctx)
+
+	val, err := runAsync(ctx, `
+	const errName = async (p) => { try { await p; return "none" } catch (e) { return e.name } };
+	const hex = (buf) => Array.from(new Uint8Array(buf)).map(b => b.toString(16).padStart(2, "0")).join("");
+	const data = new Uint8Array([104, 101, 108, 108, 111]);
+	(async () => {
+		const master = await crypto.subtle.generateKey({ name: "RSA-OAEP", modulusLength: 2048, publicExponent: new Uint8Array([1, 0, 1]), hash: "SHA-256" }, false, ["wrapKey", "unwrapKey"]);
+		const kek = await crypto.subtle.generateKey({ name: "AES-GCM", length: 256 }, false, ["wrapKey", "unwrapKey", "encrypt"]);
+		const dataKey = await crypto.subtle.generateKey({ name: "AES-GCM", length: 128 }, true, ["encrypt", "decrypt"]);
+		const ec = await crypto.subtle.generateKey({ name: "ECDSA", namedCurve: "P-256" }, true, ["sign", "verify"]);
+		const iv = crypto.getRandomValues(new Uint8Array(12));
+		const gcm = { name: "AES-GCM", iv };
+
+		const envelope = await crypto.subtle.wrapKey("raw", dataKey, master.publicKey, { name: "RSA-OAEP" });
+		const unwrapped = await crypto.subtle.unwrapKey("raw", envelope, master.privateKey, "RSA-OAEP", "AES-GCM", false, ["decrypt"]);
+		const ct = await crypto.subtle.encrypt(gcm, dataKey, data);
+
+		const jwkEnvelope = await crypto.subtle.wrapKey("jwk", dataKey, kek, gcm);
+		const fromJwk = await crypto.subtle.unwrapKey("jwk", jwkEnvelope, kek, gcm, { name: "AES-GCM" }, true, ["encrypt"]);
+
+		const pkcs8Envelope = await crypto.subtle.wrapKey("pkcs8", ec.privateKey, kek, gcm);
+		const ecKey = await crypto.subtle.unwrapKey("pkcs8", pkcs8Envelope, kek, gcm, { name: "ECDSA", namedCurve: "P-256" }, false, ["sign"]);
+		const sig = await crypto.subtle.sign({ name: "ECDSA", hash: "SHA-256" }, ecKey, data);
+
+		return JSON.stringify({
+			envelope: envelope.byteLength,
+			unwrapped: [unwrapped.type, unwrapped.extractable, unwrapped.usages, unwrapped.algorithm.length],
+			decrypt: hex(await crypto.subtle.decrypt(gcm, unwrapped, ct)),
+			jwk: [fromJwk.extractable, fromJwk.usages, hex(await crypto.subtle.exportKey("raw", fromJwk)) === hex(await crypto.subtle.exportKey("raw", dataKey))],
+			pkcs8: [ecKey.type, await crypto.subtle.verify({ name: "ECDSA", hash: "SHA-256" }, ec.publicKey, sig, data)],
+			tampered: await errName(crypto.subtle.unwrapKey("raw", envelope.slice(1), master.privateKey, "RSA-OAEP", "AES-GCM", false, ["decrypt"])),
+			wrongIv: await errName(crypto.subtle.unwrapKey("jwk", jwkEnvelope, kek, { name: "AES-GCM", iv: new Uint8Array(12) }, "AES-GCM", true, ["encrypt"])),
+			notExtractable: await errName(crypto.subtle.wrapKey("raw", unwrapped, kek, gcm)),
+			noUsage: await errName(crypto.subtle.wrapKey("raw", dataKey, master.privateKey, "RSA-OAEP")),
+			badUsages: await errName(crypto.subtle.unwrapKey("raw", envelope, master.privateKey, "RSA-OAEP", "AES-GCM", false, ["sign"])),
+		});
+	})()`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	expected := `{"envelope":256,"unwrapped":["secret",false,["decrypt"],128],"decrypt":"68656c6c6f","jwk":[true,["encrypt"],true],"pkcs8":["private",true],"tampered":"OperationError","wrongIv":"OperationError","notExtractable":"InvalidAccessError","noUsage":"InvalidAccessError","badUsages":"SyntaxError"}`
+	if val.String() != expected {
+		t.Errorf("expected %s but got %s", expected, val.String())
+	}
+}
+
+func TestHMAC(t *testing.T) {
+	ctx, err := newV8ContextWithCrypto()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer ctx.Isolate().Dispose()
+	defer eventloop.Close(ctx)
+
+	val, err := runAsync(ctx, `
+	const errName = async (p) => { try { await p; return "none" } catch (e) { return e.name } };
+	const hex = (buf) => Array.from(new Uint8Array(buf)).map(b => b.toString(16).padStart(2, "0")).join("");
+	const ascii = (s) => new Uint8Array(Array.from(s, c => c.charCodeAt(0)));
+	const data = ascii("what do ya want for nothing?");
+	(async () => {
+		const jefe = await crypto.subtle.importKey("raw", ascii("Jefe"), { name: "HMAC", hash: "SHA-256" }, true, ["sign", "verify"]);
+		const mac = await crypto.subtle.sign("HMAC", jefe, data);
+		const generated = await crypto.subtle.generateKey({ name: "HMAC", hash: { name: "SHA-512" } }, true, ["sign"]);
+		const jwk = await crypto.subtle.exportKey("jwk", generated);
+		const fromJwk = await crypto.subtle.importKey("jwk", jwk, { name: "HMAC", hash: "SHA-512" }, false, ["sign"]);
+		const macs = await Promise.all([crypto.subtle.sign("HMAC", generated, data), crypto.subtle.sign({ name: "HMAC" }, fromJwk, data)]);
+		return JSON.stringify({
+			mac: hex(mac),
+			valid: await crypto.subtle.verify("HMAC", jefe, mac, data),
+			invalid: await crypto.subtle.verify("HMAC", jefe, mac.slice(1), data),
+			algorithm: [jefe.type, jefe.algorithm.hash.name, jefe.algorithm.length, generated.algorithm.length],
+			jwk: [jwk.kty, jwk.alg, jwk.k.length],
+			roundTrip: hex(macs[0]) === hex(macs[1]),
+			raw: hex(await crypto.subtle.exportKey("raw", jefe)),
+			noHash: await errName(crypto.subtle.generateKey({ name: "HMAC" }, true, ["sign"])),
+			badUsage: await errName(crypto.subtle.importKey("raw", ascii("Jefe"), { name: "HMAC", hash: "SHA-256" }, true, ["encrypt"])),
+			badAlg: await errName(crypto.subtle.importKey("jwk", jwk, { name: "HMAC", hash: "SHA-256" }, true, ["sign"])),
+			noUsage: await errName(crypto.subtle.verify("HMAC", generated, mac, data)),
+		});
+	})()`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	expected := `{"mac":"5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843","valid":true,"invalid":false,"algorithm":["secret","SHA-256",32,1024],"jwk":["oct","HS512",171],"roundTrip":true,"raw":"4a656665","noHash":"TypeError","badUsage":"SyntaxError","badAlg":"DataError","noUsage":"InvalidAccessError"}`
+	if val.String() != expected {
+		t.Errorf("expected %s but got %s", expected, val.String())
+	}
+}
+
+func TestEC(t *testing.T) {
+	ctx, err := newV8ContextWithCrypto()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer ctx.Isolate().Dispose()
+	defer eventloop.Close(ctx)
+
+	val, err := runAsync(ctx, `
+	const errName = async (p) => { try { await p; return "none" } catch (e) { return e.name } };
+	const hex = (buf) => Array.from(new Uint8Array(buf)).map(b => b.toString(16).padStart(2, "0")).join("");
+	const ascii = (s) => new Uint8Array(Array.from(s, c => c.charCodeAt(0)));
+	const b64url = (s) => Uint8Array.from(atob(s.replace(/-/g, "+").replace(/_/g, "/")), c => c.charCodeAt(0));
+	(async () => {
+		// RFC 7515 appendix A.3
+		const es256 = { kty: "EC", crv: "P-256", x: "f83OJ3D2xF1Bg8vub9tLe1gHMzV76e8Tus9uPHvRVEU", y: "x_FEzRu9m36HLN_tue659LNpXW6pCyStikYjKIWI5a0" };
+		const rfcKey = await crypto.subtle.importKey("jwk", es256, { name: "ECDSA", namedCurve: "P-256" }, true, ["verify"]);
+		const input = ascii("eyJhbGciOiJFUzI1NiJ9.eyJpc3MiOiJqb2UiLA0KICJleHAiOjEzMDA4MTkzODAsDQogImh0dHA6Ly9leGFtcGxlLmNvbS9pc19yb290Ijp0cnVlfQ");
+		const rfcSig = b64url("DtEhU3ljbEg8L38VWAfUAqOyKAM6-Xx-F4GawxaepmXFCgfTjDxw5djxLa8ISlSApmWQxfKTUJqPP3-Kg6NU1Q");
+		const es256Params = { name: "ECDSA", hash: "SHA-256" };
+
+		const p384 = await crypto.subtle.generateKey({ name: "ECDSA", namedCurve: "P-384" }, true, ["sign", "verify"]);
+		const p384Sig = await crypto.subtle.sign({ name: "ECDSA", hash: "SHA-384" }, p384.privateKey, input);
+		const pkcs8 = await crypto.subtle.exportKey("pkcs8", p384.privateKey);
+		const spki = await crypto.subtle.exportKey("spki", p384.publicKey);
+		const imported = await crypto.subtle.importKey("pkcs8", pkcs8, { name: "ECDSA", namedCurve: "P-384" }, false, ["sign"]);
+		const importedPub = await crypto.subtle.importKey("spki", spki, { name: "ECDSA", namedCurve: "P-384" }, false, ["verify"]);
+		const p521 = await crypto.subtle.generateKey({ name: "ECDSA", namedCurve: "P-521" }, false, ["sign", "verify"]);
+		const p521Sig = await crypto.subtle.sign({ name: "ECDSA", hash: "SHA-512" }, p521.privateKey, input);
+
+		const alice = await crypto.subtle.generateKey({ name: "ECDH", namedCurve: "P-256" }, true, ["deriveBits", "deriveKey"]);
+		const bob = await crypto.subtle.generateKey({ name: "ECDH", namedCurve: "P-256" }, true, ["deriveBits"]);
+		const ab = await crypto.subtle.deriveBits({ name: "ECDH", public: bob.publicKey }, alice.privateKey, 256);
+		const ba = await crypto.subtle.deriveBits({ name: "ECDH", public: alice.publicKey }, bob.privateKey, null);
+		const aes = await crypto.subtle.deriveKey({ name: "ECDH", public: bob.publicKey }, alice.privateKey, { name: "AES-GCM", length: 128 }, true, ["encrypt"]);
+		const bobJwk = await crypto.subtle.exportKey("jwk", bob.privateKey);
+		const bobRaw = await crypto.subtle.exportKey("raw", bob.publicKey);
+
+		return JSON.stringify({
+			rfc: await crypto.subtle.verify(es256Params, rfcKey, rfcSig, input),
+			rfcTampered: await crypto.subtle.verify(es256Params, rfcKey, rfcSig, ascii("x")),
+			rfcJwk: JSON.stringify(await crypto.subtle.exportKey("jwk", rfcKey)),
+			p384: [p384Sig.byteLength, await crypto.subtle.verify({ name: "ECDSA", hash: "SHA-384" }, importedPub, p384Sig, input)],
+			p384Imported: await crypto.subtle.verify({ name: "ECDSA", hash: "SHA-384" }, p384.publicKey, await crypto.subtle.sign({ name: "ECDSA", hash: "SHA-384" }, imported, input), input),
+			p521: [p521Sig.byteLength, await crypto.subtle.verify({ name: "ECDSA", hash: "SHA-512" }, p521.publicKey, p521Sig, input)],
+			usages: [alice.publicKey.usages.length, alice.privateKey.usages.join(), p384.publicKey.usages.join(), p384.privateKey.usages.join()],
+			ecdh: [ab.byteLength, hex(ab) === hex(ba), aes.algorithm.length, (await crypto.subtle.exportKey("raw", aes)).byteLength],
+			ecdhShort: hex(await crypto.subtle.deriveBits({ name: "ECDH", public: bob.publicKey }, alice.privateKey, 12)) === hex(ab).slice(0, 3) + "0",
+			bobExport: [bobJwk.kty, bobJwk.crv, bobJwk.d.length, bobJwk.alg === undefined, bobRaw.byteLength, new Uint8Array(bobRaw)[0]],
+			noHash: await errName(crypto.subtle.sign("ECDSA", p384.privateKey, input)),
+			spkiPrivate: await errName(crypto.subtle.exportKey("spki", p384.privateKey)),
+			wrongCurve: await errName(crypto.subtle.importKey("jwk", es256, { name: "ECDSA", namedCurve: "P-384" }, true, ["verify"])),
+			badCurve: await errName(crypto.subtle.generateKey({ name: "ECDSA", namedCurve: "P-192" }, true, ["sign"])),
+			publicSign: await errName(crypto.subtle.importKey("jwk", es256, { name: "ECDSA", namedCurve: "P-256" }, true, ["sign"])),
+			ecdsaPublic: await errName(crypto.subtle.deriveBits({ name: "ECDH", public: rfcKey }, alice.privateKey, 256)),
+			tooLong: await errName(crypto.subtle.deriveBits({ name: "ECDH", public: bob.publicKey }, alice.privateKey, 512)),
+		});
+	})()`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	expected := `{"rfc":true,"rfcTampered":false,"rfcJwk":"{\"kty\":\"EC\",\"alg\":\"ES256\",\"crv\":\"P-256\",\"x\":\"f83OJ3D2xF1Bg8vub9tLe1gHMzV76e8Tus9uPHvRVEU\",\"y\":\"x_FEzRu9m36HLN_tue659LNpXW6pCyStikYjKIWI5a0\",\"key_ops\":[\"verify\"],\"ext\":true}","p384":[96,true],"p384Imported":true,"p521":[132,true],"usages":[0,"deriveBits,deriveKey","verify","sign"],"ecdh":[32,true,128,16],"ecdhShort":true,"bobExport":["EC","P-256",43,true,65,4],"noHash":"TypeError","spkiPrivate":"InvalidAccessError","wrongCurve":"DataError","badCurve":"NotSupportedError","publicSign":"SyntaxError","ecdsaPublic":"InvalidAccessError","tooLong":"OperationError"}`
+	if val.String() != expected {
+		t.Errorf("expected %s but got %s", expected, val.String())
+	}
+}
+
+func TestOKP(t *testing.T) {
+	ctx, err := newV8ContextWithCrypto()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer ctx.Isolate().Dispose()
+	defer eventloop.Close(ctx)
+
+	val, err := runAsync(ctx, `
+	const errName = async (p) => { try { await p; return "none" } catch (e) { return e.name } };
+	const hex = (buf) => Array.from(new Uint8Array(buf)).map(b => b.toString(16).padStart(2, "0")).join("");
+	const bytes = (h) => new Uint8Array(h.match(/../g).map(b => parseInt(b, 16)));
+	(async () => {
+		// RFC 8032 section 7.1, test 1
+		const edPkcs8 = bytes("302e020100300506032b657004220420" + "9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60");
+		const edPublic = bytes("d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a");
+		const ed = await crypto.subtle.importKey("pkcs8", edPkcs8, "Ed25519", true, ["sign"]);
+		const edPub = await crypto.subtle.importKey("raw", edPublic, { name: "Ed25519" }, true, ["verify"]);
+		const sig = await crypto.subtle.sign("Ed25519", ed, new Uint8Array(0));
+		const edJwk = await crypto.subtle.exportKey("jwk", ed);
+		const fromJwk = await crypto.subtle.importKey("jwk", edJwk, "Ed25519", false, ["sign"]);
+
+		const generated = await crypto.subtle.generateKey("Ed25519", false, ["sign", "verify"]);
+		const generatedSig = await crypto.subtle.sign({ name: "Ed25519" }, generated.privateKey, edPublic);
+
+		// RFC 7748 section 6.1
+		const alice = await crypto.subtle.importKey("pkcs8", bytes("302e020100300506032b656e04220420" + "77076d0a7318a57d3c16c17251b26645df4c2f87ebc0992ab177fba51db92c2a"), "X25519", true, ["deriveBits", "deriveKey"]);
+		const bob = await crypto.subtle.importKey("raw", bytes("de9edb7d7b7dc1b4d35b61c2ece435373f8343c85b78674dadfc7e146f882b4f"), "X25519", true, []);
+		const shared = await crypto.subtle.deriveBits({ name: "X25519", public: bob }, alice, 256);
+		const hmac = await crypto.subtle.deriveKey({ name: "X25519", public: bob }, alice, { name: "HMAC", hash: "SHA-256", length: 256 }, true, ["sign"]);
+		const aliceJwk = await crypto.subtle.exportKey("jwk", alice);
+		const pair = await crypto.subtle.generateKey({ name: "X25519" }, true, ["deriveBits"]);
+		const zero = await crypto.subtle.importKey("raw", new Uint8Array(32), "X25519", true, []);
+
+		return JSON.stringify({
+			sig: hex(sig),
+			valid: await crypto.subtle.verify("Ed25519", edPub, sig, new Uint8Array(0)),
+			invalid: await crypto.subtle.verify("Ed25519", edPub, sig, new Uint8Array(1)),
+			spki: hex(await crypto.subtle.exportKey("spki", edPub)),
+			edJwk: [edJwk.kty, edJwk.crv, edJwk.alg, edJwk.x === aliceJwk.x, hex(await crypto.subtle.sign("Ed25519", fromJwk, new Uint8Array(0))) === hex(sig)],
+			pkcs8: hex(await crypto.subtle.exportKey("pkcs8", ed)) === hex(edPkcs8),
+			generated: [generated.privateKey.algorithm.name, generatedSig.byteLength, await crypto.subtle.verify("Ed25519", generated.publicKey, generatedSig, edPublic)],
+			shared: hex(shared),
+			hmac: [hmac.algorithm.length, hex(await crypto.subtle.exportKey("raw", hmac)) === hex(shared)],
+			aliceJwk: [aliceJwk.kty, aliceJwk.crv, aliceJwk.x, aliceJwk.alg === undefined],
+			pair: [pair.publicKey.usages.length, pair.privateKey.usages.join()],
+			rawPrivate: await errName(crypto.subtle.exportKey("raw", alice)),
+			publicSign: await errName(crypto.subtle.importKey("raw", edPublic, "Ed25519", true, ["sign"])),
+			smallOrder: await errName(crypto.subtle.deriveBits({ name: "X25519", public: zero }, alice, 256)),
+			wrongCrv: await errName(crypto.subtle.importKey("jwk", edJwk, "X25519", true, ["deriveBits"])),
+			mismatch: await errName(crypto.subtle.importKey("jwk", Object.assign({}, edJwk, { x: aliceJwk.x }), "Ed25519", true, ["sign"])),
+		});
+	})()`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	expected := `{"sig":"e5564300c360ac729086e2cc806e828a84877f1eb8e5d974d873e065224901555fb8821590a33bacc61e39701cf9b46bd25bf5f0595bbe24655141438e7a100b","valid":true,"invalid":false,"spki":"302a300506032b6570032100d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a","edJwk":["OKP","Ed25519","EdDSA",false,true],"pkcs8":true,"generated":["Ed25519",64,true],"shared":"4a5d9d5ba4ce2de1728e3bf480350f25e07e21c947d19e3376f09b3c1e161742","hmac":[256,true],"aliceJwk":["OKP","X25519","hSDwCYkwp1R0i33ctD73Wg2_Og0mOBr066SpjqqbTmo",true],"pair":[0,"deriveBits"],"rawPrivate":"InvalidAccessError","publicSign":"SyntaxError","smallOrder":"OperationError","wrongCrv":"DataError","mismatch":"DataError"}`
+	if val.String() != expected {
+		t.Errorf("expected %s but got %s", expected, val.String())
+	}
+}
+
+func TestKDF(t *testing.T) {
+	ctx, err := newV8ContextWithCrypto(WithMaxPBKDF2Iterations(1000))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer ctx.Isolate().Dispose()
+	defer eventloop.Close(ctx)
+
+	val, err := runAsync(ctx, `
+	const errName = async (p) => { try { await p; return "none" } catch (e) { return e.name } };
+	const hex = (buf) => Array.from(new Uint8Array(buf)).map(b => b.toString(16).padStart(2, "0")).join("");
+	const bytes = (h) => new Uint8Array(h.match(/../g).map(b => parseInt(b, 16)));
+	const ascii = (s) => new Uint8Array(Array.from(s, c => c.charCodeAt(0)));
+	(async () => {
+		const password = await crypto.subtle.importKey("raw", ascii("password"), "PBKDF2", false, ["deriveBits", "deriveKey"]);
+		const pbkdf2 = (iterations) => ({ name: "PBKDF2", hash: "SHA-256", salt: ascii("salt"), iterations });
+		const aes = await crypto.subtle.deriveKey(pbkdf2(2), password, { name: "AES-GCM", length: 256 }, true, ["encrypt"]);
+
+		// RFC 5869 appendix A.1
+		const ikm = await crypto.subtle.importKey("raw", bytes("0b".repeat(22)), { name: "HKDF" }, false, ["deriveBits"]);
+		const hkdf = { name: "HKDF", hash: { name: "SHA-256" }, salt: bytes("000102030405060708090a0b0c"), info: bytes("f0f1f2f3f4f5f6f7f8f9") };
+
+		return JSON.stringify({
+			pbkdf2: hex(await crypto.subtle.deriveBits(pbkdf2(1), password, 256)),
+			deriveKey: [aes.algorithm.length, hex(await crypto.subtle.exportKey("raw", aes))],
+			hkdf: hex(await crypto.subtle.deriveBits(hkdf, ikm, 336)),
+			key: [password.type, password.extractable, password.algorithm.name],
+			capped: await errName(crypto.subtle.deriveBits(pbkdf2(1001), password, 256)),
+			cappedBlocks: [
+				hex(await crypto.subtle.deriveBits(pbkdf2(500), password, 512)).length,
+				await errName(crypto.subtle.deriveBits(pbkdf2(500), password, 520)),
+				await errName(crypto.subtle.deriveBits(pbkdf2(1), password, 2 ** 32 - 8)),
+			],
+			badLength: [
+				await errName(crypto.subtle.deriveBits(pbkdf2(1), password, 2 ** 40)),
+				await errName(crypto.subtle.deriveBits(pbkdf2(1), password, Infinity)),
+				await errName(crypto.subtle.deriveBits(pbkdf2(1), password, NaN)),
+			],
+			zero: await errName(crypto.subtle.deriveBits(pbkdf2(0), password, 256)),
+			noLength: await errName(crypto.subtle.deriveBits(pbkdf2(1), password, null)),
+			oddLength: await errName(crypto.subtle.deriveBits(hkdf, ikm, 12)),
+			tooLong: await errName(crypto.subtle.deriveBits(hkdf, ikm, 255 * 256 + 8)),
+			noSalt: await errName(crypto.subtle.deriveBits({ name: "PBKDF2", hash: "SHA-256", iterations: 1 }, password, 256)),
+			extractable: await errName(crypto.subtle.importKey("raw", ascii("password"), "PBKDF2", true, ["deriveBits"])),
+			export: await errName(crypto.subtle.exportKey("raw", password)),
+			wrongUsage: await errName(crypto.subtle.deriveKey(hkdf, ikm, { name: "AES-GCM", length: 128 }, true, ["encrypt"])),
+		});
+	})()`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	expected := `{"pbkdf2":"120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b","deriveKey":[256,"ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43"],"hkdf":"3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf34007208d5b887185865","key":["secret",false,"PBKDF2"],"capped":"OperationError","cappedBlocks":[128,"OperationError","OperationError"],"badLength":["TypeError","TypeError","TypeError"],"zero":"OperationError","noLength":"OperationError","oddLength":"OperationError","tooLong":"OperationError","noSalt":"TypeError","extractable":"SyntaxError","export":"InvalidAccessError","wrongUsage":"InvalidAccessError"}`
+	if val.String() != expected {
+		t.Errorf("expected %s but got %s", expected, val.String())
+	}
+}
+
+func TestAlgorithmNormalization(t *testing.T) {
+	ctx, err := newV8ContextWithCrypto()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer ctx.Isolate().Dispose()
+	defer eventloop.Close(ctx)
+
+	val, err := runAsync(ctx, `
+	const errName = async (p) => { try { await p; return "none" } catch (e) { return e.name } };
+	const data = new Uint8Array([1, 2, 3]);
+	(async () => {
+		const aes = await crypto.subtle.generateKey({ name: "aes-gcm", length: 128 }, false, ["encrypt"]);
+		const hmac = await crypto.subtle.importKey("raw", data, { name: "hmac", hash: "sha-256" }, false, ["sign"]);
+		return JSON.stringify({
+			names: [aes.algorithm.name, hmac.algorithm.name, hmac.algorithm.hash.name],
+			unknown: await errName(crypto.subtle.encrypt("AES-XTS", aes, data)),
+			wrongOp: await errName(crypto.subtle.encrypt("AES-KW", null, data)),
+			noGenerate: await errName(crypto.subtle.generateKey("PBKDF2", false, ["deriveBits"])),
+			noName: await errName(crypto.subtle.encrypt({}, aes, data)),
+			noLength: await errName(crypto.subtle.generateKey("AES-GCM", false, ["encrypt"])),
+			noModulus: await errName(crypto.subtle.generateKey({ name: "RSA-PSS", hash: "SHA-256" }, false, ["sign"])),
+			noHash: await errName(crypto.subtle.generateKey({ name: "RSA-PSS", modulusLength: 1024, publicExponent: new Uint8Array([1, 0, 1]) }, false, ["sign"])),
+			badHash: await errName(crypto.subtle.importKey("raw", data, { name: "HMAC", hash: "MD5" }, false, ["sign"])),
+			noCurve: await errName(crypto.subtle.generateKey("ECDSA", false, ["sign"])),
+			noSalt: await errName(crypto.subtle.sign("RSA-PSS", null, data)),
+			missingArgs: await errName(crypto.subtle.importKey("raw", data)),
+			wrongKey: await errName(crypto.subtle.sign("HMAC", aes, data)),
+		});
+	})()`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	expected := `{"names":["AES-GCM","HMAC","SHA-256"],"unknown":"NotSupportedError","wrongOp":"NotSupportedError","noGenerate":"NotSupportedError","noName":"TypeError","noLength":"TypeError","noModulus":"TypeError","noHash":"TypeError","badHash":"NotSupportedError","noCurve":"TypeError","noSalt":"TypeError","missingArgs":"TypeError","wrongKey":"InvalidAccessError"}`
+	if val.String() != expected {
+		t.Errorf("expected %s but got %s", expected, val.String())
+	}
+}
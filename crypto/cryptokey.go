@@ -0,0 +1,253 @@
+/*
+ * Copyright (c) 2021 Twintag
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package crypto
+
+import (
+	_ "embed"
+	"fmt"
+
+	"github.com/esoptra/v8go"
+	"github.com/esoptra/v8go-polyfills/eventloop"
+	"github.com/esoptra/v8go-polyfills/uuid"
+)
+
+//go:embed cryptokey.js
+var cryptoKeyClass string
+
+// CryptoKey objects carry the Kid in an internal field, scripts can neither read
+// it nor create objects with internal fields
+const (
+	cryptoKeyFieldCount = 1
+	cryptoKeyKidField   = 0
+)
+
+// cryptoKeyRealm creates the CryptoKey objects of a context
+type cryptoKeyRealm struct {
+	// namespace holds the keys of the context in the KeyStore
+	namespace string
+	template  *v8go.ObjectTemplate
+	wrap      *v8go.Function
+}
+
+// illegalConstructor is the constructor of the Crypto, SubtleCrypto and
+// CryptoKey interfaces, scripts only get instances from the polyfill
+func illegalConstructor(iso *v8go.Isolate) *v8go.FunctionTemplate {
+	return v8go.NewFunctionTemplate(iso, func(info *v8go.FunctionCallbackInfo) *v8go.Value {
+		return iso.ThrowException(newTypeError(info.Context(), "Illegal constructor"))
+	})
+}
+
+// newFunctionTemplate sets up the realm of the calling context before running cb,
+// contexts created from a global template are initialized on their first call
+func (c *Crypto) newFunctionTemplate(iso *v8go.Isolate, cb v8go.FunctionCallback) *v8go.FunctionTemplate {
+	return v8go.NewFunctionTemplate(iso, func(info *v8go.FunctionCallbackInfo) *v8go.Value {
+		if _, err := c.realmFor(info.Context()); err != nil {
+			strErr, _ := v8go.NewValue(iso, err.Error())
+			return iso.ThrowException(strErr)
+		}
+		return cb(info)
+	})
+}
+
+// realmFor returns the realm of ctx, initializing it on first use. The realm
+// and the keys of ctx are released when ctx is closed with eventloop.Close.
+func (c *Crypto) realmFor(ctx *v8go.Context) (*cryptoKeyRealm, error) {
+	realm, created, err := c.loadRealm(ctx)
+	if created {
+		// outside of realmsMu, OnClose runs at once for a closing context
+		eventloop.For(ctx).OnClose(func() {
+			c.ReleaseContext(ctx)
+		})
+	}
+	return realm, err
+}
+
+// loadRealm returns the realm of ctx, created reports a new one
+func (c *Crypto) loadRealm(ctx *v8go.Context) (realm *cryptoKeyRealm, created bool, err error) {
+	c.realmsMu.Lock()
+	defer c.realmsMu.Unlock()
+
+	if realm, ok := c.realms[ctx]; ok {
+		return realm, false, nil
+	}
+
+	realm, err = c.newRealm(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	// a realm without its host keys is not kept, every call reports the error
+	if err := c.injectHostKeys(ctx, realm); err != nil {
+		return nil, false, err
+	}
+
+	if c.realms == nil {
+		c.realms = make(map[*v8go.Context]*cryptoKeyRealm)
+	}
+	c.realms[ctx] = realm
+
+	return realm, true, nil
+}
+
+// ReleaseContext deletes the realm and the keys of ctx from the KeyStore.
+// eventloop.Close calls it, hosts closing ctx otherwise call it first.
+func (c *Crypto) ReleaseContext(ctx *v8go.Context) {
+	c.realmsMu.Lock()
+	realm, ok := c.realms[ctx]
+	delete(c.realms, ctx)
+	c.realmsMu.Unlock()
+	if !ok {
+		return
+	}
+
+	var kids []string
+	c.KeyStore.Range(realm.namespace, func(kid string, _ *StoredKey) bool {
+		kids = append(kids, kid)
+		return true
+	})
+	for _, kid := range kids {
+		c.KeyStore.Delete(realm.namespace, kid)
+	}
+}
+
+// newRealm defines the CryptoKey accessors and the prototypes of the crypto
+// objects. Keys the script drops are deleted from the KeyStore when the engine
+// runs the FinalizationRegistry cleanup.
+func (c *Crypto) newRealm(ctx *v8go.Context) (*cryptoKeyRealm, error) {
+	iso := ctx.Isolate()
+	global := ctx.Global()
+	namespace := uuid.NewUuid()
+
+	releaseFn := v8go.NewFunctionTemplate(iso, func(info *v8go.FunctionCallbackInfo) *v8go.Value {
+		if args := info.Args(); len(args) > 0 {
+			c.KeyStore.Delete(namespace, args[0].String())
+		}
+		return nil
+	})
+
+	args := []v8go.Valuer{releaseFn.GetFunction(ctx)}
+	for _, name := range []string{"CryptoKey", "Crypto", "SubtleCrypto", "crypto"} {
+		v, err := global.Get(name)
+		if err != nil {
+			return nil, fmt.Errorf("v8go-polyfills/crypto: %w", err)
+		}
+		args = append(args, v)
+	}
+
+	factory, err := ctx.RunScript(cryptoKeyClass, "cryptokey.js")
+	if err != nil {
+		return nil, fmt.Errorf("v8go-polyfills/crypto: %w", err)
+	}
+	factoryFn, err := factory.AsFunction()
+	if err != nil {
+		return nil, fmt.Errorf("v8go-polyfills/crypto: %w", err)
+	}
+	wrap, err := factoryFn.Call(v8go.Undefined(iso), args...)
+	if err != nil {
+		return nil, fmt.Errorf("v8go-polyfills/crypto: %w", err)
+	}
+	wrapFn, err := wrap.AsFunction()
+	if err != nil {
+		return nil, fmt.Errorf("v8go-polyfills/crypto: %w", err)
+	}
+
+	tmpl := v8go.NewObjectTemplate(iso)
+	tmpl.SetInternalFieldCount(cryptoKeyFieldCount)
+
+	return &cryptoKeyRealm{namespace: namespace, template: tmpl, wrap: wrapFn}, nil
+}
+
+// newCryptoKeyValue creates the script object of a CryptoKey, the material of
+// a new key is put in the namespace of ctx
+func (c *Crypto) newCryptoKeyValue(ctx *v8go.Context, key *CryptoKey) (*v8go.Value, error) {
+	realm, err := c.realmFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if key.key != nil {
+		if err := c.KeyStore.Put(realm.namespace, key.Kid, &StoredKey{Key: key.key, CryptoKey: key}); err != nil {
+			return nil, err
+		}
+		key.key = nil
+	}
+
+	return realm.newCryptoKeyValue(ctx, key)
+}
+
+func (realm *cryptoKeyRealm) newCryptoKeyValue(ctx *v8go.Context, key *CryptoKey) (*v8go.Value, error) {
+	obj, err := realm.template.NewInstance(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := obj.SetInternalField(cryptoKeyKidField, key.Kid); err != nil {
+		return nil, err
+	}
+
+	kid, err := v8go.NewValue(ctx.Isolate(), key.Kid)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := newJSONValue(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	// release the handles held by the context so only the script keeps the
+	// key reachable
+	defer obj.Value.Release()
+	defer kid.Release()
+	defer meta.Release()
+
+	return realm.wrap.Call(v8go.Undefined(ctx.Isolate()), obj, kid, meta)
+}
+
+// newKeyResultValue creates the script value of a *CryptoKey or *CryptoKeyPair,
+// key pairs are plain dictionaries
+func (c *Crypto) newKeyResultValue(ctx *v8go.Context, result interface{}) (*v8go.Value, error) {
+	switch r := result.(type) {
+	case *CryptoKey:
+		return c.newCryptoKeyValue(ctx, r)
+	case *CryptoKeyPair:
+		publicKey, err := c.newCryptoKeyValue(ctx, r.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		privateKey, err := c.newCryptoKeyValue(ctx, r.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+
+		pair, err := v8go.NewObjectTemplate(ctx.Isolate()).NewInstance(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if err := pair.Set("publicKey", publicKey); err != nil {
+			return nil, err
+		}
+		if err := pair.Set("privateKey", privateKey); err != nil {
+			return nil, err
+		}
+		return pair.Value, nil
+	default:
+		return nil, fmt.Errorf("unexpected key result %T", result)
+	}
+}
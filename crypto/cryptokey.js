@@ -0,0 +1,61 @@
+(function (release, CryptoKey, Crypto, SubtleCrypto, crypto) {
+  const slots = new WeakMap();
+  const registry = typeof FinalizationRegistry === "function" ? new FinalizationRegistry(release) : undefined;
+
+  const slot = (key) => {
+    const s = slots.get(key);
+    if (!s) {
+      throw new TypeError("Illegal invocation");
+    }
+    return s;
+  };
+
+  const freeze = (o) => {
+    if (o && typeof o === "object") {
+      Object.values(o).forEach(freeze);
+      Object.freeze(o);
+    }
+    return o;
+  };
+
+  const tag = (ctor, name) => {
+    if (typeof ctor === "function") {
+      Object.defineProperty(ctor.prototype, Symbol.toStringTag, { value: name, configurable: true });
+    }
+  };
+
+  ["type", "extractable", "algorithm", "usages"].forEach((name) => {
+    Object.defineProperty(CryptoKey.prototype, name, {
+      get() {
+        return slot(this)[name];
+      },
+      enumerable: true,
+      configurable: true,
+    });
+  });
+  tag(CryptoKey, "CryptoKey");
+  tag(Crypto, "Crypto");
+  tag(SubtleCrypto, "SubtleCrypto");
+
+  if (typeof Crypto === "function" && crypto) {
+    Object.setPrototypeOf(crypto, Crypto.prototype);
+  }
+  if (typeof SubtleCrypto === "function" && crypto && crypto.subtle) {
+    Object.setPrototypeOf(crypto.subtle, SubtleCrypto.prototype);
+  }
+
+  // wrap turns an object with the kid internal field into a CryptoKey
+  return (obj, kid, meta) => {
+    Object.setPrototypeOf(obj, CryptoKey.prototype);
+    slots.set(obj, freeze({
+      type: meta.type,
+      extractable: meta.extractable,
+      algorithm: meta.algorithm,
+      usages: meta.usages,
+    }));
+    if (registry) {
+      registry.register(obj, kid);
+    }
+    return obj;
+  };
+})
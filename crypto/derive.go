@@ -0,0 +1,298 @@
+/*
+ * Copyright (c) 2021 Twintag
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package crypto
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/esoptra/v8go"
+	"github.com/esoptra/v8go-polyfills/domexception"
+	"github.com/esoptra/v8go-polyfills/eventloop"
+)
+
+// deriveParams holds the algorithm parameters of deriveBits and deriveKey
+type deriveParams struct {
+	Name       string
+	Public     *cryptoKeyArg // ECDH and X25519
+	PublicRaw  interface{}
+	Hash       HashAlgorithmIdentifier // PBKDF2 and HKDF
+	Salt       []byte                  // PBKDF2 and HKDF
+	Info       []byte                  // HKDF
+	Iterations int                     // PBKDF2
+}
+
+func (c *Crypto) getDeriveParams(ctx *v8go.Context, v *v8go.Value) (*deriveParams, error) {
+	canonical, err := normalizeAlgorithm(v, "deriveBits")
+	if err != nil {
+		return nil, err
+	}
+	params := &deriveParams{Name: canonical}
+
+	if !v.IsObject() {
+		return params, nil
+	}
+	obj, err := v.AsObject()
+	if err != nil {
+		return nil, newCryptoError(typeError, "%v", err)
+	}
+
+	switch params.Name {
+	case string(ECDH), string(X25519):
+		if !obj.Has("public") {
+			return nil, newCryptoError(typeError, "%s params: public is required", params.Name)
+		}
+		public, err := obj.Get("public")
+		if err != nil {
+			return nil, newCryptoError(typeError, "%v", err)
+		}
+		if params.Public, params.PublicRaw, err = c.getCryptoKey(ctx, public); err != nil {
+			return nil, err
+		}
+		if params.Public.Type != "public" {
+			return nil, newCryptoError(domexception.InvalidAccessError, "%s params: public must be a public key", params.Name)
+		}
+		if !strings.EqualFold(params.Public.Algorithm.Name, params.Name) {
+			return nil, newCryptoError(domexception.InvalidAccessError, "%s params: public is a %s key", params.Name, params.Public.Algorithm.Name)
+		}
+	case string(PBKDF2), string(HKDF):
+		if err := getKDFParams(obj, params); err != nil {
+			return nil, err
+		}
+	}
+
+	return params, nil
+}
+
+// truncateBits keeps the first length bits of secret, all of them when length is negative
+func truncateBits(secret []byte, length int) ([]byte, error) {
+	if length < 0 {
+		return secret, nil
+	}
+	if length > len(secret)*8 {
+		return nil, newCryptoError(domexception.OperationError, "length %d exceeds the %d derived bits", length, len(secret)*8)
+	}
+
+	out := make([]byte, (length+7)/8)
+	copy(out, secret)
+	if rem := length % 8; rem != 0 {
+		out[len(out)-1] &= byte(0xff << uint(8-rem))
+	}
+	return out, nil
+}
+
+// deriveBits derives length bits, or all the bits the algorithm can produce when length is negative
+func (c *Crypto) deriveBits(params *deriveParams, key *cryptoKeyArg, raw interface{}, length int) ([]byte, error) {
+	var (
+		secret []byte
+		err    error
+	)
+
+	switch params.Name {
+	case string(ECDH):
+		secret, err = ecdhDeriveBits(params, raw)
+	case string(X25519):
+		secret, err = x25519DeriveBits(params, raw)
+	case string(PBKDF2):
+		secret, err = pbkdf2DeriveBits(params, raw, length, c.MaxPBKDF2Iterations)
+	case string(HKDF):
+		secret, err = hkdfDeriveBits(params, raw, length)
+	default:
+		return nil, newCryptoError(domexception.NotSupportedError, "%s can't be used to derive bits", params.Name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return truncateBits(secret, length)
+}
+
+// derivedKeyLength returns the length in bits of the key deriveKey creates for algorithm
+func derivedKeyLength(algorithm interface{}) (int, error) {
+	switch algo := algorithm.(type) {
+	case *AESAlgo:
+		switch algo.Length {
+		case 128, 192, 256:
+			return algo.Length, nil
+		default:
+			return 0, newCryptoError(domexception.OperationError, "AES key length must be 128, 192 or 256 bits, got %d", algo.Length)
+		}
+	case *HMACAlgo:
+		if algo.Length != 0 {
+			return algo.Length, nil
+		}
+		return hmacHashLength(algo.Hash.Name)
+	default:
+		return 0, newCryptoError(domexception.NotSupportedError, "deriving %T keys is not supported", algorithm)
+	}
+}
+
+// getDeriveArgs validates the algorithm and base key arguments shared by deriveBits and deriveKey
+func (c *Crypto) getDeriveArgs(ctx *v8go.Context, args []*v8go.Value, usage string) (*deriveParams, *cryptoKeyArg, interface{}, error) {
+	params, err := c.getDeriveParams(ctx, args[0])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	key, raw, err := c.getCryptoKey(ctx, args[1])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if err := key.checkUsage(params.Name, usage); err != nil {
+		return nil, nil, nil, err
+	}
+
+	return params, key, raw, nil
+}
+
+// cryptoDeriveBitsFunctionCallback implements https://developer.mozilla.org/en-US/docs/Web/API/SubtleCrypto/deriveBits
+// const result = crypto.subtle.deriveBits(algorithm, baseKey, length);
+// result is a Promise that fulfills with an ArrayBuffer containing the derived bits.
+func (c *Crypto) cryptoDeriveBitsFunctionCallback() v8go.FunctionCallback {
+	return func(info *v8go.FunctionCallbackInfo) *v8go.Value {
+		ctx := info.Context()
+		iso := ctx.Isolate()
+		resolver, err := v8go.NewPromiseResolver(ctx)
+		if err != nil {
+			strErr, _ := v8go.NewValue(iso, fmt.Sprintf("error creating newPromiseResolver with ctx: %#v", err))
+			return iso.ThrowException(strErr)
+		}
+
+		args := info.Args()
+		if len(args) < 2 {
+			resolver.Reject(newTypeError(ctx, "Failed to execute 'deriveBits': 2 arguments required, but only %d present", len(args)))
+			return resolver.GetPromise().Value
+		}
+
+		params, key, raw, err := c.getDeriveArgs(ctx, args, "deriveBits")
+		if err != nil {
+			resolver.Reject(rejectValue(ctx, "deriveBits", err))
+			return resolver.GetPromise().Value
+		}
+
+		length := -1
+		if len(args) > 2 && !args[2].IsNullOrUndefined() {
+			// length is an unsigned long
+			if !args[2].IsNumber() || math.IsNaN(args[2].Number()) || args[2].Number() < 0 || args[2].Number() > math.MaxUint32 {
+				resolver.Reject(newTypeError(ctx, "Failed to execute 'deriveBits': expected length as a positive number or null"))
+				return resolver.GetPromise().Value
+			}
+			length = int(args[2].Number())
+		}
+
+		eventloop.For(ctx).Go(func() func() {
+			bits, err := c.deriveBits(params, key, raw, length)
+			return func() {
+				if err != nil {
+					resolver.Reject(rejectValue(ctx, "deriveBits", err))
+					return
+				}
+
+				v, err := newArrayBuffer(ctx, bits)
+				if err != nil {
+					resolver.Reject(rejectValue(ctx, "deriveBits", err))
+					return
+				}
+				resolver.Resolve(v)
+			}
+		})
+
+		return resolver.GetPromise().Value
+	}
+}
+
+// cryptoDeriveKeyFunctionCallback implements https://developer.mozilla.org/en-US/docs/Web/API/SubtleCrypto/deriveKey
+// const result = crypto.subtle.deriveKey(algorithm, baseKey, derivedKeyAlgorithm, extractable, keyUsages);
+// result is a Promise that fulfills with the derived key as a CryptoKey object.
+func (c *Crypto) cryptoDeriveKeyFunctionCallback() v8go.FunctionCallback {
+	return func(info *v8go.FunctionCallbackInfo) *v8go.Value {
+		ctx := info.Context()
+		iso := ctx.Isolate()
+		resolver, err := v8go.NewPromiseResolver(ctx)
+		if err != nil {
+			strErr, _ := v8go.NewValue(iso, fmt.Sprintf("error creating newPromiseResolver with ctx: %#v", err))
+			return iso.ThrowException(strErr)
+		}
+
+		args := info.Args()
+		if len(args) < 5 {
+			resolver.Reject(newTypeError(ctx, "Failed to execute 'deriveKey': 5 arguments required, but only %d present", len(args)))
+			return resolver.GetPromise().Value
+		}
+
+		params, key, raw, err := c.getDeriveArgs(ctx, args, "deriveKey")
+		if err != nil {
+			resolver.Reject(rejectValue(ctx, "deriveKey", err))
+			return resolver.GetPromise().Value
+		}
+
+		var length int
+		algorithm, _, err := getAlgorithm(args[2], "get key length")
+		if err == nil {
+			length, err = derivedKeyLength(algorithm)
+		}
+		if err != nil {
+			resolver.Reject(rejectValue(ctx, "deriveKey", err))
+			return resolver.GetPromise().Value
+		}
+
+		extractable := args[3] //boolean
+		if !extractable.IsBoolean() {
+			resolver.Reject(newTypeError(ctx, "Failed to execute 'deriveKey': expected extractable argument as boolean type"))
+			return resolver.GetPromise().Value
+		}
+
+		keyUsages, err := getKeyUsages(args[4])
+		if err != nil {
+			resolver.Reject(rejectValue(ctx, "deriveKey", err))
+			return resolver.GetPromise().Value
+		}
+
+		isExtractable := extractable.Boolean()
+		eventloop.For(ctx).Go(func() func() {
+			bits, err := c.deriveBits(params, key, raw, length)
+			var derived *CryptoKey
+			if err == nil {
+				derived, err = c.importKey("raw", bits, algorithm, isExtractable, keyUsages)
+			}
+
+			return func() {
+				if err != nil {
+					resolver.Reject(rejectValue(ctx, "deriveKey", err))
+					return
+				}
+
+				v, err := c.newCryptoKeyValue(ctx, derived)
+				if err != nil {
+					resolver.Reject(rejectValue(ctx, "deriveKey", err))
+					return
+				}
+				resolver.Resolve(v)
+			}
+		})
+
+		return resolver.GetPromise().Value
+	}
+}
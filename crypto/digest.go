@@ -0,0 +1,87 @@
+/*
+ * Copyright (c) 2021 Twintag
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package crypto
+
+import (
+	"fmt"
+
+	"github.com/esoptra/v8go"
+	"github.com/esoptra/v8go-polyfills/domexception"
+	"github.com/esoptra/v8go-polyfills/eventloop"
+)
+
+// cryptoDigestFunctionCallback implements https://developer.mozilla.org/en-US/docs/Web/API/SubtleCrypto/digest
+// const digest = crypto.subtle.digest(algorithm, data);
+// digest is a Promise that fulfills with an ArrayBuffer containing the digest.
+func (c *Crypto) cryptoDigestFunctionCallback() v8go.FunctionCallback {
+	return func(info *v8go.FunctionCallbackInfo) *v8go.Value {
+		ctx := info.Context()
+		iso := ctx.Isolate()
+		resolver, err := v8go.NewPromiseResolver(ctx)
+		if err != nil {
+			strErr, _ := v8go.NewValue(iso, fmt.Sprintf("error creating newPromiseResolver with ctx: %#v", err))
+			return iso.ThrowException(strErr)
+		}
+
+		args := info.Args()
+		if len(args) < 2 {
+			resolver.Reject(newTypeError(ctx, "Failed to execute 'digest': 2 arguments required, but only %d present", len(args)))
+			return resolver.GetPromise().Value
+		}
+
+		name, err := getAlgorithmName(args[0])
+		if err != nil {
+			resolver.Reject(newTypeError(ctx, "Failed to execute 'digest': %v", err))
+			return resolver.GetPromise().Value
+		}
+		hash, _, err := getHash(name)
+		if err != nil {
+			resolver.Reject(newDOMException(ctx, domexception.NotSupportedError, "Failed to execute 'digest': %v", err))
+			return resolver.GetPromise().Value
+		}
+
+		// the data is copied before returning, later changes by the script don't apply
+		data, err := getBufferSource(args[1])
+		if err != nil {
+			resolver.Reject(newTypeError(ctx, "Failed to execute 'digest': %v", err))
+			return resolver.GetPromise().Value
+		}
+
+		eventloop.For(ctx).Go(func() func() {
+			hasher := hash.New()
+			_, _ = hasher.Write(data)
+			sum := hasher.Sum(nil)
+
+			return func() {
+				v, err := newArrayBuffer(ctx, sum)
+				if err != nil {
+					resolver.Reject(newDOMException(ctx, domexception.OperationError, "error creating digest buffer: %v", err))
+					return
+				}
+				resolver.Resolve(v)
+			}
+		})
+
+		return resolver.GetPromise().Value
+	}
+}
@@ -0,0 +1,348 @@
+/*
+ * Copyright (c) 2021 Twintag
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package crypto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/esoptra/v8go-polyfills/domexception"
+)
+
+// curves maps the WebCrypto named curves to their Go implementation
+var curves = map[string]elliptic.Curve{
+	"P-256": elliptic.P256(),
+	"P-384": elliptic.P384(),
+	"P-521": elliptic.P521(),
+}
+
+// ecdsaJWKAlgs maps the named curves to the jwk "alg" of ECDSA keys
+var ecdsaJWKAlgs = map[string]string{
+	"P-256": "ES256",
+	"P-384": "ES384",
+	"P-521": "ES512",
+}
+
+func getCurve(name string) (elliptic.Curve, error) {
+	curve, ok := curves[name]
+	if !ok {
+		return nil, newCryptoError(domexception.NotSupportedError, "named curve %q is not supported", name)
+	}
+	return curve, nil
+}
+
+// curveSize returns the byte length of the coordinates and scalars of curve
+func curveSize(curve elliptic.Curve) int {
+	return (curve.Params().BitSize + 7) / 8
+}
+
+// ecUsages returns the usages valid for the public and private keys of an EC algorithm
+func ecUsages(name string) (public []string, private []string) {
+	if name == string(ECDH) {
+		return []string{}, []string{"deriveKey", "deriveBits"}
+	}
+	return []string{"verify"}, []string{"sign"}
+}
+
+func (c *Crypto) generateECKeyPair(algorithm *ECAlgo, extractable bool, usages []string) (*CryptoKeyPair, error) {
+	curve, err := getCurve(algorithm.NamedCurve)
+	if err != nil {
+		return nil, err
+	}
+
+	public, private := ecUsages(algorithm.Name)
+	if err := checkKeyPairUsages(algorithm.Name, usages, public, private); err != nil {
+		return nil, err
+	}
+
+	privateKey, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return newCryptoKeyPair(privateKey, &privateKey.PublicKey, algorithm, extractable, usages), nil
+}
+
+func importECKey(format string, keyData []byte, algorithm *ECAlgo, extractable bool, usages []string) (interface{}, string, error) {
+	curve, err := getCurve(algorithm.NamedCurve)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var key interface{}
+	switch format {
+	case "spki":
+		pub, err := x509.ParsePKIXPublicKey(keyData)
+		if err != nil {
+			return nil, "", newCryptoError(domexception.DataError, "invalid spki: %v", err)
+		}
+		key = pub
+	case "pkcs8":
+		priv, err := x509.ParsePKCS8PrivateKey(keyData)
+		if err != nil {
+			return nil, "", newCryptoError(domexception.DataError, "invalid pkcs8: %v", err)
+		}
+		key = priv
+	case "raw":
+		x, y := elliptic.Unmarshal(curve, keyData)
+		if x == nil {
+			x, y = elliptic.UnmarshalCompressed(curve, keyData)
+		}
+		if x == nil {
+			return nil, "", newCryptoError(domexception.DataError, "invalid %s point", algorithm.NamedCurve)
+		}
+		key = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+	case "jwk":
+		use := "sig"
+		if algorithm.Name == string(ECDH) {
+			use = "enc"
+		}
+		if key, err = parseECJWK(keyData, curve, algorithm, use, extractable, usages); err != nil {
+			return nil, "", err
+		}
+	default:
+		return nil, "", newCryptoError(domexception.NotSupportedError, "format %q not supported for %s keys", format, algorithm.Name)
+	}
+
+	public, private := ecUsages(algorithm.Name)
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		if k.Curve.Params().Name != curve.Params().Name {
+			return nil, "", newCryptoError(domexception.DataError, "key curve %s does not match %s", k.Curve.Params().Name, algorithm.NamedCurve)
+		}
+		if err := checkUsagesAllowed(algorithm.Name, usages, public); err != nil {
+			return nil, "", err
+		}
+		return k, "public", nil
+	case *ecdsa.PrivateKey:
+		if k.Curve.Params().Name != curve.Params().Name {
+			return nil, "", newCryptoError(domexception.DataError, "key curve %s does not match %s", k.Curve.Params().Name, algorithm.NamedCurve)
+		}
+		if err := checkKeyUsages(algorithm.Name, usages, private...); err != nil {
+			return nil, "", err
+		}
+		return k, "private", nil
+	default:
+		return nil, "", newCryptoError(domexception.DataError, "expected an EC key, got %T", key)
+	}
+}
+
+// decodeJWKInt decodes a base64url coordinate or scalar of size bytes
+func decodeJWKInt(name string, s string, size int) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) != size {
+		return nil, newCryptoError(domexception.DataError, "invalid jwk %s", name)
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func parseECJWK(keyData []byte, curve elliptic.Curve, algorithm *ECAlgo, use string, extractable bool, usages []string) (interface{}, error) {
+	jwk := &jsonWebKey{}
+	if err := json.Unmarshal(keyData, jwk); err != nil {
+		return nil, newCryptoError(domexception.DataError, "invalid jwk: %v", err)
+	}
+	if jwk.Kty != "EC" {
+		return nil, newCryptoError(domexception.DataError, "expected jwk kty \"EC\", got %q", jwk.Kty)
+	}
+	if jwk.Crv != algorithm.NamedCurve {
+		return nil, newCryptoError(domexception.DataError, "jwk crv %q does not match %s", jwk.Crv, algorithm.NamedCurve)
+	}
+	if algorithm.Name == string(ECDSA) && jwk.Alg != "" && jwk.Alg != ecdsaJWKAlgs[jwk.Crv] {
+		return nil, newCryptoError(domexception.DataError, "jwk alg %q does not match the %s curve", jwk.Alg, jwk.Crv)
+	}
+	if err := jwk.checkImport(use, extractable, usages); err != nil {
+		return nil, err
+	}
+
+	size := curveSize(curve)
+	x, err := decodeJWKInt("x", jwk.X, size)
+	if err != nil {
+		return nil, err
+	}
+	y, err := decodeJWKInt("y", jwk.Y, size)
+	if err != nil {
+		return nil, err
+	}
+	if !curve.IsOnCurve(x, y) {
+		return nil, newCryptoError(domexception.DataError, "jwk point is not on the %s curve", jwk.Crv)
+	}
+
+	pub := ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+	if jwk.D == "" {
+		return &pub, nil
+	}
+
+	d, err := decodeJWKInt("d", jwk.D, size)
+	if err != nil {
+		return nil, err
+	}
+	if d.Sign() <= 0 || d.Cmp(curve.Params().N) >= 0 {
+		return nil, newCryptoError(domexception.DataError, "invalid jwk d")
+	}
+	if px, py := curve.ScalarBaseMult(d.Bytes()); px.Cmp(x) != 0 || py.Cmp(y) != 0 {
+		return nil, newCryptoError(domexception.DataError, "jwk d does not match its public point")
+	}
+
+	return &ecdsa.PrivateKey{PublicKey: pub, D: d}, nil
+}
+
+func exportECKey(format string, key *cryptoKeyArg, raw interface{}) ([]byte, error) {
+	var pub *ecdsa.PublicKey
+	priv, isPrivate := raw.(*ecdsa.PrivateKey)
+	if isPrivate {
+		pub = &priv.PublicKey
+	} else if pub, _ = raw.(*ecdsa.PublicKey); pub == nil {
+		return nil, newCryptoError(domexception.InvalidAccessError, "expected an EC key, got %T", raw)
+	}
+
+	switch format {
+	case "spki":
+		if isPrivate {
+			return nil, newCryptoError(domexception.InvalidAccessError, "spki exports public keys only")
+		}
+		return x509.MarshalPKIXPublicKey(pub)
+	case "pkcs8":
+		if !isPrivate {
+			return nil, newCryptoError(domexception.InvalidAccessError, "pkcs8 exports private keys only")
+		}
+		return x509.MarshalPKCS8PrivateKey(priv)
+	case "raw":
+		if isPrivate {
+			return nil, newCryptoError(domexception.InvalidAccessError, "raw exports public keys only")
+		}
+		return elliptic.Marshal(pub.Curve, pub.X, pub.Y), nil
+	case "jwk":
+		size := curveSize(pub.Curve)
+		crv := pub.Curve.Params().Name
+		jwk := &jsonWebKey{
+			Kty:    "EC",
+			Crv:    crv,
+			X:      base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, size))),
+			Y:      base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, size))),
+			KeyOps: key.Usages,
+			Ext:    &key.Extractable,
+		}
+		if key.Algorithm.Name == string(ECDSA) {
+			jwk.Alg = ecdsaJWKAlgs[crv]
+		}
+		if isPrivate {
+			jwk.D = base64.RawURLEncoding.EncodeToString(priv.D.FillBytes(make([]byte, size)))
+		}
+		return json.Marshal(jwk)
+	default:
+		return nil, newCryptoError(domexception.NotSupportedError, "format %q not supported for %s keys", format, key.Algorithm.Name)
+	}
+}
+
+// ecdsaHash hashes data with the hash of the EcdsaParams
+func ecdsaHash(params *signParams, data []byte) ([]byte, crypto.Hash, error) {
+	hash, _, err := getHash(params.Hash.Name)
+	if err != nil {
+		return nil, 0, newCryptoError(domexception.NotSupportedError, "%v", err)
+	}
+
+	hasher := hash.New()
+	_, _ = hasher.Write(data)
+	return hasher.Sum(nil), hash, nil
+}
+
+// ecdsaSign signs with a *ecdsa.PrivateKey or any crypto.Signer of an EC key,
+// converting the ASN.1 signature of the signer to the WebCrypto r || s form
+func ecdsaSign(params *signParams, raw interface{}, data []byte) ([]byte, error) {
+	signer, ok := raw.(crypto.Signer)
+	if !ok {
+		return nil, newCryptoError(domexception.InvalidAccessError, "expected an EC private key, got %T", raw)
+	}
+	publicKey, ok := signer.Public().(*ecdsa.PublicKey)
+	if !ok {
+		return nil, newCryptoError(domexception.InvalidAccessError, "expected an EC private key, got %T", raw)
+	}
+
+	hashed, hash, err := ecdsaHash(params, data)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := signer.Sign(rand.Reader, hashed, hash)
+	if err != nil {
+		return nil, err
+	}
+	var sig struct {
+		R, S *big.Int
+	}
+	if _, err := asn1.Unmarshal(der, &sig); err != nil {
+		return nil, fmt.Errorf("invalid ECDSA signature: %v", err)
+	}
+
+	size := curveSize(publicKey.Curve)
+	signature := make([]byte, 2*size)
+	sig.R.FillBytes(signature[:size])
+	sig.S.FillBytes(signature[size:])
+	return signature, nil
+}
+
+func ecdsaVerify(params *signParams, raw interface{}, signature []byte, data []byte) (bool, error) {
+	publicKey, ok := raw.(*ecdsa.PublicKey)
+	if !ok {
+		return false, newCryptoError(domexception.InvalidAccessError, "expected an EC public key, got %T", raw)
+	}
+
+	hashed, _, err := ecdsaHash(params, data)
+	if err != nil {
+		return false, err
+	}
+
+	size := curveSize(publicKey.Curve)
+	if len(signature) != 2*size {
+		return false, nil
+	}
+	r := new(big.Int).SetBytes(signature[:size])
+	s := new(big.Int).SetBytes(signature[size:])
+	return ecdsa.Verify(publicKey, hashed, r, s), nil
+}
+
+// ecdhDeriveBits returns the x coordinate of the shared point
+func ecdhDeriveBits(params *deriveParams, raw interface{}) ([]byte, error) {
+	privateKey, ok := raw.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, newCryptoError(domexception.InvalidAccessError, "expected an EC private key, got %T", raw)
+	}
+	publicKey, ok := params.PublicRaw.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, newCryptoError(domexception.InvalidAccessError, "expected an EC public key, got %T", params.PublicRaw)
+	}
+	if publicKey.Curve.Params().Name != privateKey.Curve.Params().Name {
+		return nil, newCryptoError(domexception.InvalidAccessError, "public key curve %s does not match %s", publicKey.Curve.Params().Name, privateKey.Curve.Params().Name)
+	}
+
+	x, _ := privateKey.Curve.ScalarMult(publicKey.X, publicKey.Y, privateKey.D.Bytes())
+	return x.FillBytes(make([]byte, curveSize(privateKey.Curve))), nil
+}
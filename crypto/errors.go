@@ -0,0 +1,106 @@
+/*
+ * Copyright (c) 2021 Twintag
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package crypto
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/esoptra/v8go"
+	"github.com/esoptra/v8go-polyfills/domexception"
+)
+
+// newTypeError creates a TypeError of the script realm, falling back to a string
+func newTypeError(ctx *v8go.Context, format string, a ...interface{}) *v8go.Value {
+	iso := ctx.Isolate()
+	msg := fmt.Sprintf(format, a...)
+
+	msgVal, err := v8go.NewValue(iso, msg)
+	if err != nil {
+		return newErrorValue(iso, "%s", msg)
+	}
+
+	ctor, err := ctx.Global().Get("TypeError")
+	if err != nil {
+		return msgVal
+	}
+	fn, err := ctor.AsFunction()
+	if err != nil {
+		return msgVal
+	}
+	obj, err := fn.NewInstance(msgVal)
+	if err != nil {
+		return msgVal
+	}
+
+	return obj.Value
+}
+
+// newDOMException creates a DOMException with the given name, falling back to a string
+func newDOMException(ctx *v8go.Context, name string, format string, a ...interface{}) *v8go.Value {
+	msg := fmt.Sprintf(format, a...)
+
+	obj, err := domexception.New(ctx, name, msg)
+	if err != nil {
+		return newErrorValue(ctx.Isolate(), "%s: %s", name, msg)
+	}
+
+	return obj.Value
+}
+
+// typeError is the name under which a cryptoError is rejected as a TypeError
+const typeError = "TypeError"
+
+// cryptoError is a failed operation, scripts receive it as the DOMException
+// (or TypeError) called Name
+type cryptoError struct {
+	Name string
+	Err  error
+}
+
+func (e *cryptoError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *cryptoError) Unwrap() error {
+	return e.Err
+}
+
+func newCryptoError(name string, format string, a ...interface{}) error {
+	return &cryptoError{Name: name, Err: fmt.Errorf(format, a...)}
+}
+
+// rejectValue creates the value a promise of the method is rejected with,
+// errors without a name become an OperationError
+func rejectValue(ctx *v8go.Context, method string, err error) *v8go.Value {
+	name := domexception.OperationError
+	var ce *cryptoError
+	if errors.As(err, &ce) {
+		name = ce.Name
+	}
+
+	if name == typeError {
+		return newTypeError(ctx, "Failed to execute '%s': %v", method, err)
+	}
+	return newDOMException(ctx, name, "Failed to execute '%s': %v", method, err)
+}
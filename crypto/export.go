@@ -0,0 +1,162 @@
+/*
+ * Copyright (c) 2021 Twintag
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package crypto
+
+import (
+	"fmt"
+
+	"github.com/esoptra/v8go"
+	"github.com/esoptra/v8go-polyfills/domexception"
+	"github.com/esoptra/v8go-polyfills/eventloop"
+)
+
+// jsonWebKey holds the JsonWebKey members shared by the key types
+type jsonWebKey struct {
+	Kty    string   `json:"kty"`
+	Alg    string   `json:"alg,omitempty"`
+	K      string   `json:"k,omitempty"`
+	Crv    string   `json:"crv,omitempty"`
+	X      string   `json:"x,omitempty"`
+	Y      string   `json:"y,omitempty"`
+	N      string   `json:"n,omitempty"`
+	E      string   `json:"e,omitempty"`
+	D      string   `json:"d,omitempty"`
+	P      string   `json:"p,omitempty"`
+	Q      string   `json:"q,omitempty"`
+	DP     string   `json:"dp,omitempty"`
+	DQ     string   `json:"dq,omitempty"`
+	QI     string   `json:"qi,omitempty"`
+	Use    string   `json:"use,omitempty"`
+	KeyOps []string `json:"key_ops,omitempty"`
+	Ext    *bool    `json:"ext,omitempty"`
+}
+
+// checkImport verifies the jwk allows an import with extractable and usages
+func (k *jsonWebKey) checkImport(use string, extractable bool, usages []string) error {
+	if k.Use != "" && k.Use != use {
+		return newCryptoError(domexception.DataError, "jwk use %q is not %q", k.Use, use)
+	}
+
+	if k.KeyOps != nil {
+		for _, u := range usages {
+			found := false
+			for _, op := range k.KeyOps {
+				if op == u {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return newCryptoError(domexception.DataError, "jwk key_ops don't allow %q", u)
+			}
+		}
+	}
+
+	if k.Ext != nil && !*k.Ext && extractable {
+		return newCryptoError(domexception.DataError, "jwk isn't extractable")
+	}
+
+	return nil
+}
+
+// exportKey encodes a key in format, the jwk format is returned as JSON text
+func (c *Crypto) exportKey(format string, key *cryptoKeyArg, raw interface{}) ([]byte, error) {
+	if !key.Extractable {
+		return nil, newCryptoError(domexception.InvalidAccessError, "key is not extractable")
+	}
+
+	name, _ := normalizeAlgorithmName(key.Algorithm.Name)
+	switch name {
+	case string(RSA1_5), string(RSA_PSS), string(RSA_OAEP), string(RSA_OAEP_256):
+		return exportRSAKey(format, key, raw)
+	case string(AES_GCM), string(AES_CBC), string(AES_CTR), string(AES_KW):
+		return exportAESKey(format, key, raw)
+	case string(HMAC):
+		return exportHMACKey(format, key, raw)
+	case string(ECDSA), string(ECDH):
+		return exportECKey(format, key, raw)
+	case string(Ed25519), string(X25519):
+		return exportOKPKey(format, key, raw)
+	default:
+		return nil, newCryptoError(domexception.NotSupportedError, "exporting %s keys is not supported", key.Algorithm.Name)
+	}
+}
+
+// cryptoExportKeyFunctionCallback implements https://developer.mozilla.org/en-US/docs/Web/API/SubtleCrypto/exportKey
+// const result = crypto.subtle.exportKey(format, key);
+// result is a Promise that fulfills with an ArrayBuffer, or a JSON object for the jwk format.
+func (c *Crypto) cryptoExportKeyFunctionCallback() v8go.FunctionCallback {
+	return func(info *v8go.FunctionCallbackInfo) *v8go.Value {
+		ctx := info.Context()
+		iso := ctx.Isolate()
+		resolver, err := v8go.NewPromiseResolver(ctx)
+		if err != nil {
+			strErr, _ := v8go.NewValue(iso, fmt.Sprintf("error creating newPromiseResolver with ctx: %#v", err))
+			return iso.ThrowException(strErr)
+		}
+
+		args := info.Args()
+		if len(args) < 2 {
+			resolver.Reject(newTypeError(ctx, "Failed to execute 'exportKey': 2 arguments required, but only %d present", len(args)))
+			return resolver.GetPromise().Value
+		}
+
+		format := args[0].String()
+		switch format {
+		case "raw", "spki", "pkcs8", "jwk":
+		default:
+			resolver.Reject(newTypeError(ctx, "Failed to execute 'exportKey': unknown key format %q", format))
+			return resolver.GetPromise().Value
+		}
+
+		key, raw, err := c.getCryptoKey(ctx, args[1])
+		if err != nil {
+			resolver.Reject(rejectValue(ctx, "exportKey", err))
+			return resolver.GetPromise().Value
+		}
+
+		eventloop.For(ctx).Go(func() func() {
+			data, err := c.exportKey(format, key, raw)
+			return func() {
+				if err != nil {
+					resolver.Reject(rejectValue(ctx, "exportKey", err))
+					return
+				}
+
+				var v *v8go.Value
+				if format == "jwk" {
+					v, err = v8go.JSONParse(ctx, string(data))
+				} else {
+					v, err = newArrayBuffer(ctx, data)
+				}
+				if err != nil {
+					resolver.Reject(rejectValue(ctx, "exportKey", err))
+					return
+				}
+				resolver.Resolve(v)
+			}
+		})
+
+		return resolver.GetPromise().Value
+	}
+}
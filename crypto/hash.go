@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2021 Twintag
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package crypto
+
+import (
+	"crypto"
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/esoptra/v8go"
+	"github.com/esoptra/v8go-polyfills/domexception"
+)
+
+// hashes maps the WebCrypto hash names to their Go implementation
+var hashes = map[string]crypto.Hash{
+	"SHA-1":   crypto.SHA1,
+	"SHA-256": crypto.SHA256,
+	"SHA-384": crypto.SHA384,
+	"SHA-512": crypto.SHA512,
+}
+
+// getHash resolves a WebCrypto hash name, matched case-insensitively
+func getHash(name string) (crypto.Hash, string, error) {
+	canonical := strings.ToUpper(name)
+	hash, ok := hashes[canonical]
+	if !ok {
+		return 0, "", fmt.Errorf("unknown/unsupported hash algorithm %q", name)
+	}
+	return hash, canonical, nil
+}
+
+// normalizeHash checks the hash member of the algorithm dictionary dict and sets
+// its canonical name, a missing hash is a TypeError and an unknown one a
+// NotSupportedError
+func normalizeHash(dict string, h *HashAlgorithmIdentifier) error {
+	if h.Name == "" {
+		return newCryptoError(typeError, "%s params: hash is required", dict)
+	}
+	_, canonical, err := getHash(h.Name)
+	if err != nil {
+		return newCryptoError(domexception.NotSupportedError, "%v", err)
+	}
+	h.Name = canonical
+	return nil
+}
+
+// UnmarshalJSON accepts both the "SHA-256" and the { name: "SHA-256" } forms
+func (h *HashAlgorithmIdentifier) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		h.Name = name
+		return nil
+	}
+
+	var obj struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return fmt.Errorf("expected hash as string or { name } object: %w", err)
+	}
+	h.Name = obj.Name
+	return nil
+}
+
+// getAlgorithmName returns the name of an algorithm given as string or { name } object
+func getAlgorithmName(v *v8go.Value) (string, error) {
+	if v.IsString() {
+		return v.String(), nil
+	}
+
+	algorithm, err := v.AsObject()
+	if err != nil || !algorithm.Has("name") {
+		return "", fmt.Errorf("expected algorithm as string or object with a name property")
+	}
+	name, err := algorithm.Get("name")
+	if err != nil {
+		return "", err
+	}
+	if name.String() == "" {
+		return "", fmt.Errorf("missing algorithm's name property value")
+	}
+	return name.String(), nil
+}
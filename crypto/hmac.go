@@ -0,0 +1,174 @@
+/*
+ * Copyright (c) 2021 Twintag
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+
+	"github.com/esoptra/v8go-polyfills/domexception"
+)
+
+var hmacUsages = []string{"sign", "verify"}
+
+// hmacHashLength returns the default HMAC key length in bits, the block size of the hash
+func hmacHashLength(hashName string) (int, error) {
+	hash, _, err := getHash(hashName)
+	if err != nil {
+		return 0, newCryptoError(domexception.NotSupportedError, "%v", err)
+	}
+	return hash.New().BlockSize() * 8, nil
+}
+
+// hmacJWKAlg returns the jwk "alg" of an HMAC key, like HS256
+func hmacJWKAlg(hashName string) string {
+	return "HS" + strings.TrimPrefix(hashName, "SHA-")
+}
+
+func (c *Crypto) generateHMACKey(algorithm *HMACAlgo, extractable bool, usages []string) (*CryptoKey, error) {
+	if err := checkKeyUsages(algorithm.Name, usages, hmacUsages...); err != nil {
+		return nil, err
+	}
+
+	blockLength, err := hmacHashLength(algorithm.Hash.Name)
+	if err != nil {
+		return nil, err
+	}
+	if algorithm.Length == 0 {
+		algorithm.Length = blockLength
+	}
+	if algorithm.Length%8 != 0 {
+		return nil, newCryptoError(domexception.OperationError, "HMAC key length must be a multiple of 8, got %d", algorithm.Length)
+	}
+
+	key := make([]byte, algorithm.Length/8)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	return newCryptoKey(key, &CryptoKey{
+		Type:        "secret",
+		Extractable: extractable,
+		Algorithm:   algorithm,
+		Usages:      usages,
+	}), nil
+}
+
+func importHMACKey(format string, keyData []byte, algorithm *HMACAlgo, extractable bool, usages []string) ([]byte, error) {
+	if err := checkKeyUsages(algorithm.Name, usages, hmacUsages...); err != nil {
+		return nil, err
+	}
+
+	if _, err := hmacHashLength(algorithm.Hash.Name); err != nil {
+		return nil, err
+	}
+
+	var key []byte
+	switch format {
+	case "raw":
+		key = keyData
+	case "jwk":
+		jwk := &jsonWebKey{}
+		if err := json.Unmarshal(keyData, jwk); err != nil {
+			return nil, newCryptoError(domexception.DataError, "invalid jwk: %v", err)
+		}
+		if jwk.Kty != "oct" {
+			return nil, newCryptoError(domexception.DataError, "expected jwk kty \"oct\", got %q", jwk.Kty)
+		}
+		k, err := base64.RawURLEncoding.DecodeString(jwk.K)
+		if err != nil {
+			return nil, newCryptoError(domexception.DataError, "invalid jwk k: %v", err)
+		}
+		if jwk.Alg != "" && jwk.Alg != hmacJWKAlg(algorithm.Hash.Name) {
+			return nil, newCryptoError(domexception.DataError, "jwk alg %q does not match HMAC %s", jwk.Alg, algorithm.Hash.Name)
+		}
+		if err := jwk.checkImport("sig", extractable, usages); err != nil {
+			return nil, err
+		}
+		key = k
+	default:
+		return nil, newCryptoError(domexception.NotSupportedError, "format %q not supported for HMAC keys", format)
+	}
+
+	if len(key) == 0 {
+		return nil, newCryptoError(domexception.DataError, "HMAC key data can't be empty")
+	}
+	if algorithm.Length != 0 && (algorithm.Length > len(key)*8 || algorithm.Length <= len(key)*8-8) {
+		return nil, newCryptoError(domexception.DataError, "HMAC length %d does not match the %d bits key data", algorithm.Length, len(key)*8)
+	}
+
+	if algorithm.Length == 0 {
+		algorithm.Length = len(key) * 8
+	}
+	return key, nil
+}
+
+func exportHMACKey(format string, key *cryptoKeyArg, raw interface{}) ([]byte, error) {
+	k, ok := raw.([]byte)
+	if !ok {
+		return nil, newCryptoError(domexception.InvalidAccessError, "expected an HMAC key, got %T", raw)
+	}
+
+	switch format {
+	case "raw":
+		return k, nil
+	case "jwk":
+		return json.Marshal(&jsonWebKey{
+			Kty:    "oct",
+			K:      base64.RawURLEncoding.EncodeToString(k),
+			Alg:    hmacJWKAlg(key.Algorithm.Hash.Name),
+			KeyOps: key.Usages,
+			Ext:    &key.Extractable,
+		})
+	default:
+		return nil, newCryptoError(domexception.NotSupportedError, "format %q not supported for HMAC keys", format)
+	}
+}
+
+func hmacSign(key *cryptoKeyArg, raw interface{}, data []byte) ([]byte, error) {
+	k, ok := raw.([]byte)
+	if !ok {
+		return nil, newCryptoError(domexception.InvalidAccessError, "expected an HMAC key, got %T", raw)
+	}
+
+	hash, _, err := getHash(key.Algorithm.Hash.Name)
+	if err != nil {
+		return nil, newCryptoError(domexception.NotSupportedError, "%v", err)
+	}
+
+	mac := hmac.New(hash.New, k)
+	_, _ = mac.Write(data)
+	return mac.Sum(nil), nil
+}
+
+// hmacVerify compares the signatures in constant time
+func hmacVerify(key *cryptoKeyArg, raw interface{}, signature []byte, data []byte) (bool, error) {
+	expected, err := hmacSign(key, raw, data)
+	if err != nil {
+		return false, err
+	}
+	return hmac.Equal(expected, signature), nil
+}
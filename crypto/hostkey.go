@@ -0,0 +1,264 @@
+/*
+ * Copyright (c) 2021 Twintag
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package crypto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"fmt"
+	"sort"
+
+	"github.com/esoptra/v8go"
+	"github.com/esoptra/v8go-polyfills/uuid"
+)
+
+// DefaultHostKeyBinding is the global object holding the host keys unless
+// WithHostKeyBinding is given
+const DefaultHostKeyBinding = "env"
+
+// HostKey is a key provisioned by the host application. Scripts get it as a
+// non-extractable CryptoKey and never see the key material, so signing can
+// be delegated to an HSM or a KMS client implementing crypto.Signer.
+type HostKey struct {
+	// Key is a crypto.Signer or crypto.Decrypter (like *rsa.PrivateKey,
+	// *ecdsa.PrivateKey and ed25519.PrivateKey), a public key, or the []byte
+	// secret of an AES or HMAC key
+	Key interface{}
+	// Algorithm is one of *RSAAlgoOut, *ECAlgo, *OKPAlgo, *HMACAlgo or *AESAlgo
+	Algorithm interface{}
+	Usages    []string
+}
+
+// RegisterKey stores a host key under name, it is exposed on the host key
+// binding of the contexts injected afterwards
+func (c *Crypto) RegisterKey(name string, key *HostKey) (*CryptoKey, error) {
+	if name == "" {
+		return nil, fmt.Errorf("host key name is required")
+	}
+
+	cryptoKey, err := newHostCryptoKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("host key %q: %w", name, err)
+	}
+
+	cryptoKey.Kid = uuid.NewUuid()
+
+	c.hostKeysMu.Lock()
+	defer c.hostKeysMu.Unlock()
+	if c.hostKeys == nil {
+		c.hostKeys = make(map[string]*StoredKey)
+	}
+	c.hostKeys[name] = &StoredKey{Key: key.Key, CryptoKey: cryptoKey}
+
+	return cryptoKey, nil
+}
+
+// newHostCryptoKey checks the key material matches the algorithm and usages
+func newHostCryptoKey(key *HostKey) (*CryptoKey, error) {
+	var (
+		keyType = "public"
+		public  = key.Key
+	)
+	switch k := key.Key.(type) {
+	case []byte:
+		keyType = "secret"
+	case crypto.Signer:
+		keyType, public = "private", k.Public()
+	case crypto.Decrypter:
+		keyType, public = "private", k.Public()
+	}
+
+	var (
+		algorithm       interface{}
+		name            string
+		publicUsages    []string
+		privateUsages   []string
+		validPublicType bool
+	)
+	switch algo := key.Algorithm.(type) {
+	case *RSAAlgoOut:
+		rsaAlgo := *algo
+		rsaAlgo.Name, _ = normalizeAlgorithmName(algo.Name)
+		if _, hashName, err := getHash(algo.Hash.Name); err == nil {
+			rsaAlgo.Hash.Name = hashName
+		}
+		pub, ok := public.(*rsa.PublicKey)
+		if ok {
+			setRSAKeyAlgorithm(&rsaAlgo, pub)
+		}
+		algorithm, name, validPublicType = &rsaAlgo, rsaAlgo.Name, ok
+		publicUsages, privateUsages = rsaUsages(rsaAlgo.Name)
+	case *ECAlgo:
+		ecAlgo := *algo
+		ecAlgo.Name, _ = normalizeAlgorithmName(algo.Name)
+		curve, err := getCurve(ecAlgo.NamedCurve)
+		if err != nil {
+			return nil, err
+		}
+		pub, ok := public.(*ecdsa.PublicKey)
+		algorithm, name, validPublicType = &ecAlgo, ecAlgo.Name, ok && pub.Curve.Params().Name == curve.Params().Name
+		publicUsages, privateUsages = ecUsages(ecAlgo.Name)
+	case *OKPAlgo:
+		okpAlgo := *algo
+		okpAlgo.Name, _ = normalizeAlgorithmName(algo.Name)
+		if okpAlgo.Name != string(Ed25519) {
+			return nil, fmt.Errorf("%s host keys are not supported", okpAlgo.Name)
+		}
+		_, ok := public.(ed25519.PublicKey)
+		algorithm, name, validPublicType = &okpAlgo, okpAlgo.Name, ok
+		publicUsages, privateUsages = okpUsages(okpAlgo.Name)
+	case *AESAlgo:
+		secret, ok := key.Key.([]byte)
+		if !ok {
+			return nil, fmt.Errorf("expected the []byte secret of an AES key, got %T", key.Key)
+		}
+		aesAlgo := *algo
+		aesAlgo.Name, _ = normalizeAlgorithmName(algo.Name)
+		switch len(secret) {
+		case 16, 24, 32:
+		default:
+			return nil, fmt.Errorf("AES key length must be 128, 192 or 256 bits, got %d", len(secret)*8)
+		}
+		aesAlgo.Length = len(secret) * 8
+		algorithm, name = &aesAlgo, aesAlgo.Name
+		privateUsages = aesUsages(aesAlgo.Name)
+	case *HMACAlgo:
+		secret, ok := key.Key.([]byte)
+		if !ok {
+			return nil, fmt.Errorf("expected the []byte secret of an HMAC key, got %T", key.Key)
+		}
+		hmacAlgo := *algo
+		hmacAlgo.Name = string(HMAC)
+		_, hashName, err := getHash(algo.Hash.Name)
+		if err != nil {
+			return nil, err
+		}
+		hmacAlgo.Hash.Name = hashName
+		hmacAlgo.Length = len(secret) * 8
+		algorithm, name = &hmacAlgo, hmacAlgo.Name
+		privateUsages = hmacUsages
+	default:
+		return nil, fmt.Errorf("unsupported host key algorithm %T", key.Algorithm)
+	}
+
+	switch keyType {
+	case "secret":
+		if err := checkKeyUsages(name, key.Usages, privateUsages...); err != nil {
+			return nil, err
+		}
+	case "private":
+		if !validPublicType {
+			return nil, fmt.Errorf("%T is not a %s private key", key.Key, name)
+		}
+		if err := checkKeyUsages(name, key.Usages, privateUsages...); err != nil {
+			return nil, err
+		}
+	default:
+		if !validPublicType {
+			return nil, fmt.Errorf("%T is not a %s key", key.Key, name)
+		}
+		if err := checkUsagesAllowed(name, key.Usages, publicUsages); err != nil {
+			return nil, err
+		}
+	}
+
+	return &CryptoKey{
+		Type:        keyType,
+		Extractable: false,
+		Algorithm:   algorithm,
+		Usages:      append([]string{}, key.Usages...),
+	}, nil
+}
+
+// hostKey returns the host key with the kid, host keys are shared by all
+// contexts and aren't kept in the KeyStore
+func (c *Crypto) hostKey(kid string) (*StoredKey, bool) {
+	c.hostKeysMu.Lock()
+	defer c.hostKeysMu.Unlock()
+
+	for _, key := range c.hostKeys {
+		if key.CryptoKey.Kid == kid {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// injectHostKeys registers the keys given with WithHostKey once and sets the
+// CryptoKeys of all host keys on the binding object of the global
+func (c *Crypto) injectHostKeys(ctx *v8go.Context, realm *cryptoKeyRealm) error {
+	c.hostKeysOnce.Do(func() {
+		for name, key := range c.HostKeys {
+			if _, err := c.RegisterKey(name, key); err != nil {
+				c.hostKeysErr = fmt.Errorf("v8go-polyfills/crypto: %w", err)
+				return
+			}
+		}
+	})
+	if c.hostKeysErr != nil {
+		return c.hostKeysErr
+	}
+
+	c.hostKeysMu.Lock()
+	defer c.hostKeysMu.Unlock()
+	if len(c.hostKeys) == 0 {
+		return nil
+	}
+
+	binding := c.HostKeyBinding
+	if binding == "" {
+		binding = DefaultHostKeyBinding
+	}
+
+	global := ctx.Global()
+	var obj *v8go.Object
+	if v, err := global.Get(binding); err == nil && v.IsObject() {
+		obj = v.Object()
+	} else {
+		if obj, err = v8go.NewObjectTemplate(ctx.Isolate()).NewInstance(ctx); err != nil {
+			return fmt.Errorf("v8go-polyfills/crypto: %w", err)
+		}
+		if err := global.Set(binding, obj); err != nil {
+			return fmt.Errorf("v8go-polyfills/crypto: %w", err)
+		}
+	}
+
+	names := make([]string, 0, len(c.hostKeys))
+	for name := range c.hostKeys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		v, err := realm.newCryptoKeyValue(ctx, c.hostKeys[name].CryptoKey)
+		if err != nil {
+			return fmt.Errorf("v8go-polyfills/crypto: %w", err)
+		}
+		if err := obj.Set(name, v); err != nil {
+			return fmt.Errorf("v8go-polyfills/crypto: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -29,83 +29,133 @@ import (
 	"github.com/esoptra/v8go"
 )
 
-// func InjectWith(iso *v8go.Isolate, global *v8go.ObjectTemplate, opt ...Option) error {
-// 	e := NewCrypto(opt...)
-// 	cryptoFnTmp, err := v8go.NewFunctionTemplate(iso, e.CryptoFunctionCallback())
-// 	if err != nil {
-// 		return fmt.Errorf("v8go-polyfills/textDecoder NewFunctionTemplate: %w", err)
-// 	}
-// 	if err := global.Set("TextDecoder", cryptoFnTmp); err != nil {
-// 		return fmt.Errorf("v8go-polyfills/textDecoder global.set: %w", err)
-// 	}
-
-// 	return nil
-// }
-
-func InjectWith(iso *v8go.Isolate, ctx *v8go.Context, opt ...Option) error {
-
-	c := NewCrypto(opt...)
-
-	con := v8go.NewObjectTemplate(iso)
+// constructors are the interfaces of the crypto objects, scripts can use them
+// with instanceof but not construct them
+var constructors = []string{"Crypto", "SubtleCrypto", "CryptoKey"}
+
+func (c *Crypto) newSubtleTemplate(iso *v8go.Isolate) (*v8go.ObjectTemplate, error) {
+	subtle := v8go.NewObjectTemplate(iso)
+
+	for _, f := range []struct {
+		Name string
+		Func func() v8go.FunctionCallback
+	}{
+		{Name: "verify", Func: c.cryptoVerifyFunctionCallback},
+		{Name: "sign", Func: c.cryptoSignFunctionCallback},
+		{Name: "encrypt", Func: c.cryptoEncryptFunctionCallback},
+		{Name: "decrypt", Func: c.cryptoDecryptFunctionCallback},
+		{Name: "generateKey", Func: c.cryptoGenerateKeyFunctionCallback},
+		{Name: "importKey", Func: c.cryptoImportKeyFunctionCallback},
+		{Name: "exportKey", Func: c.cryptoExportKeyFunctionCallback},
+		{Name: "wrapKey", Func: c.cryptoWrapKeyFunctionCallback},
+		{Name: "unwrapKey", Func: c.cryptoUnwrapKeyFunctionCallback},
+		{Name: "deriveBits", Func: c.cryptoDeriveBitsFunctionCallback},
+		{Name: "deriveKey", Func: c.cryptoDeriveKeyFunctionCallback},
+		{Name: "digest", Func: c.cryptoDigestFunctionCallback},
+	} {
+		if err := subtle.Set(f.Name, c.newFunctionTemplate(iso, f.Func()), v8go.ReadOnly); err != nil {
+			return nil, fmt.Errorf("v8go-polyfills/crypto: %w", err)
+		}
+	}
 
-	verifyFn := v8go.NewFunctionTemplate(iso, c.cryptoVerifyFunctionCallback())
+	return subtle, nil
+}
 
-	if err := con.Set("verify", verifyFn, v8go.ReadOnly); err != nil {
-		return fmt.Errorf("v8go-polyfills/crypto: %w", err)
+// newCryptoTemplate creates the template of the crypto global
+func (c *Crypto) newCryptoTemplate(iso *v8go.Isolate) (*v8go.ObjectTemplate, error) {
+	subtle, err := c.newSubtleTemplate(iso)
+	if err != nil {
+		return nil, err
 	}
 
-	generateKeyFn := v8go.NewFunctionTemplate(iso, c.cryptoGenerateKeyFunctionCallback())
+	tmpl := v8go.NewObjectTemplate(iso)
+	if err := tmpl.Set("subtle", subtle, v8go.ReadOnly); err != nil {
+		return nil, fmt.Errorf("v8go-polyfills/crypto: %w", err)
+	}
 
-	if err := con.Set("generateKey", generateKeyFn, v8go.ReadOnly); err != nil {
-		return fmt.Errorf("v8go-polyfills/crypto: %w", err)
+	getRandomValuesFn := c.newFunctionTemplate(iso, c.cryptoGetRandomValuesFunctionCallback())
+	if err := tmpl.Set("getRandomValues", getRandomValuesFn, v8go.ReadOnly); err != nil {
+		return nil, fmt.Errorf("v8go-polyfills/crypto: %w", err)
 	}
 
-	importKeyFn := v8go.NewFunctionTemplate(iso, c.cryptoImportKeyFunctionCallback())
-	if err := con.Set("importKey", importKeyFn, v8go.ReadOnly); err != nil {
-		return fmt.Errorf("v8go-polyfills/crypto: %w", err)
+	randomUUIDFn := c.newFunctionTemplate(iso, c.cryptoRandomUUIDFunctionCallback())
+	if err := tmpl.Set("randomUUID", randomUUIDFn, v8go.ReadOnly); err != nil {
+		return nil, fmt.Errorf("v8go-polyfills/crypto: %w", err)
 	}
 
-	con1 := v8go.NewObjectTemplate(iso)
+	return tmpl, nil
+}
 
-	if err := con1.Set("subtle", con); err != nil {
-		return fmt.Errorf("v8go-polyfills/crypto: %w", err)
-	}
+// InjectToGlobal adds crypto, crypto.subtle and the Crypto, SubtleCrypto and
+// CryptoKey interfaces to a global template. Call InitContext on the contexts
+// created from it before running scripts.
+func InjectToGlobal(iso *v8go.Isolate, global *v8go.ObjectTemplate, opt ...Option) error {
+	return InjectWithCryptoTo(iso, global, NewCrypto(opt...))
+}
 
-	conObj, err := con1.NewInstance(ctx)
+// InjectWithCryptoTo adds c like InjectToGlobal, the host keeps c to release
+// the keys of the contexts it closes
+func InjectWithCryptoTo(iso *v8go.Isolate, global *v8go.ObjectTemplate, c *Crypto) error {
+	tmpl, err := c.newCryptoTemplate(iso)
 	if err != nil {
-		return fmt.Errorf("v8go-polyfills/crypto: %w", err)
+		return err
 	}
 
-	if err := ctx.Global().Set("crypto", conObj); err != nil {
+	if err := global.Set("crypto", tmpl, v8go.ReadOnly); err != nil {
 		return fmt.Errorf("v8go-polyfills/crypto: %w", err)
 	}
 
+	for _, name := range constructors {
+		if err := global.Set(name, illegalConstructor(iso), v8go.ReadOnly); err != nil {
+			return fmt.Errorf("v8go-polyfills/crypto: %w", err)
+		}
+	}
+
 	return nil
 }
 
-func InjectTo(ctx *v8go.Context, opt ...Option) error {
+// InitContext sets up a context created from a global template with crypto:
+// the prototypes of crypto and crypto.subtle, the CryptoKey class and the host
+// key binding. Until then they only exist after the first call into crypto.
+func InitContext(ctx *v8go.Context) error {
 	if ctx == nil {
 		return errors.New("v8go-polyfills/crypto: ctx is required")
 	}
 
-	iso := ctx.Isolate()
-
-	c := NewCrypto(opt...)
-
-	con := v8go.NewObjectTemplate(iso)
-	verifyFn := v8go.NewFunctionTemplate(iso, c.cryptoVerifyFunctionCallback())
+	v, err := ctx.Global().Get("crypto")
+	if err != nil {
+		return fmt.Errorf("v8go-polyfills/crypto: %w", err)
+	}
+	if !v.IsObject() {
+		return errors.New("v8go-polyfills/crypto: the context has no crypto")
+	}
+	randomUUID, err := v.Object().Get("randomUUID")
+	if err != nil {
+		return fmt.Errorf("v8go-polyfills/crypto: %w", err)
+	}
+	fn, err := randomUUID.AsFunction()
+	if err != nil {
+		return fmt.Errorf("v8go-polyfills/crypto: %w", err)
+	}
 
-	if err := con.Set("verify", verifyFn, v8go.ReadOnly); err != nil {
+	// the functions of crypto set up the context they are called in first,
+	// with the Crypto they were injected with
+	if _, err := fn.Call(v); err != nil {
 		return fmt.Errorf("v8go-polyfills/crypto: %w", err)
 	}
+	return nil
+}
 
-	importKeyFn := v8go.NewFunctionTemplate(iso, c.cryptoImportKeyFunctionCallback())
+// InjectWith adds crypto like InjectToGlobal to an existing context
+func InjectWith(iso *v8go.Isolate, ctx *v8go.Context, opt ...Option) error {
+	c := NewCrypto(opt...)
 
-	if err := con.Set("importKey", importKeyFn, v8go.ReadOnly); err != nil {
-		return fmt.Errorf("v8go-polyfills/crypto: %w", err)
+	tmpl, err := c.newCryptoTemplate(iso)
+	if err != nil {
+		return err
 	}
 
-	conObj, err := con.NewInstance(ctx)
+	conObj, err := tmpl.NewInstance(ctx)
 	if err != nil {
 		return fmt.Errorf("v8go-polyfills/crypto: %w", err)
 	}
@@ -114,5 +164,21 @@ func InjectTo(ctx *v8go.Context, opt ...Option) error {
 		return fmt.Errorf("v8go-polyfills/crypto: %w", err)
 	}
 
-	return nil
+	for _, name := range constructors {
+		if err := ctx.Global().Set(name, illegalConstructor(iso).GetFunction(ctx)); err != nil {
+			return fmt.Errorf("v8go-polyfills/crypto: %w", err)
+		}
+	}
+
+	_, err = c.realmFor(ctx)
+	return err
+}
+
+// InjectTo adds crypto like InjectWith to ctx
+func InjectTo(ctx *v8go.Context, opt ...Option) error {
+	if ctx == nil {
+		return errors.New("v8go-polyfills/crypto: ctx is required")
+	}
+
+	return InjectWith(ctx.Isolate(), ctx, opt...)
 }
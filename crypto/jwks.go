@@ -0,0 +1,113 @@
+/*
+ * Copyright (c) 2021 Twintag
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package crypto
+
+import (
+	"encoding/json"
+
+	"github.com/esoptra/v8go"
+	"github.com/esoptra/v8go-polyfills/domexception"
+)
+
+// jwkSelector holds the optional kid and alg members of the importKey
+// algorithm, they pick the key of a JWKS, usually from a JWT header:
+//
+//	crypto.subtle.importKey("jwk", jwks, { name: "RSASSA-PKCS1-v1_5", hash: "SHA-256", kid: header.kid }, false, ["verify"])
+type jwkSelector struct {
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+}
+
+func getJWKSelector(v *v8go.Value) *jwkSelector {
+	sel := &jwkSelector{}
+	if !v.IsObject() {
+		return sel
+	}
+	if data, err := v.MarshalJSON(); err == nil {
+		_ = json.Unmarshal(data, sel)
+	}
+	return sel
+}
+
+// jwkKeyType returns the kty and the jwk alg expected for an algorithm, an
+// empty alg matches any key
+func jwkKeyType(algorithm interface{}) (kty string, alg string) {
+	switch algo := algorithm.(type) {
+	case *RSAAlgoOut:
+		if algo.Hash.Name != "" {
+			alg = rsaJWKAlg(algo.Name, algo.Hash.Name)
+		}
+		return "RSA", alg
+	case *ECAlgo:
+		if algo.Name == string(ECDSA) {
+			alg = ecdsaJWKAlgs[algo.NamedCurve]
+		}
+		return "EC", alg
+	case *OKPAlgo:
+		return "OKP", ""
+	case *AESAlgo, *HMACAlgo:
+		return "oct", ""
+	default:
+		return "", ""
+	}
+}
+
+// selectJWK returns the key of a JWKS matching the selector and the algorithm,
+// keyData which isn't a set is returned as is. Without a kid the first
+// matching key of the set is used.
+func selectJWK(keyData []byte, sel *jwkSelector, algorithm interface{}) ([]byte, error) {
+	var set struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if err := json.Unmarshal(keyData, &set); err != nil || set.Keys == nil {
+		return keyData, nil
+	}
+
+	kty, alg := jwkKeyType(algorithm)
+	if sel.Alg != "" {
+		alg = sel.Alg
+	}
+
+	for _, raw := range set.Keys {
+		var key struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Alg string `json:"alg"`
+		}
+		if err := json.Unmarshal(raw, &key); err != nil {
+			return nil, newCryptoError(domexception.DataError, "invalid jwk in the set: %v", err)
+		}
+
+		switch {
+		case kty != "" && key.Kty != kty:
+		case sel.Kid != "" && key.Kid != sel.Kid:
+		case alg != "" && key.Alg != "" && key.Alg != alg:
+		default:
+			return raw, nil
+		}
+	}
+
+	if sel.Kid != "" {
+		return nil, newCryptoError(domexception.DataError, "no %s key with kid %q in the set", kty, sel.Kid)
+	}
+	return nil, newCryptoError(domexception.DataError, "no %s key in the set matches the algorithm", kty)
+}
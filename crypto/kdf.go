@@ -0,0 +1,157 @@
+/*
+ * Copyright (c) 2021 Twintag
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package crypto
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/esoptra/v8go"
+	"github.com/esoptra/v8go-polyfills/domexception"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+var kdfUsages = []string{"deriveKey", "deriveBits"}
+
+// importKDFKey imports the password or input keying material of PBKDF2 and HKDF,
+// these keys can't be extractable
+func importKDFKey(format string, keyData []byte, algorithm *KDFAlgo, extractable bool, usages []string) ([]byte, error) {
+	if err := checkKeyUsages(algorithm.Name, usages, kdfUsages...); err != nil {
+		return nil, err
+	}
+	if format != "raw" {
+		return nil, newCryptoError(domexception.NotSupportedError, "format %q not supported for %s keys", format, algorithm.Name)
+	}
+	if extractable {
+		return nil, newCryptoError(domexception.SyntaxError, "%s keys can't be extractable", algorithm.Name)
+	}
+
+	key := make([]byte, len(keyData))
+	copy(key, keyData)
+	return key, nil
+}
+
+// getKDFParams reads the hash, salt, info and iterations members of the Pbkdf2Params and HkdfParams
+func getKDFParams(obj *v8go.Object, params *deriveParams) error {
+	if !obj.Has("hash") {
+		return newCryptoError(typeError, "%s params: hash is required", params.Name)
+	}
+	hash, err := obj.Get("hash")
+	if err != nil {
+		return newCryptoError(typeError, "%v", err)
+	}
+	hashBytes, err := hash.MarshalJSON()
+	if err != nil {
+		return newCryptoError(typeError, "%v", err)
+	}
+	if err := json.Unmarshal(hashBytes, &params.Hash); err != nil {
+		return newCryptoError(typeError, "%s params: %v", params.Name, err)
+	}
+
+	var ok bool
+	if params.Salt, ok, err = getBufferSourceMember(obj, "salt"); err != nil {
+		return newCryptoError(typeError, "%v", err)
+	} else if !ok {
+		return newCryptoError(typeError, "%s params: salt is required", params.Name)
+	}
+
+	if params.Name == string(HKDF) {
+		if params.Info, ok, err = getBufferSourceMember(obj, "info"); err != nil {
+			return newCryptoError(typeError, "%v", err)
+		} else if !ok {
+			return newCryptoError(typeError, "HKDF params: info is required")
+		}
+		return nil
+	}
+
+	if params.Iterations, ok, err = getNumberMember(obj, "iterations"); err != nil {
+		return newCryptoError(typeError, "%v", err)
+	} else if !ok {
+		return newCryptoError(typeError, "PBKDF2 params: iterations is required")
+	}
+	return nil
+}
+
+// checkKDFLength verifies the length asked to PBKDF2 and HKDF, both need whole bytes
+func checkKDFLength(name string, length int) error {
+	if length < 0 {
+		return newCryptoError(domexception.OperationError, "%s needs a length", name)
+	}
+	if length%8 != 0 {
+		return newCryptoError(domexception.OperationError, "%s length must be a multiple of 8, got %d", name, length)
+	}
+	return nil
+}
+
+func pbkdf2DeriveBits(params *deriveParams, raw interface{}, length int, maxIterations int) ([]byte, error) {
+	password, ok := raw.([]byte)
+	if !ok {
+		return nil, newCryptoError(domexception.InvalidAccessError, "expected a PBKDF2 key, got %T", raw)
+	}
+
+	hash, _, err := getHash(params.Hash.Name)
+	if err != nil {
+		return nil, newCryptoError(domexception.NotSupportedError, "%v", err)
+	}
+	if err := checkKDFLength(params.Name, length); err != nil {
+		return nil, err
+	}
+	if params.Iterations <= 0 {
+		return nil, newCryptoError(domexception.OperationError, "PBKDF2 iterations must be positive, got %d", params.Iterations)
+	}
+	if maxIterations > 0 && params.Iterations > maxIterations {
+		return nil, newCryptoError(domexception.OperationError, "PBKDF2 iterations %d exceed the limit of %d", params.Iterations, maxIterations)
+	}
+	// every hash sized block of the output runs all the iterations again
+	blocks := (length/8 + hash.Size() - 1) / hash.Size()
+	if maxIterations > 0 && blocks > 1 && params.Iterations > maxIterations/blocks {
+		return nil, newCryptoError(domexception.OperationError, "PBKDF2 iterations %d for %d output blocks exceed the limit of %d", params.Iterations, blocks, maxIterations)
+	}
+
+	return pbkdf2.Key(password, params.Salt, params.Iterations, length/8, hash.New), nil
+}
+
+func hkdfDeriveBits(params *deriveParams, raw interface{}, length int) ([]byte, error) {
+	secret, ok := raw.([]byte)
+	if !ok {
+		return nil, newCryptoError(domexception.InvalidAccessError, "expected an HKDF key, got %T", raw)
+	}
+
+	hash, _, err := getHash(params.Hash.Name)
+	if err != nil {
+		return nil, newCryptoError(domexception.NotSupportedError, "%v", err)
+	}
+	if err := checkKDFLength(params.Name, length); err != nil {
+		return nil, err
+	}
+	if length/8 > 255*hash.Size() {
+		return nil, newCryptoError(domexception.OperationError, "HKDF length %d exceeds 255 times the hash size", length)
+	}
+
+	out := make([]byte, length/8)
+	if _, err := io.ReadFull(hkdf.New(hash.New, secret, params.Salt, params.Info), out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
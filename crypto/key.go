@@ -0,0 +1,232 @@
+/*
+ * Copyright (c) 2021 Twintag
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package crypto
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/esoptra/v8go"
+	"github.com/esoptra/v8go-polyfills/domexception"
+	"github.com/esoptra/v8go-polyfills/uuid"
+)
+
+// publicKeyUsages are the usages given to the public key of a generated key pair,
+// the private key gets the other requested usages
+var publicKeyUsages = map[string]bool{
+	"encrypt": true,
+	"verify":  true,
+	"wrapKey": true,
+}
+
+// cryptoKeyArg is a CryptoKey handed back by a script
+type cryptoKeyArg struct {
+	Type        string          `json:"type"`
+	Kid         string          `json:"-"`
+	Extractable bool            `json:"extractable"`
+	Algorithm   keyAlgorithmArg `json:"algorithm"`
+	Usages      []string        `json:"usages"`
+}
+
+type keyAlgorithmArg struct {
+	Name string                  `json:"name"`
+	Hash HashAlgorithmIdentifier `json:"hash"`
+}
+
+// getCryptoKey reads the internal slots of a CryptoKey argument and loads its
+// key material, objects not created by the polyfill are rejected
+func (c *Crypto) getCryptoKey(ctx *v8go.Context, v *v8go.Value) (*cryptoKeyArg, interface{}, error) {
+	if !v.IsObject() {
+		return nil, nil, newCryptoError(typeError, "expected key argument as CryptoKey")
+	}
+
+	obj := v.Object()
+	if obj.InternalFieldCount() != cryptoKeyFieldCount {
+		return nil, nil, newCryptoError(typeError, "expected key argument as CryptoKey")
+	}
+	kid := obj.GetInternalField(cryptoKeyKidField)
+	if !kid.IsString() {
+		return nil, nil, newCryptoError(typeError, "expected key argument as CryptoKey")
+	}
+
+	stored, ok := c.hostKey(kid.String())
+	if !ok {
+		realm, err := c.realmFor(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		stored, ok = c.KeyStore.Get(realm.namespace, kid.String())
+	}
+	if !ok {
+		return nil, nil, newCryptoError(domexception.InvalidAccessError, "unknown key")
+	}
+
+	data, err := json.Marshal(stored.CryptoKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	key := &cryptoKeyArg{}
+	if err := json.Unmarshal(data, key); err != nil {
+		return nil, nil, err
+	}
+	key.Kid = stored.CryptoKey.Kid
+
+	return key, stored.Key, nil
+}
+
+// algorithmFamily returns the algorithm a normalized name belongs to and the
+// hash the name implies, RSA-OAEP-256 is RSA-OAEP with SHA-256
+func algorithmFamily(name string) (family string, hash string) {
+	if strings.EqualFold(name, string(RSA_OAEP_256)) {
+		return string(RSA_OAEP), "SHA-256"
+	}
+	return name, ""
+}
+
+// hashName returns the hash bound to the key, or implied by its algorithm name
+func (k *cryptoKeyArg) hashName() string {
+	if k.Algorithm.Hash.Name != "" {
+		return k.Algorithm.Hash.Name
+	}
+	_, hash := algorithmFamily(k.Algorithm.Name)
+	return hash
+}
+
+// checkUsage verifies the key belongs to the family of the algorithm, with
+// the same hash when the algorithm name implies one, and allows the usage
+func (k *cryptoKeyArg) checkUsage(algorithm string, usage string) error {
+	keyFamily, _ := algorithmFamily(k.Algorithm.Name)
+	family, hash := algorithmFamily(algorithm)
+	if !strings.EqualFold(keyFamily, family) {
+		return newCryptoError(domexception.InvalidAccessError, "key algorithm %s does not match %s", k.Algorithm.Name, algorithm)
+	}
+	if keyHash := k.hashName(); hash != "" && keyHash != "" && !strings.EqualFold(keyHash, hash) {
+		return newCryptoError(domexception.InvalidAccessError, "key hash %s does not match %s", keyHash, algorithm)
+	}
+
+	for _, u := range k.Usages {
+		if u == usage {
+			return nil
+		}
+	}
+
+	return newCryptoError(domexception.InvalidAccessError, "key usages do not permit %q", usage)
+}
+
+// getKeyUsages reads the keyUsages array argument
+func getKeyUsages(v *v8go.Value) ([]string, error) {
+	if !v.IsArray() {
+		return nil, newCryptoError(typeError, "expected keyUsages argument as array type")
+	}
+
+	data, err := v.MarshalJSON()
+	if err != nil {
+		return nil, newCryptoError(typeError, "error marshalling keyUsages: %v", err)
+	}
+
+	usages := make([]string, 0)
+	if err := json.Unmarshal(data, &usages); err != nil {
+		return nil, newCryptoError(typeError, "expected keyUsages as an array of strings: %v", err)
+	}
+
+	return usages, nil
+}
+
+// splitKeyUsages splits the usages of a key pair between its public and private keys
+func splitKeyUsages(usages []string) (public []string, private []string) {
+	public, private = make([]string, 0), make([]string, 0)
+	for _, u := range usages {
+		if publicKeyUsages[u] {
+			public = append(public, u)
+		} else {
+			private = append(private, u)
+		}
+	}
+	return public, private
+}
+
+// checkKeyUsages verifies the requested usages are valid for the algorithm
+func checkKeyUsages(algorithm string, usages []string, allowed ...string) error {
+	if len(usages) == 0 {
+		return newCryptoError(domexception.SyntaxError, "usages can't be empty for a %s key", algorithm)
+	}
+	return checkUsagesAllowed(algorithm, usages, allowed)
+}
+
+// checkKeyPairUsages verifies the usages of a generated key pair,
+// the private key must get at least one of them
+func checkKeyPairUsages(algorithm string, usages []string, public []string, private []string) error {
+	if err := checkUsagesAllowed(algorithm, usages, append(append([]string{}, public...), private...)); err != nil {
+		return err
+	}
+
+	if _, privateUsages := splitKeyUsages(usages); len(privateUsages) == 0 {
+		return newCryptoError(domexception.SyntaxError, "usages of the %s private key can't be empty", algorithm)
+	}
+	return nil
+}
+
+func checkUsagesAllowed(algorithm string, usages []string, allowed []string) error {
+	for _, u := range usages {
+		valid := false
+		for _, a := range allowed {
+			if u == a {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return newCryptoError(domexception.SyntaxError, "usage %q is not valid for a %s key", u, algorithm)
+		}
+	}
+
+	return nil
+}
+
+// newCryptoKey assigns a new Kid to cryptoKey and attaches the key material,
+// it's put in the key store of the context the key is handed to
+func newCryptoKey(key interface{}, cryptoKey *CryptoKey) *CryptoKey {
+	cryptoKey.Kid = uuid.NewUuid()
+	cryptoKey.key = key
+	return cryptoKey
+}
+
+// newCryptoKeyPair creates the CryptoKeys of a generated key pair, public keys are always extractable
+func newCryptoKeyPair(privateKey interface{}, publicKey interface{}, algorithm interface{}, extractable bool, usages []string) *CryptoKeyPair {
+	publicUsages, privateUsages := splitKeyUsages(usages)
+
+	return &CryptoKeyPair{
+		PrivateKey: newCryptoKey(privateKey, &CryptoKey{
+			Type:        "private",
+			Extractable: extractable,
+			Algorithm:   algorithm,
+			Usages:      privateUsages,
+		}),
+		PublicKey: newCryptoKey(publicKey, &CryptoKey{
+			Type:        "public",
+			Extractable: true,
+			Algorithm:   algorithm,
+			Usages:      publicUsages,
+		}),
+	}
+}
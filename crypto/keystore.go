@@ -0,0 +1,209 @@
+/*
+ * Copyright (c) 2021 Twintag
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package crypto
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// StoredKey is the key material behind a CryptoKey of a script
+type StoredKey struct {
+	Key       interface{}
+	CryptoKey *CryptoKey
+}
+
+// KeyStore holds the keys created by scripts. Every context the Crypto is
+// injected into gets its own namespace, a key is only found by the context
+// which created it.
+type KeyStore interface {
+	Get(namespace string, kid string) (*StoredKey, bool)
+	Put(namespace string, kid string, key *StoredKey) error
+	Delete(namespace string, kid string)
+	// Range calls f for the keys of a namespace until it returns false
+	Range(namespace string, f func(kid string, key *StoredKey) bool)
+}
+
+// MemoryKeyStore is the default KeyStore, it keeps the keys in memory until
+// they expire, are evicted or their context is released
+type MemoryKeyStore struct {
+	// TTL expires keys that long after they were stored, zero keeps them
+	TTL time.Duration
+	// MaxEntries caps the keys of a namespace, storing more evicts the least
+	// recently used one. Zero means no limit.
+	MaxEntries int
+	// Now is the clock of the TTL
+	Now func() time.Time
+
+	mu         sync.Mutex
+	namespaces map[string]*keyNamespace
+}
+
+type keyNamespace struct {
+	entries map[string]*list.Element
+	// lru holds the *memoryKey entries, the most recently used first
+	lru *list.List
+}
+
+type memoryKey struct {
+	kid     string
+	key     *StoredKey
+	expires time.Time
+}
+
+func NewMemoryKeyStore(ttl time.Duration, maxEntries int) *MemoryKeyStore {
+	return &MemoryKeyStore{
+		TTL:        ttl,
+		MaxEntries: maxEntries,
+		Now:        time.Now,
+	}
+}
+
+func (s *MemoryKeyStore) now() time.Time {
+	if s.Now == nil {
+		return time.Now()
+	}
+	return s.Now()
+}
+
+func (k *memoryKey) expired(now time.Time) bool {
+	return !k.expires.IsZero() && !now.Before(k.expires)
+}
+
+func (s *MemoryKeyStore) Get(namespace string, kid string) (*StoredKey, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ns, ok := s.namespaces[namespace]
+	if !ok {
+		return nil, false
+	}
+	el, ok := ns.entries[kid]
+	if !ok {
+		return nil, false
+	}
+
+	entry := el.Value.(*memoryKey)
+	if entry.expired(s.now()) {
+		s.remove(namespace, ns, el)
+		return nil, false
+	}
+
+	ns.lru.MoveToFront(el)
+	return entry.key, true
+}
+
+func (s *MemoryKeyStore) Put(namespace string, kid string, key *StoredKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := &memoryKey{kid: kid, key: key}
+	if s.TTL > 0 {
+		entry.expires = s.now().Add(s.TTL)
+	}
+
+	ns, ok := s.namespaces[namespace]
+	if !ok {
+		ns = &keyNamespace{entries: make(map[string]*list.Element), lru: list.New()}
+		if s.namespaces == nil {
+			s.namespaces = make(map[string]*keyNamespace)
+		}
+		s.namespaces[namespace] = ns
+	}
+
+	if el, ok := ns.entries[kid]; ok {
+		el.Value = entry
+		ns.lru.MoveToFront(el)
+		return nil
+	}
+	ns.entries[kid] = ns.lru.PushFront(entry)
+
+	for s.MaxEntries > 0 && ns.lru.Len() > s.MaxEntries {
+		s.remove(namespace, ns, ns.lru.Back())
+	}
+
+	return nil
+}
+
+func (s *MemoryKeyStore) Delete(namespace string, kid string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ns, ok := s.namespaces[namespace]; ok {
+		if el, ok := ns.entries[kid]; ok {
+			s.remove(namespace, ns, el)
+		}
+	}
+}
+
+func (s *MemoryKeyStore) Range(namespace string, f func(kid string, key *StoredKey) bool) {
+	s.mu.Lock()
+	var entries []*memoryKey
+	if ns, ok := s.namespaces[namespace]; ok {
+		now := s.now()
+		for el := ns.lru.Front(); el != nil; el = el.Next() {
+			if entry := el.Value.(*memoryKey); !entry.expired(now) {
+				entries = append(entries, entry)
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	// f may use the store
+	for _, entry := range entries {
+		if !f(entry.kid, entry.key) {
+			return
+		}
+	}
+}
+
+// Purge deletes the expired keys of all namespaces, it returns how many were
+// deleted. Expired keys are otherwise only dropped when they're looked up.
+func (s *MemoryKeyStore) Purge() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	n := 0
+	for name, ns := range s.namespaces {
+		for el := ns.lru.Front(); el != nil; {
+			next := el.Next()
+			if el.Value.(*memoryKey).expired(now) {
+				s.remove(name, ns, el)
+				n++
+			}
+			el = next
+		}
+	}
+	return n
+}
+
+// remove deletes an entry, dropping its namespace once empty
+func (s *MemoryKeyStore) remove(namespace string, ns *keyNamespace, el *list.Element) {
+	delete(ns.entries, el.Value.(*memoryKey).kid)
+	ns.lru.Remove(el)
+	if ns.lru.Len() == 0 {
+		delete(s.namespaces, namespace)
+	}
+}
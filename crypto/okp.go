@@ -0,0 +1,327 @@
+/*
+ * Copyright (c) 2021 Twintag
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package crypto
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/esoptra/v8go-polyfills/domexception"
+	"golang.org/x/crypto/curve25519"
+)
+
+// x25519PrivateKey and x25519PublicKey are the 32 bytes X25519 scalar and point
+type x25519PrivateKey []byte
+type x25519PublicKey []byte
+
+// okpOIDs are the algorithm identifiers of RFC 8410
+var okpOIDs = map[string]asn1.ObjectIdentifier{
+	string(X25519):  {1, 3, 101, 110},
+	string(Ed25519): {1, 3, 101, 112},
+}
+
+type okpSPKI struct {
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+type okpPKCS8 struct {
+	Version    int
+	Algorithm  pkix.AlgorithmIdentifier
+	PrivateKey []byte
+	Attributes asn1.RawValue  `asn1:"optional,tag:0"`
+	PublicKey  asn1.BitString `asn1:"optional,tag:1"`
+}
+
+// okpUsages returns the usages valid for the public and private keys of an OKP algorithm
+func okpUsages(name string) (public []string, private []string) {
+	if name == string(X25519) {
+		return []string{}, []string{"deriveKey", "deriveBits"}
+	}
+	return []string{"verify"}, []string{"sign"}
+}
+
+// okpKeyPair returns the public key of a private key seed or scalar
+func okpKeyPair(name string, private []byte) (interface{}, interface{}, error) {
+	if len(private) != 32 {
+		return nil, nil, newCryptoError(domexception.DataError, "%s private key must be 32 bytes, got %d", name, len(private))
+	}
+
+	if name == string(Ed25519) {
+		privateKey := ed25519.NewKeyFromSeed(private)
+		return privateKey, privateKey.Public(), nil
+	}
+
+	public, err := curve25519.X25519(private, curve25519.Basepoint)
+	if err != nil {
+		return nil, nil, newCryptoError(domexception.DataError, "%v", err)
+	}
+	return x25519PrivateKey(private), x25519PublicKey(public), nil
+}
+
+func okpPublicKey(name string, public []byte) (interface{}, error) {
+	if len(public) != 32 {
+		return nil, newCryptoError(domexception.DataError, "%s public key must be 32 bytes, got %d", name, len(public))
+	}
+	if name == string(Ed25519) {
+		return ed25519.PublicKey(public), nil
+	}
+	return x25519PublicKey(public), nil
+}
+
+// okpBytes returns the private seed or scalar and the public key of an OKP key
+func okpBytes(raw interface{}) (private []byte, public []byte, ok bool) {
+	switch k := raw.(type) {
+	case ed25519.PrivateKey:
+		return k.Seed(), k.Public().(ed25519.PublicKey), true
+	case ed25519.PublicKey:
+		return nil, k, true
+	case x25519PrivateKey:
+		public, err := curve25519.X25519(k, curve25519.Basepoint)
+		return k, public, err == nil
+	case x25519PublicKey:
+		return nil, k, true
+	default:
+		return nil, nil, false
+	}
+}
+
+func (c *Crypto) generateOKPKeyPair(algorithm *OKPAlgo, extractable bool, usages []string) (*CryptoKeyPair, error) {
+	public, private := okpUsages(algorithm.Name)
+	if err := checkKeyPairUsages(algorithm.Name, usages, public, private); err != nil {
+		return nil, err
+	}
+
+	seed := make([]byte, 32)
+	if _, err := rand.Read(seed); err != nil {
+		return nil, err
+	}
+	privateKey, publicKey, err := okpKeyPair(algorithm.Name, seed)
+	if err != nil {
+		return nil, err
+	}
+
+	return newCryptoKeyPair(privateKey, publicKey, algorithm, extractable, usages), nil
+}
+
+func importOKPKey(format string, keyData []byte, algorithm *OKPAlgo, extractable bool, usages []string) (interface{}, string, error) {
+	var (
+		key     interface{}
+		keyType = "public"
+		err     error
+	)
+
+	switch format {
+	case "raw":
+		key, err = okpPublicKey(algorithm.Name, keyData)
+	case "spki":
+		var spki okpSPKI
+		if rest, e := asn1.Unmarshal(keyData, &spki); e != nil || len(rest) > 0 {
+			return nil, "", newCryptoError(domexception.DataError, "invalid spki")
+		}
+		if !spki.Algorithm.Algorithm.Equal(okpOIDs[algorithm.Name]) {
+			return nil, "", newCryptoError(domexception.DataError, "spki is not a %s key", algorithm.Name)
+		}
+		key, err = okpPublicKey(algorithm.Name, spki.PublicKey.RightAlign())
+	case "pkcs8":
+		var pkcs8 okpPKCS8
+		if rest, e := asn1.Unmarshal(keyData, &pkcs8); e != nil || len(rest) > 0 {
+			return nil, "", newCryptoError(domexception.DataError, "invalid pkcs8")
+		}
+		if !pkcs8.Algorithm.Algorithm.Equal(okpOIDs[algorithm.Name]) {
+			return nil, "", newCryptoError(domexception.DataError, "pkcs8 is not a %s key", algorithm.Name)
+		}
+		var private []byte
+		if rest, e := asn1.Unmarshal(pkcs8.PrivateKey, &private); e != nil || len(rest) > 0 {
+			return nil, "", newCryptoError(domexception.DataError, "invalid pkcs8 private key")
+		}
+		key, _, err = okpKeyPair(algorithm.Name, private)
+		keyType = "private"
+	case "jwk":
+		key, keyType, err = parseOKPJWK(keyData, algorithm, extractable, usages)
+	default:
+		return nil, "", newCryptoError(domexception.NotSupportedError, "format %q not supported for %s keys", format, algorithm.Name)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	public, private := okpUsages(algorithm.Name)
+	if keyType == "private" {
+		err = checkKeyUsages(algorithm.Name, usages, private...)
+	} else {
+		err = checkUsagesAllowed(algorithm.Name, usages, public)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	return key, keyType, nil
+}
+
+func parseOKPJWK(keyData []byte, algorithm *OKPAlgo, extractable bool, usages []string) (interface{}, string, error) {
+	jwk := &jsonWebKey{}
+	if err := json.Unmarshal(keyData, jwk); err != nil {
+		return nil, "", newCryptoError(domexception.DataError, "invalid jwk: %v", err)
+	}
+	if jwk.Kty != "OKP" {
+		return nil, "", newCryptoError(domexception.DataError, "expected jwk kty \"OKP\", got %q", jwk.Kty)
+	}
+	if jwk.Crv != algorithm.Name {
+		return nil, "", newCryptoError(domexception.DataError, "jwk crv %q does not match %s", jwk.Crv, algorithm.Name)
+	}
+
+	use := "enc"
+	if algorithm.Name == string(Ed25519) {
+		use = "sig"
+		if jwk.Alg != "" && jwk.Alg != "EdDSA" && jwk.Alg != string(Ed25519) {
+			return nil, "", newCryptoError(domexception.DataError, "jwk alg %q is not EdDSA", jwk.Alg)
+		}
+	}
+	if err := jwk.checkImport(use, extractable, usages); err != nil {
+		return nil, "", err
+	}
+
+	x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+	if err != nil {
+		return nil, "", newCryptoError(domexception.DataError, "invalid jwk x")
+	}
+	if jwk.D == "" {
+		key, err := okpPublicKey(algorithm.Name, x)
+		return key, "public", err
+	}
+
+	d, err := base64.RawURLEncoding.DecodeString(jwk.D)
+	if err != nil {
+		return nil, "", newCryptoError(domexception.DataError, "invalid jwk d")
+	}
+	key, public, err := okpKeyPair(algorithm.Name, d)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, publicBytes, _ := okpBytes(public); !bytes.Equal(publicBytes, x) {
+		return nil, "", newCryptoError(domexception.DataError, "jwk d does not match x")
+	}
+	return key, "private", nil
+}
+
+func exportOKPKey(format string, key *cryptoKeyArg, raw interface{}) ([]byte, error) {
+	private, public, ok := okpBytes(raw)
+	if !ok {
+		return nil, newCryptoError(domexception.InvalidAccessError, "expected an %s key, got %T", key.Algorithm.Name, raw)
+	}
+	isPrivate := private != nil
+	oid := okpOIDs[key.Algorithm.Name]
+
+	switch format {
+	case "raw":
+		if isPrivate {
+			return nil, newCryptoError(domexception.InvalidAccessError, "raw exports public keys only")
+		}
+		return public, nil
+	case "spki":
+		if isPrivate {
+			return nil, newCryptoError(domexception.InvalidAccessError, "spki exports public keys only")
+		}
+		return asn1.Marshal(okpSPKI{
+			Algorithm: pkix.AlgorithmIdentifier{Algorithm: oid},
+			PublicKey: asn1.BitString{Bytes: public, BitLength: 8 * len(public)},
+		})
+	case "pkcs8":
+		if !isPrivate {
+			return nil, newCryptoError(domexception.InvalidAccessError, "pkcs8 exports private keys only")
+		}
+		curvePrivateKey, err := asn1.Marshal(private)
+		if err != nil {
+			return nil, err
+		}
+		return asn1.Marshal(okpPKCS8{
+			Algorithm:  pkix.AlgorithmIdentifier{Algorithm: oid},
+			PrivateKey: curvePrivateKey,
+		})
+	case "jwk":
+		jwk := &jsonWebKey{
+			Kty:    "OKP",
+			Crv:    key.Algorithm.Name,
+			X:      base64.RawURLEncoding.EncodeToString(public),
+			KeyOps: key.Usages,
+			Ext:    &key.Extractable,
+		}
+		if key.Algorithm.Name == string(Ed25519) {
+			jwk.Alg = "EdDSA"
+		}
+		if isPrivate {
+			jwk.D = base64.RawURLEncoding.EncodeToString(private)
+		}
+		return json.Marshal(jwk)
+	default:
+		return nil, newCryptoError(domexception.NotSupportedError, "format %q not supported for %s keys", format, key.Algorithm.Name)
+	}
+}
+
+// ed25519Sign signs with an ed25519.PrivateKey or any crypto.Signer of an Ed25519 key
+func ed25519Sign(raw interface{}, data []byte) ([]byte, error) {
+	signer, ok := raw.(crypto.Signer)
+	if !ok {
+		return nil, newCryptoError(domexception.InvalidAccessError, "expected an Ed25519 private key, got %T", raw)
+	}
+	if _, ok := signer.Public().(ed25519.PublicKey); !ok {
+		return nil, newCryptoError(domexception.InvalidAccessError, "expected an Ed25519 private key, got %T", raw)
+	}
+	return signer.Sign(rand.Reader, data, crypto.Hash(0))
+}
+
+func ed25519Verify(raw interface{}, signature []byte, data []byte) (bool, error) {
+	publicKey, ok := raw.(ed25519.PublicKey)
+	if !ok {
+		return false, newCryptoError(domexception.InvalidAccessError, "expected an Ed25519 public key, got %T", raw)
+	}
+	if len(signature) != ed25519.SignatureSize {
+		return false, nil
+	}
+	return ed25519.Verify(publicKey, data, signature), nil
+}
+
+// x25519DeriveBits fails for small order public keys giving an all zero secret
+func x25519DeriveBits(params *deriveParams, raw interface{}) ([]byte, error) {
+	privateKey, ok := raw.(x25519PrivateKey)
+	if !ok {
+		return nil, newCryptoError(domexception.InvalidAccessError, "expected an X25519 private key, got %T", raw)
+	}
+	publicKey, ok := params.PublicRaw.(x25519PublicKey)
+	if !ok {
+		return nil, newCryptoError(domexception.InvalidAccessError, "expected an X25519 public key, got %T", params.PublicRaw)
+	}
+
+	secret, err := curve25519.X25519(privateKey, publicKey)
+	if err != nil {
+		return nil, newCryptoError(domexception.OperationError, "%v", err)
+	}
+	return secret, nil
+}
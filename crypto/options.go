@@ -31,3 +31,40 @@ type optionFunc func(c *Crypto)
 func (f optionFunc) apply(c *Crypto) {
 	f(c)
 }
+
+// WithMaxPBKDF2Iterations caps the PBKDF2 iterations a script may request,
+// times the hash sized blocks of the derived bits, deriving with more
+// iterations rejects with an OperationError
+func WithMaxPBKDF2Iterations(n int) Option {
+	return optionFunc(func(c *Crypto) {
+		c.MaxPBKDF2Iterations = n
+	})
+}
+
+// WithHostKey provisions a key of the host under name, scripts find it as a
+// non-extractable CryptoKey on the host key binding, "env" by default:
+//
+//	const signature = await crypto.subtle.sign("Ed25519", env.platformKey, data);
+func WithHostKey(name string, key *HostKey) Option {
+	return optionFunc(func(c *Crypto) {
+		if c.HostKeys == nil {
+			c.HostKeys = make(map[string]*HostKey)
+		}
+		c.HostKeys[name] = key
+	})
+}
+
+// WithHostKeyBinding sets the name of the global object holding the host keys
+func WithHostKeyBinding(name string) Option {
+	return optionFunc(func(c *Crypto) {
+		c.HostKeyBinding = name
+	})
+}
+
+// WithKeyStore keeps the keys created by scripts in ks, e.g. a
+// MemoryKeyStore with a TTL and a maximum number of keys per context
+func WithKeyStore(ks KeyStore) Option {
+	return optionFunc(func(c *Crypto) {
+		c.KeyStore = ks
+	})
+}
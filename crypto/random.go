@@ -0,0 +1,115 @@
+/*
+ * Copyright (c) 2021 Twintag
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package crypto
+
+import (
+	"crypto/rand"
+
+	"github.com/esoptra/v8go"
+	"github.com/esoptra/v8go-polyfills/domexception"
+	"github.com/esoptra/v8go-polyfills/uuid"
+)
+
+// maxRandomValuesLength is the largest byteLength getRandomValues fills, as per spec
+const maxRandomValuesLength = 65536
+
+// cryptoGetRandomValuesFunctionCallback implements https://developer.mozilla.org/en-US/docs/Web/API/Crypto/getRandomValues
+// const array = crypto.getRandomValues(typedArray);
+// the integer typed array is filled in place and returned.
+func (c *Crypto) cryptoGetRandomValuesFunctionCallback() v8go.FunctionCallback {
+	return func(info *v8go.FunctionCallbackInfo) *v8go.Value {
+		ctx := info.Context()
+		iso := ctx.Isolate()
+		args := info.Args()
+		if len(args) < 1 {
+			return iso.ThrowException(newTypeError(ctx, "Failed to execute 'getRandomValues': 1 argument required, but only 0 present"))
+		}
+
+		array := args[0]
+		if !array.IsArrayBufferView() {
+			return iso.ThrowException(newTypeError(ctx, "Failed to execute 'getRandomValues': parameter 1 is not of type 'ArrayBufferView'"))
+		}
+		if !isIntegerTypedArray(array) {
+			return iso.ThrowException(newDOMException(ctx, domexception.TypeMismatchError,
+				"Failed to execute 'getRandomValues': the provided ArrayBufferView is of type '%s', which is not an integer array type", viewTypeName(array)))
+		}
+
+		view, err := getBufferView(array)
+		if err != nil {
+			return iso.ThrowException(newTypeError(ctx, "Failed to execute 'getRandomValues': %v", err))
+		}
+
+		if view.Length > maxRandomValuesLength {
+			return iso.ThrowException(newDOMException(ctx, domexception.QuotaExceededError,
+				"Failed to execute 'getRandomValues': the ArrayBufferView's byte length (%d) exceeds the number of bytes of entropy available via this API (%d)",
+				view.Length, maxRandomValuesLength))
+		}
+
+		if view.Length == 0 {
+			return array
+		}
+
+		data := view.Buffer.GetBytes()
+		if _, err := rand.Read(data[view.Offset : view.Offset+view.Length]); err != nil {
+			return iso.ThrowException(newDOMException(ctx, domexception.OperationError, "Failed to execute 'getRandomValues': %v", err))
+		}
+		view.Buffer.PutBytes(data)
+
+		return array
+	}
+}
+
+// cryptoRandomUUIDFunctionCallback implements https://developer.mozilla.org/en-US/docs/Web/API/Crypto/randomUUID
+// const uuid = crypto.randomUUID();
+// uuid is a random (v4) UUID string.
+func (c *Crypto) cryptoRandomUUIDFunctionCallback() v8go.FunctionCallback {
+	return func(info *v8go.FunctionCallbackInfo) *v8go.Value {
+		iso := info.Context().Isolate()
+		v, err := v8go.NewValue(iso, uuid.NewV4().String())
+		if err != nil {
+			return iso.ThrowException(newErrorValue(iso, "error creating uuid value: %v", err))
+		}
+		return v
+	}
+}
+
+// viewTypeName names the ArrayBufferViews getRandomValues doesn't fill
+func viewTypeName(v *v8go.Value) string {
+	switch {
+	case v.IsFloat32Array():
+		return "Float32Array"
+	case v.IsFloat64Array():
+		return "Float64Array"
+	case v.IsDataView():
+		return "DataView"
+	default:
+		return "ArrayBufferView"
+	}
+}
+
+func isIntegerTypedArray(v *v8go.Value) bool {
+	return v.IsInt8Array() || v.IsUint8Array() || v.IsUint8ClampedArray() ||
+		v.IsInt16Array() || v.IsUint16Array() ||
+		v.IsInt32Array() || v.IsUint32Array() ||
+		v.IsBigInt64Array() || v.IsBigUint64Array()
+}
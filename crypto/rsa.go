@@ -1,60 +1,442 @@
 package crypto
 
 import (
-	"context"
+	"crypto"
+	"crypto/rand"
 	"crypto/rsa"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
 
+	"github.com/esoptra/v8go-polyfills/domexception"
 	"github.com/lestrrat-go/jwx/jwk"
 )
 
 //NOTE: see https://github.com/MicahParks/keyfunc for future modification
-func parseKey(keyDataBytes []byte) (*rsa.PublicKey, error) {
+// parseKey parses an RSA jwk, returning a *rsa.PublicKey or a *rsa.PrivateKey
+func parseKey(keyDataBytes []byte) (interface{}, error) {
 	key, err := jwk.ParseKey(keyDataBytes)
 	if err != nil {
-		return nil, fmt.Errorf("error parsing keyDataBytes: %#v", err)
+		return nil, fmt.Errorf("error parsing keyDataBytes: %w", err)
 	}
 	var rawkey interface{} // This is the raw key, like *rsa.PrivateKey or *ecdsa.PrivateKey
 	if err := key.Raw(&rawkey); err != nil {
-		return nil, fmt.Errorf("failed to create public key: %#v", err)
+		return nil, fmt.Errorf("failed to create raw key: %w", err)
 	}
 
-	// We know this is an RSA Key so...
-	rsa, ok := rawkey.(*rsa.PublicKey)
+	switch rawkey.(type) {
+	case *rsa.PublicKey, *rsa.PrivateKey:
+		return rawkey, nil
+	default:
+		return nil, fmt.Errorf("expected rsa key, got %T", rawkey)
+	}
+}
+
+// rsaHash returns the hash bound to an RSA key or implied by its algorithm
+// name, keys imported without one use the fallback hash
+func rsaHash(key *cryptoKeyArg, fallback string) (crypto.Hash, error) {
+	name := key.hashName()
+	if name == "" {
+		name = fallback
+	}
+
+	hash, _, err := getHash(name)
+	if err != nil {
+		return 0, newCryptoError(domexception.NotSupportedError, "%v", err)
+	}
+	return hash, nil
+}
+
+// pssOptions converts the RsaPssParams checked by getSignParams. Go reads a
+// salt length of 0 as "detect it" when verifying and "as long as possible"
+// when signing, so an empty salt is handled by pssSignNoSalt and
+// pssVerifyNoSalt instead.
+func pssOptions(params *signParams, hash crypto.Hash) *rsa.PSSOptions {
+	return &rsa.PSSOptions{SaltLength: *params.SaltLength, Hash: hash}
+}
+
+// pssEncodeNoSalt implements EMSA-PSS-ENCODE of RFC 8017 with an empty salt
+func pssEncodeNoSalt(hash crypto.Hash, hashed []byte, emBits int) ([]byte, error) {
+	hLen := hash.Size()
+	emLen := (emBits + 7) / 8
+	if emLen < hLen+2 {
+		return nil, newCryptoError(domexception.OperationError, "RSA-PSS: the key is too short for %s", hash)
+	}
+
+	em := make([]byte, emLen)
+	db := em[:emLen-hLen-1]
+	h := em[emLen-hLen-1 : emLen-1]
+	em[emLen-1] = 0xbc
+
+	hasher := hash.New()
+	_, _ = hasher.Write(make([]byte, 8))
+	_, _ = hasher.Write(hashed)
+	copy(h, hasher.Sum(nil))
+
+	db[len(db)-1] = 0x01
+	mgf1XOR(db, hash, h)
+	db[0] &= 0xff >> (8*emLen - emBits)
+
+	return em, nil
+}
+
+// mgf1XOR xors out with the MGF1 mask of seed
+func mgf1XOR(out []byte, hash crypto.Hash, seed []byte) {
+	var counter [4]byte
+	for done := 0; done < len(out); {
+		hasher := hash.New()
+		_, _ = hasher.Write(seed)
+		_, _ = hasher.Write(counter[:])
+		for _, b := range hasher.Sum(nil) {
+			if done == len(out) {
+				break
+			}
+			out[done] ^= b
+			done++
+		}
+		for i := 3; i >= 0; i-- {
+			if counter[i]++; counter[i] != 0 {
+				break
+			}
+		}
+	}
+}
+
+// pssSignNoSalt signs an RSA-PSS signature with an empty salt, which only
+// works with a *rsa.PrivateKey since Go has no way to ask a crypto.Signer
+// for it
+func pssSignNoSalt(signer crypto.Signer, hash crypto.Hash, hashed []byte) ([]byte, error) {
+	priv, ok := signer.(*rsa.PrivateKey)
+	if !ok {
+		return nil, newCryptoError(domexception.NotSupportedError, "RsaPssParams: a saltLength of 0 needs an *rsa.PrivateKey, got %T", signer)
+	}
+
+	n := priv.N
+	em, err := pssEncodeNoSalt(hash, hashed, n.BitLen()-1)
+	if err != nil {
+		return nil, err
+	}
+	m := new(big.Int).SetBytes(em)
+	e := big.NewInt(int64(priv.E))
+
+	// blind m so the time of the exponentiation doesn't depend on it
+	var r, rInv *big.Int
+	for {
+		if r, err = rand.Int(rand.Reader, n); err != nil {
+			return nil, newCryptoError(domexception.OperationError, "%v", err)
+		}
+		if r.Sign() > 0 {
+			if rInv = new(big.Int).ModInverse(r, n); rInv != nil {
+				break
+			}
+		}
+	}
+	c := new(big.Int).Exp(r, e, n)
+	c.Mul(c, m).Mod(c, n)
+	sig := c.Exp(c, priv.D, n)
+	sig.Mul(sig, rInv).Mod(sig, n)
+
+	if new(big.Int).Exp(sig, e, n).Cmp(m) != 0 {
+		return nil, newCryptoError(domexception.OperationError, "RSA-PSS: signature check failed")
+	}
+
+	out := make([]byte, (n.BitLen()+7)/8)
+	return sig.FillBytes(out), nil
+}
+
+// pssVerifyNoSalt implements RSASSA-PSS-VERIFY of RFC 8017 with an empty salt
+func pssVerifyNoSalt(publicKey *rsa.PublicKey, hash crypto.Hash, hashed []byte, signature []byte) bool {
+	n := publicKey.N
+	if len(signature) != (n.BitLen()+7)/8 {
+		return false
+	}
+	s := new(big.Int).SetBytes(signature)
+	if s.Cmp(n) >= 0 {
+		return false
+	}
+	m := s.Exp(s, big.NewInt(int64(publicKey.E)), n)
+
+	emBits := n.BitLen() - 1
+	emLen := (emBits + 7) / 8
+	if m.BitLen() > emBits {
+		return false
+	}
+
+	expected, err := pssEncodeNoSalt(hash, hashed, emBits)
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(m.FillBytes(make([]byte, emLen)), expected) == 1
+}
+
+// rsaSign signs with a *rsa.PrivateKey or any crypto.Signer of an RSA key
+func rsaSign(params *signParams, key *cryptoKeyArg, raw interface{}, data []byte) ([]byte, error) {
+	signer, ok := raw.(crypto.Signer)
+	if !ok {
+		return nil, newCryptoError(domexception.InvalidAccessError, "expected an RSA private key, got %T", raw)
+	}
+	if _, ok := signer.Public().(*rsa.PublicKey); !ok {
+		return nil, newCryptoError(domexception.InvalidAccessError, "expected an RSA private key, got %T", raw)
+	}
+
+	hash, err := rsaHash(key, params.Hash.Name)
+	if err != nil {
+		return nil, err
+	}
+	hasher := hash.New()
+	_, _ = hasher.Write(data)
+	hashed := hasher.Sum(nil)
+
+	if params.Name == string(RSA_PSS) {
+		if *params.SaltLength == 0 {
+			return pssSignNoSalt(signer, hash, hashed)
+		}
+		return signer.Sign(rand.Reader, hashed, pssOptions(params, hash))
+	}
+
+	return signer.Sign(rand.Reader, hashed, hash)
+}
+
+func rsaVerify(params *signParams, key *cryptoKeyArg, raw interface{}, signature []byte, data []byte) (bool, error) {
+	publicKey, ok := raw.(*rsa.PublicKey)
+	if !ok {
+		return false, newCryptoError(domexception.InvalidAccessError, "expected an RSA public key, got %T", raw)
+	}
+
+	hash, err := rsaHash(key, params.Hash.Name)
+	if err != nil {
+		return false, err
+	}
+	hasher := hash.New()
+	_, _ = hasher.Write(data)
+	hashed := hasher.Sum(nil)
+
+	if params.Name == string(RSA_PSS) {
+		if *params.SaltLength == 0 {
+			return pssVerifyNoSalt(publicKey, hash, hashed, signature), nil
+		}
+		return rsa.VerifyPSS(publicKey, hash, hashed, signature, pssOptions(params, hash)) == nil, nil
+	}
+
+	return rsa.VerifyPKCS1v15(publicKey, hash, hashed, signature) == nil, nil
+}
+
+// oaepHash returns the hash of an RSA-OAEP key, RSA-OAEP-256 implies SHA-256
+// and RSA-OAEP defaults to SHA-1
+func oaepHash(params *cipherParams, key *cryptoKeyArg) (crypto.Hash, error) {
+	fallback := "SHA-1"
+	if _, hash := algorithmFamily(params.Name); hash != "" {
+		fallback = hash
+	}
+	return rsaHash(key, fallback)
+}
+
+func rsaEncrypt(params *cipherParams, key *cryptoKeyArg, raw interface{}, data []byte) ([]byte, error) {
+	publicKey, ok := raw.(*rsa.PublicKey)
 	if !ok {
-		return nil, fmt.Errorf("expected ras key, got %T", rawkey)
+		return nil, newCryptoError(domexception.InvalidAccessError, "expected an RSA public key, got %T", raw)
+	}
+
+	hash, err := oaepHash(params, key)
+	if err != nil {
+		return nil, err
 	}
 
-	return rsa, nil
+	return rsa.EncryptOAEP(hash.New(), rand.Reader, publicKey, data, params.Label)
 }
 
-func parseKeySet(keySetDataBytes []byte) ([]*rsa.PublicKey, error) {
-	set, err := jwk.Parse(keySetDataBytes)
+// rsaDecrypt decrypts with a *rsa.PrivateKey or any crypto.Decrypter of an RSA key
+func rsaDecrypt(params *cipherParams, key *cryptoKeyArg, raw interface{}, data []byte) ([]byte, error) {
+	decrypter, ok := raw.(crypto.Decrypter)
+	if !ok {
+		return nil, newCryptoError(domexception.InvalidAccessError, "expected an RSA private key, got %T", raw)
+	}
+	if _, ok := decrypter.Public().(*rsa.PublicKey); !ok {
+		return nil, newCryptoError(domexception.InvalidAccessError, "expected an RSA private key, got %T", raw)
+	}
+
+	hash, err := oaepHash(params, key)
 	if err != nil {
-		return nil, fmt.Errorf("error parsing keySetDataBytes: %#v", err)
+		return nil, err
+	}
+
+	return decrypter.Decrypt(rand.Reader, data, &rsa.OAEPOptions{Hash: hash, Label: params.Label})
+}
+
+// importRSAKey parses a public jwk, a key set contributes its first RSA key
+func rsaUsages(name string) (public []string, private []string) {
+	if name == string(RSA_OAEP) || name == string(RSA_OAEP_256) {
+		return []string{"encrypt", "wrapKey"}, []string{"decrypt", "unwrapKey"}
 	}
-	result := make([]*rsa.PublicKey, 0)
-	for it := set.Iterate(context.Background()); it.Next(context.Background()); {
-		pair := it.Pair()
-		key := pair.Value.(jwk.Key)
+	return []string{"verify"}, []string{"sign"}
+}
 
-		var rawkey interface{} // This is the raw key, like *rsa.PrivateKey or *ecdsa.PrivateKey
-		if err := key.Raw(&rawkey); err != nil {
-			return nil, fmt.Errorf("failed to create public key: %#v", err)
+// importRSAKey imports spki and pkcs8 keys, falling back to the PKCS #1
+// encoding of "RSA PUBLIC KEY" and "RSA PRIVATE KEY" PEM blocks, and jwk
+func importRSAKey(format string, keyData []byte, algorithm *RSAAlgoOut, extractable bool, usages []string) (interface{}, string, error) {
+	var (
+		key interface{}
+		err error
+	)
+	switch format {
+	case "spki":
+		if key, err = x509.ParsePKIXPublicKey(keyData); err != nil {
+			if key, err = x509.ParsePKCS1PublicKey(keyData); err != nil {
+				return nil, "", newCryptoError(domexception.DataError, "invalid spki: %v", err)
+			}
+		}
+	case "pkcs8":
+		if key, err = x509.ParsePKCS8PrivateKey(keyData); err != nil {
+			if key, err = x509.ParsePKCS1PrivateKey(keyData); err != nil {
+				return nil, "", newCryptoError(domexception.DataError, "invalid pkcs8: %v", err)
+			}
 		}
-		//fmt.Println("=>", key.KeyID())
-		// We know this is an RSA Key so...
-		rsa, ok := rawkey.(*rsa.PublicKey)
-		if !ok {
-			fmt.Printf("expected ras key, got %T", rawkey)
-		} else {
-			// append the key to the result list
-			result = append(result, rsa)
-			return result, nil
+	case "jwk":
+		if key, err = parseRSAJWK(keyData, algorithm, extractable, usages); err != nil {
+			return nil, "", err
 		}
+	default:
+		return nil, "", newCryptoError(domexception.NotSupportedError, "format %q not supported for %s keys", format, algorithm.Name)
 	}
-	if len(result) < 1 {
-		return nil, fmt.Errorf("failed to parse any public key from ketset: %s", keySetDataBytes)
+
+	public, private := rsaUsages(algorithm.Name)
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if err := checkUsagesAllowed(algorithm.Name, usages, public); err != nil {
+			return nil, "", err
+		}
+		setRSAKeyAlgorithm(algorithm, k)
+		return k, "public", nil
+	case *rsa.PrivateKey:
+		if err := k.Validate(); err != nil {
+			return nil, "", newCryptoError(domexception.DataError, "invalid RSA private key: %v", err)
+		}
+		if err := checkKeyUsages(algorithm.Name, usages, private...); err != nil {
+			return nil, "", err
+		}
+		setRSAKeyAlgorithm(algorithm, &k.PublicKey)
+		return k, "private", nil
+	default:
+		return nil, "", newCryptoError(domexception.DataError, "expected an RSA key, got %T", key)
+	}
+}
+
+func parseRSAJWK(keyData []byte, algorithm *RSAAlgoOut, extractable bool, usages []string) (interface{}, error) {
+	k := &jsonWebKey{}
+	if err := json.Unmarshal(keyData, k); err != nil {
+		return nil, newCryptoError(domexception.DataError, "invalid jwk: %v", err)
+	}
+	if k.Kty != "RSA" {
+		return nil, newCryptoError(domexception.DataError, "expected jwk kty \"RSA\", got %q", k.Kty)
+	}
+	if k.Alg != "" && algorithm.Hash.Name != "" && k.Alg != rsaJWKAlg(algorithm.Name, algorithm.Hash.Name) {
+		return nil, newCryptoError(domexception.DataError, "jwk alg %q does not match %s with %s", k.Alg, algorithm.Name, algorithm.Hash.Name)
+	}
+	use := "sig"
+	if algorithm.Name == string(RSA_OAEP) || algorithm.Name == string(RSA_OAEP_256) {
+		use = "enc"
+	}
+	if err := k.checkImport(use, extractable, usages); err != nil {
+		return nil, err
+	}
+
+	key, err := parseKey(keyData)
+	if err != nil {
+		return nil, newCryptoError(domexception.DataError, "%v", err)
+	}
+	return key, nil
+}
+
+// setRSAKeyAlgorithm describes the imported key in the RsaHashedKeyAlgorithm
+func setRSAKeyAlgorithm(algorithm *RSAAlgoOut, key *rsa.PublicKey) {
+	algorithm.ModulusLength = key.N.BitLen()
+	algorithm.PublicExponent = make(map[string]uint8)
+	for i, b := range big.NewInt(int64(key.E)).Bytes() {
+		algorithm.PublicExponent[strconv.Itoa(i)] = b
+	}
+}
+
+func (c *Crypto) generateRSAKeyPair(algorithm *RSAAlgoOut, extractable bool, usages []string) (*CryptoKeyPair, error) {
+	// The GenerateKey method takes in a reader that returns random bits, and
+	// the number of bits
+	privateKey, err := rsa.GenerateKey(rand.Reader, algorithm.ModulusLength) //2048 by default
+	if err != nil {
+		return nil, fmt.Errorf("error generating RSA key: %v", err)
+	}
+
+	return newCryptoKeyPair(privateKey, &privateKey.PublicKey, algorithm, extractable, usages), nil
+}
+
+// rsaJWKAlg returns the jwk "alg" of an RSA key, like RS256 or RSA-OAEP-256
+func rsaJWKAlg(name string, hashName string) string {
+	bits := strings.TrimPrefix(hashName, "SHA-")
+	switch name {
+	case string(RSA1_5):
+		return "RS" + bits
+	case string(RSA_PSS):
+		return "PS" + bits
+	case string(RSA_OAEP_256):
+		return "RSA-OAEP-256"
+	default:
+		if bits == "1" || bits == "" {
+			return "RSA-OAEP"
+		}
+		return "RSA-OAEP-" + bits
+	}
+}
+
+func encodeJWKInt(n *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(n.Bytes())
+}
+
+func exportRSAKey(format string, key *cryptoKeyArg, raw interface{}) ([]byte, error) {
+	var pub *rsa.PublicKey
+	priv, isPrivate := raw.(*rsa.PrivateKey)
+	if isPrivate {
+		pub = &priv.PublicKey
+	} else if pub, _ = raw.(*rsa.PublicKey); pub == nil {
+		return nil, newCryptoError(domexception.InvalidAccessError, "expected an RSA key, got %T", raw)
+	}
+
+	switch format {
+	case "spki":
+		if isPrivate {
+			return nil, newCryptoError(domexception.InvalidAccessError, "spki exports public keys only")
+		}
+		return x509.MarshalPKIXPublicKey(pub)
+	case "pkcs8":
+		if !isPrivate {
+			return nil, newCryptoError(domexception.InvalidAccessError, "pkcs8 exports private keys only")
+		}
+		return x509.MarshalPKCS8PrivateKey(priv)
+	case "jwk":
+		jwk := &jsonWebKey{
+			Kty:    "RSA",
+			Alg:    rsaJWKAlg(key.Algorithm.Name, key.Algorithm.Hash.Name),
+			N:      encodeJWKInt(pub.N),
+			E:      encodeJWKInt(big.NewInt(int64(pub.E))),
+			KeyOps: key.Usages,
+			Ext:    &key.Extractable,
+		}
+		if isPrivate {
+			if len(priv.Primes) != 2 {
+				return nil, newCryptoError(domexception.NotSupportedError, "multi-prime RSA keys can't be exported as jwk")
+			}
+			priv.Precompute()
+			jwk.D = encodeJWKInt(priv.D)
+			jwk.P = encodeJWKInt(priv.Primes[0])
+			jwk.Q = encodeJWKInt(priv.Primes[1])
+			jwk.DP = encodeJWKInt(priv.Precomputed.Dp)
+			jwk.DQ = encodeJWKInt(priv.Precomputed.Dq)
+			jwk.QI = encodeJWKInt(priv.Precomputed.Qinv)
+		}
+		return json.Marshal(jwk)
+	default:
+		return nil, newCryptoError(domexception.NotSupportedError, "format %q not supported for %s keys", format, key.Algorithm.Name)
 	}
-	return result, nil
 }
@@ -0,0 +1,234 @@
+/*
+ * Copyright (c) 2021 Twintag
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package crypto
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/esoptra/v8go"
+	"github.com/esoptra/v8go-polyfills/domexception"
+	"github.com/esoptra/v8go-polyfills/eventloop"
+)
+
+// signParams holds the algorithm parameters of sign and verify
+type signParams struct {
+	Name       string                  `json:"name"`
+	SaltLength *int                    `json:"saltLength"` // RSA-PSS
+	Hash       HashAlgorithmIdentifier `json:"hash"`
+}
+
+// getSignParams normalizes the algorithm of sign or verify and checks the
+// members of the EcdsaParams and RsaPssParams dictionaries
+func getSignParams(v *v8go.Value, op string) (*signParams, error) {
+	name, err := normalizeAlgorithm(v, op)
+	if err != nil {
+		return nil, err
+	}
+
+	params := &signParams{}
+	if v.IsObject() {
+		data, err := v.MarshalJSON()
+		if err != nil {
+			return nil, newCryptoError(typeError, "error marshalling algorithm: %v", err)
+		}
+		if err := json.Unmarshal(data, params); err != nil {
+			return nil, newCryptoError(typeError, "error parsing algorithm: %v", err)
+		}
+	}
+	params.Name = name
+
+	switch name {
+	case string(ECDSA):
+		if err := normalizeHash(name, &params.Hash); err != nil {
+			return nil, err
+		}
+	case string(RSA_PSS):
+		if params.SaltLength == nil {
+			return nil, newCryptoError(typeError, "%s params: saltLength is required", name)
+		}
+		if *params.SaltLength < 0 {
+			return nil, newCryptoError(typeError, "%s params: saltLength must not be negative", name)
+		}
+	}
+
+	return params, nil
+}
+
+func (c *Crypto) sign(params *signParams, key *cryptoKeyArg, raw interface{}, data []byte) ([]byte, error) {
+	switch params.Name {
+	case string(RSA1_5), string(RSA_PSS):
+		return rsaSign(params, key, raw, data)
+	case string(HMAC):
+		return hmacSign(key, raw, data)
+	case string(ECDSA):
+		return ecdsaSign(params, raw, data)
+	case string(Ed25519):
+		return ed25519Sign(raw, data)
+	default:
+		return nil, newCryptoError(domexception.NotSupportedError, "%s can't be used to sign", params.Name)
+	}
+}
+
+func (c *Crypto) verify(params *signParams, key *cryptoKeyArg, raw interface{}, signature []byte, data []byte) (bool, error) {
+	switch params.Name {
+	case string(RSA1_5), string(RSA_PSS):
+		return rsaVerify(params, key, raw, signature, data)
+	case string(HMAC):
+		return hmacVerify(key, raw, signature, data)
+	case string(ECDSA):
+		return ecdsaVerify(params, raw, signature, data)
+	case string(Ed25519):
+		return ed25519Verify(raw, signature, data)
+	default:
+		return false, newCryptoError(domexception.NotSupportedError, "%s can't be used to verify", params.Name)
+	}
+}
+
+// getSignArgs validates the algorithm and key arguments shared by sign and verify
+func (c *Crypto) getSignArgs(ctx *v8go.Context, args []*v8go.Value, usage string) (*signParams, *cryptoKeyArg, interface{}, error) {
+	params, err := getSignParams(args[0], usage)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	key, raw, err := c.getCryptoKey(ctx, args[1])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if err := key.checkUsage(params.Name, usage); err != nil {
+		return nil, nil, nil, err
+	}
+
+	return params, key, raw, nil
+}
+
+// cryptoSignFunctionCallback implements https://developer.mozilla.org/en-US/docs/Web/API/SubtleCrypto/sign
+// const signature = crypto.subtle.sign(algorithm, key, data);
+// signature is a Promise that fulfills with an ArrayBuffer containing the signature.
+func (c *Crypto) cryptoSignFunctionCallback() v8go.FunctionCallback {
+	return func(info *v8go.FunctionCallbackInfo) *v8go.Value {
+		ctx := info.Context()
+		iso := ctx.Isolate()
+		resolver, err := v8go.NewPromiseResolver(ctx)
+		if err != nil {
+			strErr, _ := v8go.NewValue(iso, fmt.Sprintf("error creating newPromiseResolver with ctx: %#v", err))
+			return iso.ThrowException(strErr)
+		}
+
+		args := info.Args()
+		if len(args) < 3 {
+			resolver.Reject(newTypeError(ctx, "Failed to execute 'sign': 3 arguments required, but only %d present", len(args)))
+			return resolver.GetPromise().Value
+		}
+
+		params, key, raw, err := c.getSignArgs(ctx, args, "sign")
+		if err != nil {
+			resolver.Reject(rejectValue(ctx, "sign", err))
+			return resolver.GetPromise().Value
+		}
+
+		data, err := getBufferSource(args[2])
+		if err != nil {
+			resolver.Reject(newTypeError(ctx, "Failed to execute 'sign': %v", err))
+			return resolver.GetPromise().Value
+		}
+
+		eventloop.For(ctx).Go(func() func() {
+			signature, err := c.sign(params, key, raw, data)
+			return func() {
+				if err != nil {
+					resolver.Reject(rejectValue(ctx, "sign", err))
+					return
+				}
+
+				v, err := newArrayBuffer(ctx, signature)
+				if err != nil {
+					resolver.Reject(rejectValue(ctx, "sign", err))
+					return
+				}
+				resolver.Resolve(v)
+			}
+		})
+
+		return resolver.GetPromise().Value
+	}
+}
+
+// cryptoVerifyFunctionCallback implements https://developer.mozilla.org/en-US/docs/Web/API/SubtleCrypto/verify
+// const result = crypto.subtle.verify(algorithm, key, signature, data);
+// result is a Promise with a Boolean: true if the signature is valid, false otherwise.
+func (c *Crypto) cryptoVerifyFunctionCallback() v8go.FunctionCallback {
+	return func(info *v8go.FunctionCallbackInfo) *v8go.Value {
+		ctx := info.Context()
+		iso := ctx.Isolate()
+		resolver, err := v8go.NewPromiseResolver(ctx)
+		if err != nil {
+			strErr, _ := v8go.NewValue(iso, fmt.Sprintf("error creating newPromiseResolver with ctx: %#v", err))
+			return iso.ThrowException(strErr)
+		}
+
+		args := info.Args()
+		if len(args) < 4 {
+			resolver.Reject(newTypeError(ctx, "Failed to execute 'verify': 4 arguments required, but only %d present", len(args)))
+			return resolver.GetPromise().Value
+		}
+
+		params, key, raw, err := c.getSignArgs(ctx, args, "verify")
+		if err != nil {
+			resolver.Reject(rejectValue(ctx, "verify", err))
+			return resolver.GetPromise().Value
+		}
+
+		signature, err := getBufferSource(args[2])
+		if err != nil {
+			resolver.Reject(newTypeError(ctx, "Failed to execute 'verify': %v", err))
+			return resolver.GetPromise().Value
+		}
+		data, err := getBufferSource(args[3])
+		if err != nil {
+			resolver.Reject(newTypeError(ctx, "Failed to execute 'verify': %v", err))
+			return resolver.GetPromise().Value
+		}
+
+		eventloop.For(ctx).Go(func() func() {
+			passed, err := c.verify(params, key, raw, signature, data)
+			return func() {
+				if err != nil {
+					resolver.Reject(rejectValue(ctx, "verify", err))
+					return
+				}
+
+				v, err := v8go.NewValue(iso, passed)
+				if err != nil {
+					resolver.Reject(rejectValue(ctx, "verify", err))
+					return
+				}
+				resolver.Resolve(v)
+			}
+		})
+
+		return resolver.GetPromise().Value
+	}
+}
@@ -0,0 +1,228 @@
+/*
+ * Copyright (c) 2021 Twintag
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package crypto
+
+import (
+	"fmt"
+
+	"github.com/esoptra/v8go"
+	"github.com/esoptra/v8go-polyfills/domexception"
+	"github.com/esoptra/v8go-polyfills/eventloop"
+)
+
+// wrap encrypts an exported key, AES-KW is dedicated to wrapping while the
+// encryption algorithms wrap like they encrypt
+func (c *Crypto) wrap(params *cipherParams, key *cryptoKeyArg, raw interface{}, data []byte) ([]byte, error) {
+	switch params.Name {
+	case string(AES_KW):
+		return aesKWWrap(raw, data)
+	case string(RSA_OAEP), string(RSA_OAEP_256), string(AES_GCM), string(AES_CBC), string(AES_CTR):
+		return c.encrypt(params, key, raw, data)
+	default:
+		return nil, newCryptoError(domexception.NotSupportedError, "%s can't be used to wrap keys", params.Name)
+	}
+}
+
+func (c *Crypto) unwrap(params *cipherParams, key *cryptoKeyArg, raw interface{}, data []byte) ([]byte, error) {
+	switch params.Name {
+	case string(AES_KW):
+		return aesKWUnwrap(raw, data)
+	case string(RSA_OAEP), string(RSA_OAEP_256), string(AES_GCM), string(AES_CBC), string(AES_CTR):
+		return c.decrypt(params, key, raw, data)
+	default:
+		return nil, newCryptoError(domexception.NotSupportedError, "%s can't be used to unwrap keys", params.Name)
+	}
+}
+
+// getWrapArgs validates the wrapping key and algorithm arguments of wrapKey and unwrapKey
+func (c *Crypto) getWrapArgs(ctx *v8go.Context, keyArg *v8go.Value, algorithmArg *v8go.Value, usage string) (*cipherParams, *cryptoKeyArg, interface{}, error) {
+	// the encryption algorithms wrap and unwrap with encrypt and decrypt
+	fallback := "encrypt"
+	if usage == "unwrapKey" {
+		fallback = "decrypt"
+	}
+	params, err := getCipherParams(algorithmArg, usage, fallback)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	key, raw, err := c.getCryptoKey(ctx, keyArg)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if err := key.checkUsage(params.Name, usage); err != nil {
+		return nil, nil, nil, err
+	}
+
+	return params, key, raw, nil
+}
+
+// cryptoWrapKeyFunctionCallback implements https://developer.mozilla.org/en-US/docs/Web/API/SubtleCrypto/wrapKey
+// const result = crypto.subtle.wrapKey(format, key, wrappingKey, wrapAlgo);
+// result is a Promise that fulfills with an ArrayBuffer containing the encrypted exported key.
+func (c *Crypto) cryptoWrapKeyFunctionCallback() v8go.FunctionCallback {
+	return func(info *v8go.FunctionCallbackInfo) *v8go.Value {
+		ctx := info.Context()
+		iso := ctx.Isolate()
+		resolver, err := v8go.NewPromiseResolver(ctx)
+		if err != nil {
+			strErr, _ := v8go.NewValue(iso, fmt.Sprintf("error creating newPromiseResolver with ctx: %#v", err))
+			return iso.ThrowException(strErr)
+		}
+
+		args := info.Args()
+		if len(args) < 4 {
+			resolver.Reject(newTypeError(ctx, "Failed to execute 'wrapKey': 4 arguments required, but only %d present", len(args)))
+			return resolver.GetPromise().Value
+		}
+
+		format := args[0].String()
+		switch format {
+		case "raw", "spki", "pkcs8", "jwk":
+		default:
+			resolver.Reject(newTypeError(ctx, "Failed to execute 'wrapKey': unknown key format %q", format))
+			return resolver.GetPromise().Value
+		}
+
+		key, raw, err := c.getCryptoKey(ctx, args[1])
+		if err != nil {
+			resolver.Reject(rejectValue(ctx, "wrapKey", err))
+			return resolver.GetPromise().Value
+		}
+
+		params, wrappingKey, wrappingRaw, err := c.getWrapArgs(ctx, args[2], args[3], "wrapKey")
+		if err != nil {
+			resolver.Reject(rejectValue(ctx, "wrapKey", err))
+			return resolver.GetPromise().Value
+		}
+
+		eventloop.For(ctx).Go(func() func() {
+			data, err := c.exportKey(format, key, raw)
+			var wrapped []byte
+			if err == nil {
+				wrapped, err = c.wrap(params, wrappingKey, wrappingRaw, data)
+			}
+
+			return func() {
+				if err != nil {
+					resolver.Reject(rejectValue(ctx, "wrapKey", err))
+					return
+				}
+
+				v, err := newArrayBuffer(ctx, wrapped)
+				if err != nil {
+					resolver.Reject(rejectValue(ctx, "wrapKey", err))
+					return
+				}
+				resolver.Resolve(v)
+			}
+		})
+
+		return resolver.GetPromise().Value
+	}
+}
+
+// cryptoUnwrapKeyFunctionCallback implements https://developer.mozilla.org/en-US/docs/Web/API/SubtleCrypto/unwrapKey
+// const result = crypto.subtle.unwrapKey(format, wrappedKey, unwrappingKey, unwrapAlgo, unwrappedKeyAlgo, extractable, keyUsages);
+// result is a Promise that fulfills with the unwrapped key as a CryptoKey object.
+func (c *Crypto) cryptoUnwrapKeyFunctionCallback() v8go.FunctionCallback {
+	return func(info *v8go.FunctionCallbackInfo) *v8go.Value {
+		ctx := info.Context()
+		iso := ctx.Isolate()
+		resolver, err := v8go.NewPromiseResolver(ctx)
+		if err != nil {
+			strErr, _ := v8go.NewValue(iso, fmt.Sprintf("error creating newPromiseResolver with ctx: %#v", err))
+			return iso.ThrowException(strErr)
+		}
+
+		args := info.Args()
+		if len(args) < 7 {
+			resolver.Reject(newTypeError(ctx, "Failed to execute 'unwrapKey': 7 arguments required, but only %d present", len(args)))
+			return resolver.GetPromise().Value
+		}
+
+		format := args[0].String()
+		switch format {
+		case "raw", "spki", "pkcs8", "jwk":
+		default:
+			resolver.Reject(newTypeError(ctx, "Failed to execute 'unwrapKey': unknown key format %q", format))
+			return resolver.GetPromise().Value
+		}
+
+		wrapped, err := getBufferSource(args[1])
+		if err != nil {
+			resolver.Reject(newTypeError(ctx, "Failed to execute 'unwrapKey': %v", err))
+			return resolver.GetPromise().Value
+		}
+
+		params, unwrappingKey, unwrappingRaw, err := c.getWrapArgs(ctx, args[2], args[3], "unwrapKey")
+		if err != nil {
+			resolver.Reject(rejectValue(ctx, "unwrapKey", err))
+			return resolver.GetPromise().Value
+		}
+
+		algorithm, _, err := getAlgorithm(args[4], "importKey")
+		if err != nil {
+			resolver.Reject(rejectValue(ctx, "unwrapKey", err))
+			return resolver.GetPromise().Value
+		}
+
+		extractable := args[5] //boolean
+		if !extractable.IsBoolean() {
+			resolver.Reject(newTypeError(ctx, "Failed to execute 'unwrapKey': expected extractable argument as boolean type"))
+			return resolver.GetPromise().Value
+		}
+
+		keyUsages, err := getKeyUsages(args[6])
+		if err != nil {
+			resolver.Reject(rejectValue(ctx, "unwrapKey", err))
+			return resolver.GetPromise().Value
+		}
+
+		isExtractable := extractable.Boolean()
+		eventloop.For(ctx).Go(func() func() {
+			data, err := c.unwrap(params, unwrappingKey, unwrappingRaw, wrapped)
+			var key *CryptoKey
+			if err == nil {
+				key, err = c.importKey(format, data, algorithm, isExtractable, keyUsages)
+			}
+
+			return func() {
+				if err != nil {
+					resolver.Reject(rejectValue(ctx, "unwrapKey", err))
+					return
+				}
+
+				v, err := c.newCryptoKeyValue(ctx, key)
+				if err != nil {
+					resolver.Reject(rejectValue(ctx, "unwrapKey", err))
+					return
+				}
+				resolver.Resolve(v)
+			}
+		})
+
+		return resolver.GetPromise().Value
+	}
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) 2021 Twintag
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package domexception
+
+import (
+	_ "embed"
+	"fmt"
+
+	"github.com/esoptra/v8go"
+)
+
+//go:embed domexception.js
+var domExceptionPolyfill string
+
+// Names of the DOMException errors raised by the polyfills
+const (
+	AbortError         = "AbortError"
+	DataError          = "DataError"
+	InvalidAccessError = "InvalidAccessError"
+	NotSupportedError  = "NotSupportedError"
+	OperationError     = "OperationError"
+	QuotaExceededError = "QuotaExceededError"
+	SyntaxError        = "SyntaxError"
+	TimeoutError       = "TimeoutError"
+	TypeMismatchError  = "TypeMismatchError"
+)
+
+// New creates a `new DOMException(message, name)` in ctx, injecting the
+// polyfill first when the context has no DOMException yet.
+func New(ctx *v8go.Context, name, message string) (*v8go.Object, error) {
+	ctor, err := ctx.Global().Get("DOMException")
+	if err != nil {
+		return nil, err
+	}
+
+	if !ctor.IsFunction() {
+		if err := InjectTo(ctx); err != nil {
+			return nil, err
+		}
+		if ctor, err = ctx.Global().Get("DOMException"); err != nil {
+			return nil, err
+		}
+	}
+
+	fn, err := ctor.AsFunction()
+	if err != nil {
+		return nil, err
+	}
+
+	iso := ctx.Isolate()
+	msgVal, err := v8go.NewValue(iso, message)
+	if err != nil {
+		return nil, err
+	}
+	nameVal, err := v8go.NewValue(iso, name)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := fn.NewInstance(msgVal, nameVal)
+	if err != nil {
+		return nil, fmt.Errorf("v8go-polyfills/domexception: %w", err)
+	}
+
+	return obj, nil
+}
@@ -0,0 +1,62 @@
+(function (global) {
+  "use strict";
+
+  if (typeof global.DOMException === "function") {
+    return;
+  }
+
+  // https://webidl.spec.whatwg.org/#dfn-error-names-table
+  const legacyCodes = [
+    ["IndexSizeError", "INDEX_SIZE_ERR", 1],
+    ["HierarchyRequestError", "HIERARCHY_REQUEST_ERR", 3],
+    ["WrongDocumentError", "WRONG_DOCUMENT_ERR", 4],
+    ["InvalidCharacterError", "INVALID_CHARACTER_ERR", 5],
+    ["NoModificationAllowedError", "NO_MODIFICATION_ALLOWED_ERR", 7],
+    ["NotFoundError", "NOT_FOUND_ERR", 8],
+    ["NotSupportedError", "NOT_SUPPORTED_ERR", 9],
+    ["InvalidStateError", "INVALID_STATE_ERR", 11],
+    ["SyntaxError", "SYNTAX_ERR", 12],
+    ["InvalidModificationError", "INVALID_MODIFICATION_ERR", 13],
+    ["NamespaceError", "NAMESPACE_ERR", 14],
+    ["InvalidAccessError", "INVALID_ACCESS_ERR", 15],
+    ["TypeMismatchError", "TYPE_MISMATCH_ERR", 17],
+    ["SecurityError", "SECURITY_ERR", 18],
+    ["NetworkError", "NETWORK_ERR", 19],
+    ["AbortError", "ABORT_ERR", 20],
+    ["URLMismatchError", "URL_MISMATCH_ERR", 21],
+    ["QuotaExceededError", "QUOTA_EXCEEDED_ERR", 22],
+    ["TimeoutError", "TIMEOUT_ERR", 23],
+    ["InvalidNodeTypeError", "INVALID_NODE_TYPE_ERR", 24],
+    ["DataCloneError", "DATA_CLONE_ERR", 25],
+  ];
+
+  const codes = {};
+
+  class DOMException extends Error {
+    constructor(message = "", name = "Error") {
+      super(String(message));
+
+      Object.defineProperty(this, "name", {
+        value: String(name),
+        configurable: true,
+        writable: true,
+      });
+    }
+
+    get code() {
+      return codes[this.name] || 0;
+    }
+  }
+
+  for (const [name, constant, code] of legacyCodes) {
+    codes[name] = code;
+    Object.defineProperty(DOMException, constant, { value: code, enumerable: true });
+    Object.defineProperty(DOMException.prototype, constant, { value: code, enumerable: true });
+  }
+
+  Object.defineProperty(global, "DOMException", {
+    value: DOMException,
+    configurable: true,
+    writable: true,
+  });
+})(globalThis);
@@ -0,0 +1,81 @@
+/*
+ * Copyright (c) 2021 Twintag
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package domexception
+
+import (
+	"testing"
+
+	"github.com/esoptra/v8go"
+)
+
+func TestInjectTo(t *testing.T) {
+	t.Parallel()
+
+	iso := v8go.NewIsolate()
+	ctx := v8go.NewContext(iso)
+
+	if err := InjectTo(ctx); err != nil {
+		t.Error(err)
+		return
+	}
+
+	val, err := ctx.RunScript(`
+	const e = new DOMException("stopped", "AbortError");
+	[e instanceof Error, e.name, e.message, e.code, DOMException.ABORT_ERR, new DOMException().name].join(",")`, "domexception.js")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if s := val.String(); s != "true,AbortError,stopped,20,20,Error" {
+		t.Errorf("unexpected result %q", s)
+	}
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	iso := v8go.NewIsolate()
+	ctx := v8go.NewContext(iso)
+
+	obj, err := New(ctx, TimeoutError, "too slow")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := ctx.Global().Set("err", obj); err != nil {
+		t.Error(err)
+		return
+	}
+
+	val, err := ctx.RunScript(`err instanceof DOMException && err.name === "TimeoutError" && err.code === 23`, "new.js")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !val.Boolean() {
+		t.Error("expected a TimeoutError DOMException")
+	}
+}
@@ -1,5 +1,5 @@
 /*
- * Copyright (c) 2021 Xingwang Liao
+ * Copyright (c) 2021 Twintag
  *
  * Permission is hereby granted, free of charge, to any person obtaining a copy
  * of this software and associated documentation files (the "Software"), to deal
@@ -20,59 +20,25 @@
  * SOFTWARE.
  */
 
-package internal
+package domexception
 
 import (
-	"time"
-)
-
-type FunctionCallback func()
-
-type ClearCallback func(id int32)
-
-type Item struct {
-	ID       int32
-	Done     bool
-	Cleared  bool
-	Interval bool
-	Delay    int32
+	"errors"
+	"fmt"
 
-	ClearCB    ClearCallback
-	FunctionCB FunctionCallback
-}
-
-func (t *Item) Clear() {
-	if !t.Cleared {
-		t.Cleared = true
+	"github.com/esoptra/v8go"
+)
 
-		if t.ClearCB != nil {
-			t.ClearCB(t.ID)
-		}
+// InjectTo defines the DOMException class on the global object, unless
+// the context already has one.
+func InjectTo(ctx *v8go.Context) error {
+	if ctx == nil {
+		return errors.New("v8go-polyfills/domexception: ctx is required")
 	}
 
-	t.Done = true
-}
-
-func (t *Item) Start() {
-	go func() {
-		defer t.Clear() // self clear
-
-		ticker := time.NewTicker(time.Duration(t.Delay) * time.Millisecond)
-		defer ticker.Stop()
-
-		for range ticker.C {
-			if t.Done {
-				break
-			}
-
-			if t.FunctionCB != nil {
-				t.FunctionCB()
-			}
+	if _, err := ctx.RunScript(domExceptionPolyfill, "domexception.js"); err != nil {
+		return fmt.Errorf("v8go-polyfills/domexception: %w", err)
+	}
 
-			if !t.Interval {
-				t.Done = true
-				break
-			}
-		}
-	}()
+	return nil
 }
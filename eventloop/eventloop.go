@@ -0,0 +1,287 @@
+/*
+ * Copyright (c) 2021 Twintag
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+// Package eventloop runs the asynchronous work of the polyfills on the
+// goroutine owning a context. V8 must not be entered from other goroutines, so
+// Go code doing work in the background posts its completion as a task and the
+// host runs the tasks with Run, RunFor or RunOnce. Hosts close the context
+// with Close, which also drops the state the polyfills keep for it.
+package eventloop
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/esoptra/v8go"
+)
+
+// Loop is the event loop of a context
+type Loop struct {
+	ctx *v8go.Context
+
+	mu    sync.Mutex
+	tasks []func()
+	// pending counts the work started with Go and the live timers
+	pending int
+	timers  map[int32]*timer
+	nextID  int32
+	closed  bool
+	ready   chan struct{}
+	// cleanups run when the context is closed
+	cleanups []func()
+}
+
+// loops holds the event loop of each context
+var loops = struct {
+	sync.Mutex
+	m map[*v8go.Context]*Loop
+}{m: make(map[*v8go.Context]*Loop)}
+
+// For returns the event loop of ctx, creating it on first use. While ctx is
+// being closed, For returns its closed loop, which drops the new tasks and
+// timers, rather than a new one. Once ctx is closed, For returns a closed loop
+// too, and releases the loop of a context closed with ctx.Close.
+func For(ctx *v8go.Context) *Loop {
+	loops.Lock()
+	loop, ok := loops.m[ctx]
+	if ok && !contextClosed(ctx) {
+		loops.Unlock()
+		return loop
+	}
+
+	if ok {
+		// the host closed ctx with ctx.Close, not with Close
+		delete(loops.m, ctx)
+		loops.Unlock()
+		loop.release()
+		return loop
+	}
+
+	loop = &Loop{
+		ctx:    ctx,
+		timers: make(map[int32]*timer),
+		nextID: 1,
+		ready:  make(chan struct{}, 1),
+	}
+	if contextClosed(ctx) {
+		loop.closed = true
+	} else {
+		loops.m[ctx] = loop
+	}
+	loops.Unlock()
+	return loop
+}
+
+// contextClosed reports whether ctx.Close was called. v8go doesn't export it,
+// Close clears the pointer to the V8 context.
+func contextClosed(ctx *v8go.Context) bool {
+	ptr := reflect.ValueOf(ctx).Elem().FieldByName("ptr")
+	return ptr.IsValid() && ptr.Kind() == reflect.Ptr && ptr.IsNil()
+}
+
+// Close stops the timers of ctx, drops its tasks, runs the cleanups registered
+// with OnClose and closes ctx. Close the contexts using the polyfills with it
+// instead of ctx.Close, otherwise their loop and per-context state, like the
+// crypto keys, are kept until a polyfill calls For on ctx again.
+func Close(ctx *v8go.Context) {
+	loops.Lock()
+	loop, ok := loops.m[ctx]
+	loops.Unlock()
+
+	if ok {
+		loop.release()
+	}
+
+	ctx.Close()
+
+	loops.Lock()
+	delete(loops.m, ctx)
+	loops.Unlock()
+}
+
+// Context returns the context the loop runs tasks for
+func (l *Loop) Context() *v8go.Context {
+	return l.ctx
+}
+
+// OnClose registers fn to run when the context is closed with Close, before
+// the context itself. Polyfills drop the state they keep per context in fn.
+// fn runs at once when the loop is already closed.
+func (l *Loop) OnClose(fn func()) {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		fn()
+		return
+	}
+	l.cleanups = append(l.cleanups, fn)
+	l.mu.Unlock()
+}
+
+// Post queues task, it is safe to call from any goroutine
+func (l *Loop) Post(task func()) {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return
+	}
+	l.tasks = append(l.tasks, task)
+	l.mu.Unlock()
+
+	l.wake()
+}
+
+// Go runs work on a new goroutine and posts the task it returns, the loop is
+// pending until the task ran. work must not use V8, the task resolves the
+// promises with the result.
+func (l *Loop) Go(work func() func()) {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return
+	}
+	l.pending++
+	l.mu.Unlock()
+
+	go func() {
+		task := work()
+		l.Post(func() {
+			l.done()
+			if task != nil {
+				task()
+			}
+		})
+	}()
+}
+
+// Pending returns the number of queued tasks, work started with Go and live
+// timers. The script is finished when it drops to 0.
+func (l *Loop) Pending() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return len(l.tasks) + l.pending
+}
+
+// Ready receives when tasks are queued, hosts waiting on other channels call
+// RunOnce when it does
+func (l *Loop) Ready() <-chan struct{} {
+	return l.ready
+}
+
+// RunOnce runs the queued tasks, including the ones they queue, with a
+// microtask checkpoint after each of them. It returns the number of tasks run.
+func (l *Loop) RunOnce() int {
+	n := 0
+	for {
+		task := l.next()
+		if task == nil {
+			return n
+		}
+
+		task()
+		l.ctx.PerformMicrotaskCheckpoint()
+		n++
+	}
+}
+
+// Run runs the tasks as they are queued until nothing is pending or ctx is
+// done
+func (l *Loop) Run(ctx context.Context) error {
+	for {
+		l.RunOnce()
+		if l.Pending() == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-l.ready:
+		}
+	}
+}
+
+// RunFor runs the loop like Run for at most d, it returns
+// context.DeadlineExceeded when work is still pending
+func (l *Loop) RunFor(d time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+
+	return l.Run(ctx)
+}
+
+func (l *Loop) next() func() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.tasks) == 0 {
+		return nil
+	}
+	task := l.tasks[0]
+	l.tasks[0] = nil
+	l.tasks = l.tasks[1:]
+	return task
+}
+
+func (l *Loop) done() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.pending > 0 {
+		l.pending--
+	}
+}
+
+// release closes the loop and runs its cleanups, latest first
+func (l *Loop) release() {
+	cleanups := l.close()
+	for i := len(cleanups) - 1; i >= 0; i-- {
+		cleanups[i]()
+	}
+}
+
+// close stops the timers and drops the tasks, it returns the cleanups to run
+func (l *Loop) close() []func() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, t := range l.timers {
+		t.timer.Stop()
+	}
+	cleanups := l.cleanups
+	l.timers = nil
+	l.tasks = nil
+	l.cleanups = nil
+	l.pending = 0
+	l.closed = true
+	return cleanups
+}
+
+func (l *Loop) wake() {
+	select {
+	case l.ready <- struct{}{}:
+	default:
+	}
+}
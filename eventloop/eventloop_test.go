@@ -0,0 +1,224 @@
+/*
+ * Copyright (c) 2021 Twintag
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package eventloop
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/esoptra/v8go"
+)
+
+func TestGo(t *testing.T) {
+	ctx := v8go.NewContext()
+	defer Close(ctx)
+
+	loop := For(ctx)
+	if For(ctx) != loop {
+		t.Fatal("For returned another loop for the same context")
+	}
+
+	var order []string
+	loop.Go(func() func() {
+		time.Sleep(20 * time.Millisecond)
+		return func() { order = append(order, "slow") }
+	})
+	loop.Go(func() func() {
+		return func() { order = append(order, "fast") }
+	})
+	if n := loop.Pending(); n != 2 {
+		t.Fatalf("Pending() = %d, want 2", n)
+	}
+
+	if err := loop.RunFor(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if len(order) != 2 || order[0] != "fast" || order[1] != "slow" {
+		t.Errorf("tasks ran as %v, want [fast slow]", order)
+	}
+	if n := loop.Pending(); n != 0 {
+		t.Errorf("Pending() = %d after Run, want 0", n)
+	}
+}
+
+func TestTimers(t *testing.T) {
+	ctx := v8go.NewContext()
+	defer Close(ctx)
+
+	loop := For(ctx)
+
+	var order []string
+	ticks := 0
+	var id int32
+	id = loop.SetInterval(func() {
+		ticks++
+		if ticks == 3 {
+			loop.ClearInterval(id)
+		}
+	}, 10*time.Millisecond)
+	loop.SetTimeout(func() { order = append(order, "late") }, 50*time.Millisecond)
+	loop.SetTimeout(func() { order = append(order, "early") }, 10*time.Millisecond)
+	cleared := loop.SetTimeout(func() { order = append(order, "cleared") }, 10*time.Millisecond)
+	loop.ClearInterval(cleared)
+	loop.ClearTimeout(cleared)
+
+	if err := loop.RunFor(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if ticks != 3 {
+		t.Errorf("interval ran %d times, want 3", ticks)
+	}
+	if len(order) != 2 || order[0] != "early" || order[1] != "late" {
+		t.Errorf("timeouts ran as %v, want [early late]", order)
+	}
+}
+
+func TestRunForDeadline(t *testing.T) {
+	ctx := v8go.NewContext()
+	defer Close(ctx)
+
+	loop := For(ctx)
+	loop.SetInterval(func() {}, 10*time.Millisecond)
+
+	if err := loop.RunFor(50 * time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("RunFor() = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestClose(t *testing.T) {
+	ctx := v8go.NewContext()
+
+	loop := For(ctx)
+	loop.SetInterval(func() {}, 10*time.Millisecond)
+	loop.Go(func() func() {
+		time.Sleep(20 * time.Millisecond)
+		return func() { t.Error("task of Go ran after Close") }
+	})
+
+	var order []string
+	loop.OnClose(func() { order = append(order, "first") })
+	loop.OnClose(func() {
+		order = append(order, "second")
+		// polyfills called while the context closes don't get a new loop
+		if For(ctx) != loop {
+			t.Error("For created a new loop for a closing context")
+		}
+		if id := For(ctx).SetTimeout(func() {}, time.Millisecond); id != 0 {
+			t.Errorf("SetTimeout() = %d on a closing context, want 0", id)
+		}
+	})
+
+	Close(ctx)
+	if len(order) != 2 || order[0] != "second" || order[1] != "first" {
+		t.Errorf("cleanups ran as %v, want [second first]", order)
+	}
+	if n := loop.Pending(); n != 0 {
+		t.Errorf("Pending() = %d after Close, want 0", n)
+	}
+
+	ran := false
+	loop.OnClose(func() { ran = true })
+	if !ran {
+		t.Error("OnClose on a closed loop didn't run at once")
+	}
+
+	loop.Post(func() { t.Error("task posted after Close ran") })
+	time.Sleep(40 * time.Millisecond)
+	if n := loop.RunOnce(); n != 0 {
+		t.Errorf("RunOnce() = %d after Close, want 0", n)
+	}
+
+	// late completions get a closed loop that isn't kept
+	if id := For(ctx).SetTimeout(func() {}, time.Millisecond); id != 0 {
+		t.Errorf("SetTimeout() = %d after Close, want 0", id)
+	}
+	loops.Lock()
+	_, kept := loops.m[ctx]
+	loops.Unlock()
+	if kept {
+		t.Error("For kept a loop for a closed context")
+	}
+}
+
+func TestContextClose(t *testing.T) {
+	ctx := v8go.NewContext()
+
+	loop := For(ctx)
+	loop.SetInterval(func() {}, 10*time.Millisecond)
+	released := false
+	loop.OnClose(func() { released = true })
+
+	// the host closed ctx without Close, the next For releases its loop
+	ctx.Close()
+	if id := For(ctx).SetTimeout(func() {}, time.Millisecond); id != 0 {
+		t.Errorf("SetTimeout() = %d on a closed context, want 0", id)
+	}
+	if !released {
+		t.Error("the cleanups of a context closed with ctx.Close didn't run")
+	}
+	if n := loop.Pending(); n != 0 {
+		t.Errorf("Pending() = %d on a closed context, want 0", n)
+	}
+	loops.Lock()
+	_, kept := loops.m[ctx]
+	loops.Unlock()
+	if kept {
+		t.Error("For kept the loop of a closed context")
+	}
+}
+
+func TestPostFromGoroutine(t *testing.T) {
+	ctx := v8go.NewContext()
+	defer Close(ctx)
+
+	loop := For(ctx)
+	if _, err := ctx.RunScript("var calls = []", "post.js"); err != nil {
+		t.Fatal(err)
+	}
+
+	go loop.Post(func() {
+		// tasks run on the loop goroutine, where V8 may be used
+		if _, err := ctx.RunScript("Promise.resolve().then(() => calls.push('microtask')); calls.push('task')", "task.js"); err != nil {
+			t.Error(err)
+		}
+	})
+
+	select {
+	case <-loop.Ready():
+	case <-time.After(time.Second):
+		t.Fatal("Ready() did not receive")
+	}
+	if n := loop.RunOnce(); n != 1 {
+		t.Fatalf("RunOnce() = %d, want 1", n)
+	}
+
+	val, err := ctx.RunScript("calls.join()", "calls.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := val.String(); got != "task,microtask" {
+		t.Errorf("calls = %q, want %q", got, "task,microtask")
+	}
+}
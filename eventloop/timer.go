@@ -0,0 +1,132 @@
+/*
+ * Copyright (c) 2021 Twintag
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package eventloop
+
+import (
+	"time"
+)
+
+// timer is a timeout or interval, its goroutine only posts the callback to the
+// loop
+type timer struct {
+	id       int32
+	interval bool
+	delay    time.Duration
+	fn       func()
+	timer    *time.Timer
+}
+
+// SetTimeout calls fn on the loop after delay, the loop is pending until then
+func (l *Loop) SetTimeout(fn func(), delay time.Duration) int32 {
+	return l.setTimer(fn, delay, false)
+}
+
+// SetInterval calls fn on the loop every delay until ClearInterval, the loop
+// stays pending meanwhile
+func (l *Loop) SetInterval(fn func(), delay time.Duration) int32 {
+	return l.setTimer(fn, delay, true)
+}
+
+// ClearTimeout cancels the timeout with the id, unless it already ran
+func (l *Loop) ClearTimeout(id int32) {
+	l.clearTimer(id, false)
+}
+
+// ClearInterval stops the interval with the id
+func (l *Loop) ClearInterval(id int32) {
+	l.clearTimer(id, true)
+}
+
+func (l *Loop) setTimer(fn func(), delay time.Duration, interval bool) int32 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return 0
+	}
+
+	t := &timer{
+		id:       l.nextID,
+		interval: interval,
+		delay:    delay,
+		fn:       fn,
+	}
+	l.nextID++
+	l.timers[t.id] = t
+	l.pending++
+	l.start(t)
+
+	return t.id
+}
+
+func (l *Loop) clearTimer(id int32, interval bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if t, ok := l.timers[id]; ok && t.interval == interval {
+		l.remove(t)
+	}
+}
+
+// start arms t, the caller holds l.mu
+func (l *Loop) start(t *timer) {
+	t.timer = time.AfterFunc(t.delay, func() {
+		l.Post(func() { l.fire(t) })
+	})
+}
+
+// remove stops t, the caller holds l.mu
+func (l *Loop) remove(t *timer) {
+	t.timer.Stop()
+	delete(l.timers, t.id)
+	l.pending--
+}
+
+// fire runs the callback of t unless it was cleared since its timer expired
+func (l *Loop) fire(t *timer) {
+	if !l.live(t) {
+		return
+	}
+
+	t.fn()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.timers[t.id] != t {
+		// cleared by its own callback
+		return
+	}
+	if t.interval {
+		l.start(t)
+	} else {
+		l.remove(t)
+	}
+}
+
+func (l *Loop) live(t *timer) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.timers[t.id] == t
+}
@@ -28,6 +28,7 @@ import (
 	"time"
 
 	"github.com/esoptra/v8go"
+	"github.com/esoptra/v8go-polyfills/eventloop"
 	"github.com/esoptra/v8go-polyfills/fetch"
 )
 
@@ -40,6 +41,7 @@ func main() {
 	}
 
 	ctx := v8go.NewContext(iso, global)
+	defer eventloop.Close(ctx)
 
 	val, err := ctx.RunScript("fetch('https://www.example.com').then(res => res.text())", "fetch.js")
 	if err != nil {
@@ -50,20 +52,12 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
-	done := make(chan bool, 1)
 
-	go func() {
-		for proms.State() == v8go.Pending {
-			continue
-		}
-		done <- true
-	}()
-
-	select {
-	case <-time.After(time.Second * 10):
+	// the response is resolved on this goroutine
+	if err := eventloop.For(ctx).RunFor(time.Second * 10); err != nil {
 		panic(errors.New("request timeout"))
-	case <-done:
-		html := proms.Result().String()
-		fmt.Println(html)
 	}
+
+	html := proms.Result().String()
+	fmt.Println(html)
 }
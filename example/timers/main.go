@@ -27,6 +27,7 @@ import (
 	"time"
 
 	"github.com/esoptra/v8go"
+	"github.com/esoptra/v8go-polyfills/eventloop"
 	"github.com/esoptra/v8go-polyfills/timers"
 )
 
@@ -39,6 +40,7 @@ func main() {
 	}
 
 	ctx := v8go.NewContext(iso, global)
+	defer eventloop.Close(ctx)
 
 	val, err := ctx.RunScript(
 		"new Promise((resolve) => setTimeout(function(name) {resolve(`Hello, ${name}!`)}, 1000, 'Tom'))",
@@ -53,24 +55,14 @@ func main() {
 		panic(err)
 	}
 
-	done := make(chan bool, 1)
-
-	go func() {
-		for proms.State() == v8go.Pending {
-			continue
-		}
-
-		done <- proms.State() == v8go.Fulfilled
-	}()
-
-	select {
-	case succ := <-done:
-		if !succ {
-			panic("except success but not")
-		}
+	// the timer callbacks run on this goroutine
+	if err := eventloop.For(ctx).RunFor(time.Second * 2); err != nil {
+		panic(err)
+	}
 
-		fmt.Println(proms.Result().String())
-	case <-time.After(time.Second * 2):
-		panic("timeout")
+	if proms.State() != v8go.Fulfilled {
+		panic("except success but not")
 	}
+
+	fmt.Println(proms.Result().String())
 }
@@ -0,0 +1,223 @@
+/*
+ * Copyright (c) 2021 Xingwang Liao
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package fetch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/esoptra/v8go"
+	"github.com/esoptra/v8go-polyfills/domexception"
+)
+
+// Kinds of fetch failures, match them with errors.Is
+var (
+	ErrInvalidURL     = errors.New("invalid url")
+	ErrInvalidRequest = errors.New("invalid request")
+	ErrNetwork        = errors.New("network error")
+	ErrTimeout        = errors.New("request timed out")
+	ErrAborted        = errors.New("request aborted")
+	ErrPolicy         = errors.New("request denied by policy")
+)
+
+var errorCodes = []struct {
+	Kind error
+	Code string
+}{
+	{Kind: ErrInvalidURL, Code: "invalid_url"},
+	{Kind: ErrInvalidRequest, Code: "invalid_request"},
+	{Kind: ErrNetwork, Code: "network"},
+	{Kind: ErrTimeout, Code: "timeout"},
+	{Kind: ErrAborted, Code: "abort"},
+	{Kind: ErrPolicy, Code: "policy"},
+}
+
+// Error is the failure of a fetch call. Scripts receive it as a TypeError, or
+// a DOMException named TimeoutError/AbortError, whose `cause` holds the
+// code, message and url of the Error. Requests abort when the context of the
+// fetcher is done, see WithContext.
+type Error struct {
+	Kind error
+	URL  string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Kind.Error()
+	}
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Is(target error) bool {
+	return e.Kind == target
+}
+
+func (e *Error) code() string {
+	for _, c := range errorCodes {
+		if c.Kind == e.Kind {
+			return c.Code
+		}
+	}
+	return "network"
+}
+
+type errorCause struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	URL     string `json:"url,omitempty"`
+}
+
+func newError(kind error, rawURL string, err error) *Error {
+	return &Error{Kind: kind, URL: rawURL, Err: err}
+}
+
+// classifyError turns any error of a fetch call into an *Error
+func classifyError(rawURL string, err error) *Error {
+	var fe *Error
+	if errors.As(err, &fe) {
+		if fe.URL == "" {
+			fe.URL = rawURL
+		}
+		return fe
+	}
+
+	var ne net.Error
+	switch {
+	case errors.Is(err, ErrPolicy):
+		return newError(ErrPolicy, rawURL, err)
+	case errors.Is(err, context.Canceled):
+		return newError(ErrAborted, rawURL, err)
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &ne) && ne.Timeout():
+		return newError(ErrTimeout, rawURL, err)
+	default:
+		return newError(ErrNetwork, rawURL, err)
+	}
+}
+
+// AsError returns the *Error carried by a value a fetch promise was rejected with
+func AsError(val *v8go.Value) (*Error, bool) {
+	if val == nil || !val.IsObject() {
+		return nil, false
+	}
+
+	obj, err := val.AsObject()
+	if err != nil || !obj.Has("cause") {
+		return nil, false
+	}
+
+	causeVal, err := obj.Get("cause")
+	if err != nil || !causeVal.IsObject() {
+		return nil, false
+	}
+
+	data, err := causeVal.MarshalJSON()
+	if err != nil {
+		return nil, false
+	}
+
+	var cause errorCause
+	if err := json.Unmarshal(data, &cause); err != nil {
+		return nil, false
+	}
+
+	for _, c := range errorCodes {
+		if c.Code == cause.Code {
+			return newError(c.Kind, cause.URL, errors.New(cause.Message)), true
+		}
+	}
+
+	return nil, false
+}
+
+// newErrorValue creates the JS error a fetch promise is rejected with
+func newErrorValue(ctx *v8go.Context, err error) *v8go.Value {
+	fe := classifyError("", err)
+	msg := fmt.Sprintf("fetch: %v", fe)
+
+	var obj *v8go.Object
+	switch fe.Kind {
+	case ErrTimeout:
+		obj, err = domexception.New(ctx, domexception.TimeoutError, msg)
+	case ErrAborted:
+		obj, err = domexception.New(ctx, domexception.AbortError, msg)
+	default:
+		obj, err = newTypeError(ctx, msg)
+	}
+	if err != nil {
+		e, _ := v8go.NewValue(ctx.Isolate(), msg)
+		return e
+	}
+
+	causeBytes, err := json.Marshal(&errorCause{
+		Code:    fe.code(),
+		Message: fe.Error(),
+		URL:     fe.URL,
+	})
+	if err == nil {
+		if cause, err := v8go.JSONParse(ctx, string(causeBytes)); err == nil {
+			_ = obj.Set("cause", cause)
+		}
+	}
+
+	return obj.Value
+}
+
+func newTypeError(ctx *v8go.Context, msg string) (*v8go.Object, error) {
+	ctor, err := ctx.Global().Get("TypeError")
+	if err != nil {
+		return nil, err
+	}
+
+	fn, err := ctor.AsFunction()
+	if err != nil {
+		return nil, err
+	}
+
+	msgVal, err := v8go.NewValue(ctx.Isolate(), msg)
+	if err != nil {
+		return nil, err
+	}
+
+	return fn.NewInstance(msgVal)
+}
+
+// throwTypeError throws a TypeError from a synchronous callback
+func throwTypeError(ctx *v8go.Context, msg string) *v8go.Value {
+	iso := ctx.Isolate()
+
+	obj, err := newTypeError(ctx, msg)
+	if err != nil {
+		strErr, _ := v8go.NewValue(iso, msg)
+		return iso.ThrowException(strErr)
+	}
+
+	return iso.ThrowException(obj.Value)
+}
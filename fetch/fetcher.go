@@ -23,6 +23,7 @@
 package fetch
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -36,6 +37,7 @@ import (
 	"time"
 
 	"github.com/esoptra/v8go"
+	"github.com/esoptra/v8go-polyfills/eventloop"
 	"github.com/esoptra/v8go-polyfills/fetch/internal"
 	. "github.com/esoptra/v8go-polyfills/internal"
 	"github.com/esoptra/v8go-polyfills/uuid"
@@ -76,6 +78,22 @@ type Fetch struct {
 	InputBody         io.ReadCloser
 	Transport         http.RoundTripper
 	Timeout           time.Duration
+	// Context aborts the requests in flight when it is done, they reject
+	// with an AbortError
+	Context context.Context
+
+	// TLSConfigs maps a host name (or "*.example.com" wildcard) to the TLS
+	// settings used when connecting to it
+	TLSConfigs map[string]*TLSConfig
+	// Dialers maps a host name (or "*.example.com" wildcard) to the dialer
+	// opening its connections, e.g. a unix socket or an in-process listener
+	Dialers map[string]DialContextFunc
+	// Proxy routes the remote requests through a proxy, instead of the
+	// environment settings of the default transport
+	Proxy *ProxyConfig
+
+	transportsMu sync.Mutex
+	transports   map[string]http.RoundTripper
 }
 
 func NewFetcher(opt ...Option) *Fetch {
@@ -106,73 +124,79 @@ func (f *Fetch) GetFetchFunctionCallback() v8go.FunctionCallback {
 
 		resolver, _ := v8go.NewPromiseResolver(ctx)
 
-		go func() {
-			defer func() {
-				if r := recover(); r != nil {
-					fmt.Println("panic is v8: ", r)
-					return
-				}
-			}()
-			if len(args) <= 0 {
-				err := errors.New("1 argument required, but only 0 present")
-				resolver.Reject(newErrorValue(ctx, err))
-				return
-			}
+		if len(args) <= 0 {
+			err := errors.New("1 argument required, but only 0 present")
+			resolver.Reject(newErrorValue(ctx, newError(ErrInvalidRequest, "", err)))
+			return resolver.GetPromise().Value
+		}
 
-			var reqInit internal.RequestInit
-			var err error
-			if len(args) > 1 {
-				res, err := getRequestInit(ctx, args[1])
-				if err != nil {
-					resolver.Reject(newErrorValue(ctx, err))
-					return
-				}
-				if res != nil {
-					reqInit = *res
-				}
+		var reqInit internal.RequestInit
+		var err error
+		if len(args) > 1 {
+			res, err := getRequestInit(ctx, args[1])
+			if err != nil {
+				resolver.Reject(newErrorValue(ctx, newError(ErrInvalidRequest, "", err)))
+				return resolver.GetPromise().Value
 			}
+			if res != nil {
+				reqInit = *res
+			}
+		}
 
-			val := args[0]
-			var u *url.URL
-			if val.IsString() {
-				//this happens when invoked as: fetch(url)
-				u, err = url.Parse(val.String())
-				if err != nil {
-					resolver.Reject(newErrorValue(ctx, err))
-					return
-				}
-			} else {
-				//this happens when invoked as: fetch(new Request(url, options))
-				uri, err := val.MarshalJSON()
-				if err != nil {
-					resolver.Reject(newErrorValue(ctx, err))
-					return
-				}
-				var jsReqInit internal.JSRequestInit
-				reader := strings.NewReader(string(uri))
-				if err := json.NewDecoder(reader).Decode(&jsReqInit); err != nil {
-					resolver.Reject(newErrorValue(ctx, err))
-					return
-				}
-				reqInit.Method = jsReqInit.Method
-				reqInit.Redirect = jsReqInit.Redirect
-				reqInit.Body = jsReqInit.Body
-				reqInit.Headers = jsReqInit.Headers
-
-				u, err = url.Parse(jsReqInit.Url)
-				if err != nil {
-					resolver.Reject(newErrorValue(ctx, err))
-					return
-				}
+		val := args[0]
+		var u *url.URL
+		if val.IsString() {
+			//this happens when invoked as: fetch(url)
+			u, err = internal.ParseRequestURL(val.String())
+			if err != nil {
+				resolver.Reject(newErrorValue(ctx, newError(ErrInvalidURL, val.String(), err)))
+				return resolver.GetPromise().Value
+			}
+		} else {
+			//this happens when invoked as: fetch(new Request(url, options))
+			uri, err := val.MarshalJSON()
+			if err != nil {
+				resolver.Reject(newErrorValue(ctx, newError(ErrInvalidRequest, "", err)))
+				return resolver.GetPromise().Value
+			}
+			var jsReqInit internal.JSRequestInit
+			reader := strings.NewReader(string(uri))
+			if err := json.NewDecoder(reader).Decode(&jsReqInit); err != nil {
+				resolver.Reject(newErrorValue(ctx, newError(ErrInvalidRequest, "", err)))
+				return resolver.GetPromise().Value
 			}
+			reqInit.Method = jsReqInit.Method
+			reqInit.Redirect = jsReqInit.Redirect
+			reqInit.Body = jsReqInit.Body
+			reqInit.Headers = jsReqInit.Headers
 
-			r, err := f.initRequest(u, reqInit)
+			u, err = internal.ParseRequestURL(jsReqInit.Url)
 			if err != nil {
-				resolver.Reject(newErrorValue(ctx, err))
-				return
+				resolver.Reject(newErrorValue(ctx, newError(ErrInvalidURL, jsReqInit.Url, err)))
+				return resolver.GetPromise().Value
 			}
+		}
+
+		r, err := f.initRequest(u, reqInit)
+		if err != nil {
+			resolver.Reject(newErrorValue(ctx, newError(ErrInvalidRequest, u.String(), err)))
+			return resolver.GetPromise().Value
+		}
+
+		// the request runs in the background, the response is created on the
+		// event loop of ctx
+		eventloop.For(ctx).Go(func() (task func()) {
+			defer func() {
+				if r := recover(); r != nil {
+					err := fmt.Errorf("panic in fetch: %v", r)
+					task = func() {
+						resolver.Reject(newErrorValue(ctx, newError(ErrNetwork, u.String(), err)))
+					}
+				}
+			}()
 
 			var res *internal.Response
+			var err error
 
 			// do local request
 			if !r.URL.IsAbs() {
@@ -180,23 +204,26 @@ func (f *Fetch) GetFetchFunctionCallback() v8go.FunctionCallback {
 			} else {
 				res, err = f.fetchRemote(r)
 			}
-			if err != nil {
-				resolver.Reject(newErrorValue(ctx, err))
-				return
-			}
-			//store a pointer reference with the fetcher
-			mini := uuid.NewUuid()
-			f.ResponseMap.Store(mini, res.BodyReader)
-			res.Body = mini
 
-			resObj, err := newResponseObject(ctx, res)
-			if err != nil {
-				resolver.Reject(newErrorValue(ctx, err))
-				return
-			}
+			return func() {
+				if err != nil {
+					resolver.Reject(newErrorValue(ctx, classifyError(u.String(), err)))
+					return
+				}
+				//store a pointer reference with the fetcher
+				mini := uuid.NewUuid()
+				f.ResponseMap.Store(mini, res.BodyReader)
+				res.Body = mini
 
-			resolver.Resolve(resObj)
-		}()
+				resObj, err := newResponseObject(ctx, res)
+				if err != nil {
+					resolver.Reject(newErrorValue(ctx, err))
+					return
+				}
+
+				resolver.Resolve(resObj)
+			}
+		})
 
 		return resolver.GetPromise().Value
 	}
@@ -266,7 +293,7 @@ func (f *Fetch) fetchLocal(r *internal.Request) (*internal.Response, error) {
 		body = r.Body
 	}
 
-	req, err := http.NewRequest(r.Method, r.URL.String(), body)
+	req, err := http.NewRequestWithContext(f.context(), r.Method, r.URL.String(), body)
 	if err != nil {
 		return nil, err
 	}
@@ -286,7 +313,7 @@ func (f *Fetch) fetchRemote(r *internal.Request) (*internal.Response, error) {
 		body = r.Body
 	}
 
-	req, err := http.NewRequest(r.Method, r.URL.String(), body)
+	req, err := http.NewRequestWithContext(f.context(), r.Method, r.URL.String(), body)
 	if err != nil {
 		return nil, err
 	}
@@ -294,11 +321,11 @@ func (f *Fetch) fetchRemote(r *internal.Request) (*internal.Response, error) {
 
 	redirected := false
 	client := &http.Client{
-		Transport: f.Transport,
+		Transport: f.roundTripper(),
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			switch r.Redirect {
 			case internal.RequestRedirectError:
-				return errors.New("redirects are not allowed")
+				return fmt.Errorf("%w: redirects are not allowed", ErrPolicy)
 			case internal.RequestRedirectManual:
 				// Don't follow: return the 3xx response as-is so the
 				// caller can inspect status and the Location header.
@@ -323,6 +350,53 @@ func (f *Fetch) fetchRemote(r *internal.Request) (*internal.Response, error) {
 	return internal.HandleHttpResponse(res, r.URL.String(), redirected)
 }
 
+func (f *Fetch) context() context.Context {
+	if f.Context == nil {
+		return context.Background()
+	}
+	return f.Context
+}
+
+// Do sends a request of the host the way scripts fetch: relative URLs are
+// served by the local handler, absolute URLs go through the transport with
+// the per-host TLS, dialer and proxy settings. Other polyfills use it to load
+// remote resources, e.g. the JWKS of a token issuer.
+func (f *Fetch) Do(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") == "" {
+		var ua string
+		if f.UserAgentProvider != nil {
+			ua = f.UserAgentProvider.GetUserAgent(req.URL)
+		} else {
+			ua = defaultUserAgentProvider(req.URL)
+		}
+		req.Header.Set("User-Agent", ua)
+	}
+
+	if !req.URL.IsAbs() {
+		if f.LocalHandler == nil {
+			return nil, newError(ErrInvalidRequest, req.URL.String(), errors.New("no local handler present"))
+		}
+		if req.RemoteAddr == "" {
+			req.RemoteAddr = f.AddrLocal
+		}
+
+		rcd := httptest.NewRecorder()
+		f.LocalHandler.ServeHTTP(rcd, req)
+		return rcd.Result(), nil
+	}
+
+	client := &http.Client{
+		Transport: f.roundTripper(),
+		Timeout:   f.Timeout,
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, classifyError(req.URL.String(), err)
+	}
+	return res, nil
+}
+
 func newResponseObject(ctx *v8go.Context, res *internal.Response) (*v8go.Object, error) {
 	iso := ctx.Isolate()
 
@@ -335,17 +409,20 @@ func newResponseObject(ctx *v8go.Context, res *internal.Response) (*v8go.Object,
 		ctx := info.Context()
 		resolver, _ := v8go.NewPromiseResolver(ctx)
 
-		go func() {
+		eventloop.For(ctx).Go(func() func() {
 			defer res.BodyReader.Close()
 			resBody, err := ioutil.ReadAll(res.BodyReader)
 			if err != nil {
 				resBody = nil
 			}
-			res.Body = string(resBody)
-			//fmt.Println("respbody =>", res.Body)
-			v, _ := v8go.NewValue(iso, res.Body)
-			resolver.Resolve(v)
-		}()
+
+			return func() {
+				res.Body = string(resBody)
+				//fmt.Println("respbody =>", res.Body)
+				v, _ := v8go.NewValue(iso, res.Body)
+				resolver.Resolve(v)
+			}
+		})
 
 		return resolver.GetPromise().Value
 	})
@@ -358,22 +435,25 @@ func newResponseObject(ctx *v8go.Context, res *internal.Response) (*v8go.Object,
 
 		resolver, _ := v8go.NewPromiseResolver(ctx)
 
-		go func() {
+		eventloop.For(ctx).Go(func() func() {
 			defer res.BodyReader.Close()
 			resBody, err := ioutil.ReadAll(res.BodyReader)
 			if err != nil {
 				resBody = nil
 			}
-			res.Body = string(resBody)
-			val, err := v8go.JSONParse(ctx, res.Body)
-			if err != nil {
-				rejectVal, _ := v8go.NewValue(iso, err.Error())
-				resolver.Reject(rejectVal)
-				return
-			}
 
-			resolver.Resolve(val)
-		}()
+			return func() {
+				res.Body = string(resBody)
+				val, err := v8go.JSONParse(ctx, res.Body)
+				if err != nil {
+					rejectVal, _ := v8go.NewValue(iso, err.Error())
+					resolver.Reject(rejectVal)
+					return
+				}
+
+				resolver.Resolve(val)
+			}
+		})
 
 		return resolver.GetPromise().Value
 	})
@@ -487,14 +567,6 @@ func newHeadersObject(ctx *v8go.Context, h http.Header) (*v8go.Object, error) {
 	return headers, nil
 }
 
-// v8go currently not support reject a *v8go.Object,
-// so we should new *v8go.Value here
-func newErrorValue(ctx *v8go.Context, err error) *v8go.Value {
-	iso := ctx.Isolate()
-	e, _ := v8go.NewValue(iso, fmt.Sprintf("fetch: %v", err))
-	return e
-}
-
 func UserAgent() string {
 	return fmt.Sprintf("v8go-polyfills/%s (v8go/%s)", Version, v8go.Version())
 }
@@ -589,19 +661,16 @@ func RequestCallbackFunc(info *v8go.FunctionCallbackInfo) *v8go.Value {
 	ctx := info.Context()
 	iso := ctx.Isolate()
 	if len(args) <= 0 {
-		strErr, _ := v8go.NewValue(iso, "1 argument required, but only 0 present")
-		return iso.ThrowException(strErr)
+		return throwTypeError(ctx, "1 argument required, but only 0 present")
 	}
 
 	uri := args[0].String()
 	u, err := url.Parse(uri)
 	if err != nil {
-		strErr, _ := v8go.NewValue(iso, fmt.Sprintf("Invalid URL %q: %#v", uri, err))
-		return iso.ThrowException(strErr)
+		return throwTypeError(ctx, fmt.Sprintf("Invalid URL %q: %v", uri, err))
 	}
 	if u.Scheme == "" || u.Host == "" {
-		strErr, _ := v8go.NewValue(iso, fmt.Sprintf("Invalid URL %q", uri))
-		return iso.ThrowException(strErr)
+		return throwTypeError(ctx, fmt.Sprintf("Invalid URL %q", uri))
 	}
 	res := &internal.JSRequestInit{
 		Url: uri,
@@ -609,8 +678,7 @@ func RequestCallbackFunc(info *v8go.FunctionCallbackInfo) *v8go.Value {
 	if len(args) > 1 {
 		reqInit, err := getRequestInit(ctx, args[1])
 		if err != nil {
-			strErr, _ := v8go.NewValue(iso, fmt.Sprintf("Error getRequestInit: %#v", err))
-			return iso.ThrowException(strErr)
+			return throwTypeError(ctx, fmt.Sprintf("Error getRequestInit: %v", err))
 		}
 		if reqInit != nil {
 			res.Method = reqInit.Method
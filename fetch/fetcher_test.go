@@ -23,16 +23,27 @@
 package fetch
 
 import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/esoptra/v8go"
 	"github.com/esoptra/v8go-polyfills/console"
+	"github.com/esoptra/v8go-polyfills/eventloop"
 	"github.com/esoptra/v8go-polyfills/uuid"
 )
 
@@ -69,6 +80,7 @@ func TestFetchJSON(t *testing.T) {
 		t.Errorf("create v8: %s", err)
 		return
 	}
+	defer eventloop.Close(ctx)
 
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -88,8 +100,9 @@ func TestFetchJSON(t *testing.T) {
 		return
 	}
 
-	for proms.State() == v8go.Pending {
-		continue
+	if err := eventloop.For(ctx).RunFor(time.Second * 10); err != nil {
+		t.Error(err)
+		return
 	}
 
 	res, err := proms.Result().AsObject()
@@ -117,6 +130,7 @@ func TestFetchRedirectManual(t *testing.T) {
 		t.Errorf("create v8: %s", err)
 		return
 	}
+	defer eventloop.Close(ctx)
 
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path == "/dest" {
@@ -146,8 +160,9 @@ func TestFetchRedirectManual(t *testing.T) {
 		return
 	}
 
-	for proms.State() == v8go.Pending {
-		continue
+	if err := eventloop.For(ctx).RunFor(time.Second * 10); err != nil {
+		t.Error(err)
+		return
 	}
 
 	if proms.State() == v8go.Rejected {
@@ -189,6 +204,437 @@ func TestFetchRedirectManual(t *testing.T) {
 	}
 }
 
+func TestFetchTLSConfig(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("secure"))
+	}))
+	defer srv.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	sum := sha256.Sum256(srv.Certificate().RawSubjectPublicKeyInfo)
+	pin := base64.StdEncoding.EncodeToString(sum[:])
+
+	for _, tc := range []struct {
+		Name   string
+		Opts   []Option
+		Reject string
+	}{
+		{Name: "no config", Reject: "certificate"},
+		{Name: "private ca", Opts: []Option{WithTLSConfig("127.0.0.1", &TLSConfig{RootCAs: pool})}},
+		{Name: "pinned", Opts: []Option{WithTLSConfig("127.0.0.1", &TLSConfig{RootCAs: pool, PinnedSPKI: []string{pin}})}},
+		{Name: "pin mismatch", Opts: []Option{WithTLSConfig("127.0.0.1", &TLSConfig{RootCAs: pool, PinnedSPKI: []string{"AAAA"}})}, Reject: "pin mismatch"},
+	} {
+		ctx, err := newV8ContextWithFetch(tc.Opts...)
+		if err != nil {
+			t.Errorf("create v8: %s", err)
+			return
+		}
+		defer eventloop.Close(ctx)
+
+		val, err := ctx.RunScript(fmt.Sprintf("fetch('%s').then(res => res.text())", srv.URL), "fetch_tls.js")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		proms, err := val.AsPromise()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if err := eventloop.For(ctx).RunFor(time.Second * 10); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if tc.Reject != "" {
+			if proms.State() != v8go.Rejected {
+				t.Errorf("%s: expected rejection", tc.Name)
+			} else if msg := proms.Result().String(); !strings.Contains(msg, tc.Reject) {
+				t.Errorf("%s: expected %q in rejection, got %q", tc.Name, tc.Reject, msg)
+			}
+			continue
+		}
+
+		if proms.State() != v8go.Fulfilled {
+			t.Errorf("%s: promise rejected: %s", tc.Name, proms.Result().String())
+			continue
+		}
+		if body := proms.Result().String(); body != "secure" {
+			t.Errorf("%s: should be 'secure' but is '%s'", tc.Name, body)
+		}
+	}
+}
+
+func TestFetchDialer(t *testing.T) {
+	t.Parallel()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("hello " + r.Host))
+	})
+
+	dir, err := ioutil.TempDir("", "fetch-dialer")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	sock := filepath.Join(dir, "sidecar.sock")
+	unixLn, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer unixLn.Close()
+	go func() { _ = http.Serve(unixLn, handler) }()
+
+	pipeLn := NewPipeListener()
+	defer pipeLn.Close()
+	go func() { _ = http.Serve(pipeLn, handler) }()
+
+	ctx, err := newV8ContextWithFetch(
+		WithDialer("sidecar.local", UnixSocketDialer(sock)),
+		WithDialer("*.internal", pipeLn.DialContext),
+	)
+	if err != nil {
+		t.Errorf("create v8: %s", err)
+		return
+	}
+	defer eventloop.Close(ctx)
+
+	for _, tc := range []struct {
+		URL    string
+		Expect string
+	}{
+		{URL: "http://sidecar.local/", Expect: "hello sidecar.local"},
+		{URL: "http://api.internal/", Expect: "hello api.internal"},
+	} {
+		val, err := ctx.RunScript(fmt.Sprintf("fetch('%s').then(res => res.text())", tc.URL), "fetch_dialer.js")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		proms, err := val.AsPromise()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if err := eventloop.For(ctx).RunFor(time.Second * 10); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if proms.State() != v8go.Fulfilled {
+			t.Errorf("%s: promise rejected: %s", tc.URL, proms.Result().String())
+			continue
+		}
+		if body := proms.Result().String(); body != tc.Expect {
+			t.Errorf("%s: should be '%s' but is '%s'", tc.URL, tc.Expect, body)
+		}
+	}
+}
+
+func TestFetchDo(t *testing.T) {
+	t.Parallel()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "%s %s %s", r.Method, r.URL.Path, r.Header.Get("User-Agent"))
+	})
+
+	pipeLn := NewPipeListener()
+	defer pipeLn.Close()
+	go func() { _ = http.Serve(pipeLn, handler) }()
+
+	f := NewFetcher(
+		WithLocalHandler(handler),
+		WithDialer("api.internal", pipeLn.DialContext),
+		WithUserAgentProvider(UserAgentProviderFunc(func(u *url.URL) string { return "agent" })),
+	)
+
+	for _, tc := range []struct {
+		URL    string
+		Expect string
+	}{
+		{URL: "/local", Expect: "GET /local agent"},
+		{URL: "http://api.internal/remote", Expect: "GET /remote agent"},
+	} {
+		req, err := http.NewRequest("GET", tc.URL, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		res, err := f.Do(req)
+		if err != nil {
+			t.Errorf("%s: %s", tc.URL, err)
+			continue
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+
+		if string(body) != tc.Expect {
+			t.Errorf("%s: should be '%s' but is '%s'", tc.URL, tc.Expect, body)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "http://127.0.0.1:1/", nil)
+	if _, err := f.Do(req); !errors.Is(err, ErrNetwork) {
+		t.Errorf("expected a network error, got %v", err)
+	}
+}
+
+func TestFetchErrors(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow":
+			time.Sleep(500 * time.Millisecond)
+		case "/moved":
+			http.Redirect(w, r, "/", http.StatusFound)
+		}
+	}))
+	defer srv.Close()
+
+	ctx, err := newV8ContextWithFetch(WithTimeout(100 * time.Millisecond))
+	if err != nil {
+		t.Errorf("create v8: %s", err)
+		return
+	}
+	defer eventloop.Close(ctx)
+
+	for _, tc := range []struct {
+		Script string
+		Name   string
+		Code   string
+		Kind   error
+	}{
+		{Script: "fetch()", Name: "TypeError", Code: "invalid_request", Kind: ErrInvalidRequest},
+		{Script: "fetch('ftp://example.com/')", Name: "TypeError", Code: "invalid_url", Kind: ErrInvalidURL},
+		{Script: "fetch('http://127.0.0.1:1/')", Name: "TypeError", Code: "network", Kind: ErrNetwork},
+		{Script: fmt.Sprintf("fetch('%s/moved', { redirect: 'error' })", srv.URL), Name: "TypeError", Code: "policy", Kind: ErrPolicy},
+		{Script: fmt.Sprintf("fetch('%s/slow')", srv.URL), Name: "TimeoutError", Code: "timeout", Kind: ErrTimeout},
+	} {
+		val, err := ctx.RunScript(tc.Script, "fetch_errors.js")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		proms, err := val.AsPromise()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if err := eventloop.For(ctx).RunFor(time.Second * 10); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if proms.State() != v8go.Rejected {
+			t.Errorf("%s: expected rejection", tc.Script)
+			continue
+		}
+
+		if err := ctx.Global().Set("reason", proms.Result()); err != nil {
+			t.Error(err)
+			return
+		}
+		check, err := ctx.RunScript(`reason.name + ":" + reason.cause.code`, "fetch_errors_check.js")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if expect := tc.Name + ":" + tc.Code; check.String() != expect {
+			t.Errorf("%s: expected %q but got %q", tc.Script, expect, check.String())
+		}
+
+		fe, ok := AsError(proms.Result())
+		if !ok {
+			t.Errorf("%s: rejection carries no fetch error", tc.Script)
+			continue
+		}
+		if !errors.Is(fe, tc.Kind) {
+			t.Errorf("%s: expected %v but got %v", tc.Script, tc.Kind, fe.Kind)
+		}
+	}
+}
+
+func TestFetchAbort(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	abort, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ctx, err := newV8ContextWithFetch(WithContext(abort))
+	if err != nil {
+		t.Errorf("create v8: %s", err)
+		return
+	}
+	defer eventloop.Close(ctx)
+
+	val, err := ctx.RunScript(fmt.Sprintf(`fetch('%s').catch(e => e.name + ":" + e.cause.code)`, srv.URL), "fetch_abort.js")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	proms, err := val.AsPromise()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if err := eventloop.For(ctx).RunFor(time.Second * 10); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res := proms.Result().String(); res != "AbortError:abort" {
+		t.Errorf("expected %q but got %q", "AbortError:abort", res)
+	}
+}
+
+func TestFetchProxy(t *testing.T) {
+	t.Parallel()
+
+	direct := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("direct"))
+	}))
+	defer direct.Close()
+
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := parseProxyAuth(r); !ok || user != "scott" || pass != "tiger" {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		_, _ = w.Write([]byte("proxied " + r.URL.Host))
+	}))
+	defer proxy.Close()
+
+	proxyURL, _ := url.Parse(proxy.URL)
+
+	ctx, err := newV8ContextWithFetch(WithProxy(&ProxyConfig{
+		URL:      proxyURL,
+		Username: "scott",
+		Password: "tiger",
+		NoProxy:  ParseNoProxy("localhost, 127.0.0.0/8"),
+		Select: func(u *url.URL) (*url.URL, error) {
+			if u.Hostname() == "direct.example" {
+				return nil, nil
+			}
+			return proxyURL, nil
+		},
+	}))
+	if err != nil {
+		t.Errorf("create v8: %s", err)
+		return
+	}
+	defer eventloop.Close(ctx)
+
+	for _, tc := range []struct {
+		URL    string
+		Expect string
+	}{
+		{URL: "http://upstream.example/", Expect: "proxied upstream.example"},
+		{URL: direct.URL, Expect: "direct"},
+	} {
+		val, err := ctx.RunScript(fmt.Sprintf("fetch('%s').then(res => res.text())", tc.URL), "fetch_proxy.js")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		proms, err := val.AsPromise()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if err := eventloop.For(ctx).RunFor(time.Second * 10); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if proms.State() != v8go.Fulfilled {
+			t.Errorf("%s: promise rejected: %s", tc.URL, proms.Result().String())
+			continue
+		}
+		if body := proms.Result().String(); body != tc.Expect {
+			t.Errorf("%s: should be '%s' but is '%s'", tc.URL, tc.Expect, body)
+		}
+	}
+
+	f := NewFetcher(WithProxy(&ProxyConfig{URL: proxyURL, Select: func(u *url.URL) (*url.URL, error) {
+		if u.Hostname() == "direct.example" {
+			return nil, nil
+		}
+		return url.Parse("socks5://socks.example:1080")
+	}}))
+	for host, expect := range map[string]string{
+		"direct.example": "",
+		"other.example":  "socks5://socks.example:1080",
+	} {
+		req, _ := http.NewRequest("GET", "http://"+host+"/", nil)
+		u, err := f.ProxyURL(req)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if got := fmt.Sprint(u); (u == nil && expect != "") || (u != nil && got != expect) {
+			t.Errorf("%s: expected proxy %q but got %q", host, expect, got)
+		}
+	}
+
+	f = NewFetcher(WithTransport(http.NewFileTransport(http.Dir("."))), WithProxy(&ProxyConfig{URL: proxyURL}))
+	if _, err := f.transportFor("upstream.example"); err == nil || !strings.Contains(err.Error(), `"upstream.example"`) {
+		t.Errorf("expected an error naming upstream.example but got %v", err)
+	}
+
+	noProxy := &ProxyConfig{
+		URL:     proxyURL,
+		NoProxy: ParseNoProxy("[::1], [fe80::1]:8443, ::2, .corp.example, 10.0.0.0/8"),
+	}
+	for rawURL, direct := range map[string]bool{
+		"http://[::1]/":            true,
+		"http://[::1]:8080/":       true,
+		"https://[fe80::1]:8443/":  true,
+		"https://[fe80::1]/":       false,
+		"http://[::2]/":            true,
+		"http://api.corp.example/": true,
+		"http://10.1.2.3/":         true,
+		"http://example.com/":      false,
+	} {
+		u, _ := url.Parse(rawURL)
+		if got := noProxy.bypass(u); got != direct {
+			t.Errorf("%s: expected bypass %v but got %v", rawURL, direct, got)
+		}
+	}
+}
+
+func parseProxyAuth(r *http.Request) (string, string, bool) {
+	auth := r.Header.Get("Proxy-Authorization")
+	if !strings.HasPrefix(auth, "Basic ") {
+		return "", "", false
+	}
+	req := &http.Request{Header: http.Header{"Authorization": []string{auth}}}
+	return req.BasicAuth()
+}
+
 func TestHeaders(t *testing.T) {
 	t.Parallel()
 
@@ -252,6 +698,7 @@ func testFetchBodyWithLazyLoad(t *testing.T, script string) {
 	}
 
 	ctx := v8go.NewContext(iso, global)
+	defer eventloop.Close(ctx)
 	if err := console.InjectTo(ctx); err != nil {
 		panic(err)
 	}
@@ -293,8 +740,9 @@ func testFetchBodyWithLazyLoad(t *testing.T, script string) {
 		return
 	}
 
-	for proms.State() == v8go.Pending {
-		continue
+	if err := eventloop.For(ctx).RunFor(time.Second * 10); err != nil {
+		t.Error(err)
+		return
 	}
 
 	res, err := proms.Result().AsObject()
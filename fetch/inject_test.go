@@ -28,6 +28,7 @@ import (
 	"time"
 
 	"github.com/esoptra/v8go"
+	"github.com/esoptra/v8go-polyfills/eventloop"
 )
 
 func TestInjectTo(t *testing.T) {
@@ -42,6 +43,7 @@ func TestInjectTo(t *testing.T) {
 	}
 
 	ctx := v8go.NewContext(iso, global)
+	defer eventloop.Close(ctx)
 
 	val, err := ctx.RunScript("fetch('https://www.example.com')", "fetch_example.js")
 	if err != nil {
@@ -55,29 +57,18 @@ func TestInjectTo(t *testing.T) {
 		return
 	}
 
-	done := make(chan bool, 1)
-	go func() {
-		for pro.State() == v8go.Pending {
-			continue
-		}
-
-		done <- true
-	}()
-
-	select {
-	case <-time.After(time.Second * 10):
+	if err := eventloop.For(ctx).RunFor(time.Second * 10); err != nil {
 		t.Errorf("request timeout")
 		return
-	case <-done:
-		stat := pro.State()
-		if stat == v8go.Rejected {
-			fmt.Printf("reject with error: %s\n", pro.Result().String())
-		}
+	}
 
-		if pro.State() != v8go.Fulfilled {
-			t.Errorf("should fetch success, but not")
-			return
-		}
+	if pro.State() == v8go.Rejected {
+		fmt.Printf("reject with error: %s\n", pro.Result().String())
+	}
+
+	if pro.State() != v8go.Fulfilled {
+		t.Errorf("should fetch success, but not")
+		return
 	}
 
 	obj, err := pro.Result().AsObject()
@@ -23,9 +23,11 @@
 package fetch
 
 import (
+	"context"
 	"io"
 	"net/http"
 	"net/url"
+	"strings"
 	"sync"
 	"time"
 )
@@ -91,3 +93,40 @@ func WithTimeout(timeout time.Duration) Option {
 		ft.Timeout = timeout
 	})
 }
+
+// WithContext aborts the requests in flight when ctx is done, e.g. when the
+// host cancels the script, they reject with an AbortError
+func WithContext(ctx context.Context) Option {
+	return optionFunc(func(ft *Fetch) {
+		ft.Context = ctx
+	})
+}
+
+// WithTLSConfig registers the TLS settings used for requests to host.
+// host is matched against the URL host name and may be a "*.example.com" wildcard.
+func WithTLSConfig(host string, cfg *TLSConfig) Option {
+	return optionFunc(func(ft *Fetch) {
+		if ft.TLSConfigs == nil {
+			ft.TLSConfigs = make(map[string]*TLSConfig)
+		}
+		ft.TLSConfigs[strings.ToLower(host)] = cfg
+	})
+}
+
+// WithDialer routes the connections for host through dial instead of the
+// network, e.g. WithDialer("sidecar.local", UnixSocketDialer("/run/sidecar.sock")).
+func WithDialer(host string, dial DialContextFunc) Option {
+	return optionFunc(func(ft *Fetch) {
+		if ft.Dialers == nil {
+			ft.Dialers = make(map[string]DialContextFunc)
+		}
+		ft.Dialers[strings.ToLower(host)] = dial
+	})
+}
+
+// WithProxy routes the remote requests, including redirects, through the proxy of cfg
+func WithProxy(cfg *ProxyConfig) Option {
+	return optionFunc(func(ft *Fetch) {
+		ft.Proxy = cfg
+	})
+}
@@ -0,0 +1,167 @@
+/*
+ * Copyright (c) 2021 Xingwang Liao
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package fetch
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ProxySelector picks the proxy for a request URL, a nil URL means a direct connection
+type ProxySelector func(u *url.URL) (*url.URL, error)
+
+// ProxyConfig routes the remote requests through a proxy. https destinations
+// use HTTP CONNECT through http(s):// proxies, socks5:// proxies are supported too.
+type ProxyConfig struct {
+	// URL is the proxy used when Select is nil
+	URL *url.URL
+	// Username and Password are sent as Basic proxy credentials, unless the
+	// selected proxy URL carries its own
+	Username string
+	Password string
+	// NoProxy lists the destinations reached directly, in the NO_PROXY
+	// format: "*", host names (matching sub domains too), ".domain",
+	// IP addresses and CIDR ranges, each with an optional ":port"
+	NoProxy []string
+	// Select picks the proxy of each destination not excluded by NoProxy,
+	// returning a nil URL connects directly
+	Select ProxySelector
+}
+
+// ParseNoProxy splits a NO_PROXY environment value into ProxyConfig.NoProxy entries
+func ParseNoProxy(value string) []string {
+	var entries []string
+	for _, e := range strings.Split(value, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+func (c *ProxyConfig) proxyURL(u *url.URL) (*url.URL, error) {
+	if c.bypass(u) {
+		return nil, nil
+	}
+
+	proxy := c.URL
+	if c.Select != nil {
+		selected, err := c.Select(u)
+		if err != nil {
+			return nil, err
+		}
+		proxy = selected
+	}
+	if proxy == nil {
+		return nil, nil
+	}
+
+	switch proxy.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", proxy.Scheme)
+	}
+
+	if proxy.User == nil && c.Username != "" {
+		withUser := *proxy
+		withUser.User = url.UserPassword(c.Username, c.Password)
+		proxy = &withUser
+	}
+
+	return proxy, nil
+}
+
+func (c *ProxyConfig) bypass(u *url.URL) bool {
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+	if port == "" {
+		switch u.Scheme {
+		case "https":
+			port = "443"
+		default:
+			port = "80"
+		}
+	}
+
+	ip := net.ParseIP(host)
+
+	for _, entry := range c.NoProxy {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "*" {
+			return true
+		}
+
+		if _, cidr, err := net.ParseCIDR(entry); err == nil {
+			if ip != nil && cidr.Contains(ip) {
+				return true
+			}
+			continue
+		}
+
+		entryHost, entryPort := entry, ""
+		if h, p, err := net.SplitHostPort(entry); err == nil {
+			entryHost, entryPort = h, p
+		}
+		// "[::1]" without a port is left as is by SplitHostPort
+		entryHost = strings.TrimSuffix(strings.TrimPrefix(entryHost, "["), "]")
+		if entryPort != "" && entryPort != port {
+			continue
+		}
+
+		if entryIP := net.ParseIP(entryHost); entryIP != nil {
+			if ip != nil && entryIP.Equal(ip) {
+				return true
+			}
+			continue
+		}
+
+		entryHost = strings.TrimPrefix(strings.TrimPrefix(entryHost, "*"), ".")
+		if host == entryHost || strings.HasSuffix(host, "."+entryHost) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ProxyURL returns the proxy for req according to the fetcher settings. It has
+// the signature of http.Transport.Proxy so WebSocket or SSE clients built next
+// to the fetcher can route their connections the same way.
+func (f *Fetch) ProxyURL(req *http.Request) (*url.URL, error) {
+	if f.dialerFor(req.URL.Hostname()) != nil {
+		return nil, nil
+	}
+
+	if f.Proxy != nil {
+		return f.Proxy.proxyURL(req.URL)
+	}
+
+	if tr, ok := f.Transport.(*http.Transport); ok && tr.Proxy != nil {
+		return tr.Proxy(req)
+	}
+
+	return nil, nil
+}
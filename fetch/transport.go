@@ -0,0 +1,185 @@
+/*
+ * Copyright (c) 2021 Xingwang Liao
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package fetch
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// TLSConfig holds the TLS settings applied to requests for a single destination.
+type TLSConfig struct {
+	// RootCAs replaces the system roots when verifying the server certificate
+	RootCAs *x509.CertPool
+	// Certificates are presented to servers asking for a client certificate (mTLS)
+	Certificates []tls.Certificate
+	MinVersion   uint16
+	// ServerName overrides the SNI and the name the certificate is verified against
+	ServerName string
+	// PinnedSPKI is a list of base64 encoded SHA-256 hashes of the
+	// SubjectPublicKeyInfo; one certificate of the chain must match
+	PinnedSPKI []string
+}
+
+func (c *TLSConfig) clientConfig(host string) *tls.Config {
+	cfg := &tls.Config{
+		RootCAs:      c.RootCAs,
+		Certificates: c.Certificates,
+		MinVersion:   c.MinVersion,
+		ServerName:   c.ServerName,
+	}
+
+	if len(c.PinnedSPKI) > 0 {
+		pins := c.PinnedSPKI
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			return verifyPins(host, pins, cs.PeerCertificates)
+		}
+	}
+
+	return cfg
+}
+
+func verifyPins(host string, pins []string, certs []*x509.Certificate) error {
+	for _, cert := range certs {
+		sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+		hash := base64.StdEncoding.EncodeToString(sum[:])
+		for _, pin := range pins {
+			if pin == hash {
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("%w: certificate pin mismatch for host %q, none of the %d presented certificates matches the pinned public keys", ErrPolicy, host, len(certs))
+}
+
+// hostCandidates returns the keys a per-host setting may be registered
+// under: the exact host name first, then "*.parent" wildcards.
+func hostCandidates(host string) []string {
+	host = strings.ToLower(host)
+	names := []string{host}
+	for i := strings.IndexByte(host, '.'); i >= 0; i = strings.IndexByte(host, '.') {
+		host = host[i+1:]
+		names = append(names, "*."+host)
+	}
+	return names
+}
+
+func (f *Fetch) tlsConfigFor(host string) *TLSConfig {
+	for _, name := range hostCandidates(host) {
+		if cfg, ok := f.TLSConfigs[name]; ok {
+			return cfg
+		}
+	}
+	return nil
+}
+
+func (f *Fetch) dialerFor(host string) DialContextFunc {
+	for _, name := range hostCandidates(host) {
+		if dial, ok := f.Dialers[name]; ok {
+			return dial
+		}
+	}
+	return nil
+}
+
+func (f *Fetch) hasHostSettings() bool {
+	return len(f.TLSConfigs) > 0 || len(f.Dialers) > 0 || f.Proxy != nil
+}
+
+// roundTripper returns the transport used by fetchRemote. When destination
+// specific settings are registered, requests (including redirects) are
+// dispatched to a transport derived from f.Transport for their host.
+func (f *Fetch) roundTripper() http.RoundTripper {
+	if !f.hasHostSettings() {
+		return f.Transport
+	}
+	return hostTransport{f}
+}
+
+type hostTransport struct {
+	f *Fetch
+}
+
+func (t hostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt, err := t.f.transportFor(req.URL.Hostname())
+	if err != nil {
+		return nil, err
+	}
+	return rt.RoundTrip(req)
+}
+
+func (f *Fetch) transportFor(host string) (http.RoundTripper, error) {
+	host = strings.ToLower(host)
+
+	f.transportsMu.Lock()
+	defer f.transportsMu.Unlock()
+
+	key := host
+	if rt, ok := f.transports[key]; ok {
+		return rt, nil
+	}
+
+	tlsCfg := f.tlsConfigFor(host)
+	dial := f.dialerFor(host)
+	if tlsCfg == nil && dial == nil {
+		if f.Proxy == nil {
+			return f.Transport, nil
+		}
+		// hosts without own settings share one proxied transport
+		key = ""
+		if rt, ok := f.transports[key]; ok {
+			return rt, nil
+		}
+	}
+
+	base, ok := f.Transport.(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("per-host settings for %q need an *http.Transport, got %T", host, f.Transport)
+	}
+
+	tr := base.Clone()
+	if f.Proxy != nil {
+		tr.Proxy = f.ProxyURL
+	}
+	if tlsCfg != nil {
+		tr.TLSClientConfig = tlsCfg.clientConfig(host)
+	}
+	if dial != nil {
+		// the dialer decides where the connection goes, never route it via a proxy
+		tr.Proxy = nil
+		tr.DialContext = dial
+	}
+
+	if f.transports == nil {
+		f.transports = make(map[string]http.RoundTripper)
+	}
+	f.transports[key] = tr
+
+	return tr, nil
+}
@@ -25,6 +25,8 @@ package polyfills
 import (
 	"github.com/esoptra/v8go-polyfills/base64"
 	"github.com/esoptra/v8go-polyfills/console"
+	"github.com/esoptra/v8go-polyfills/crypto"
+	"github.com/esoptra/v8go-polyfills/domexception"
 	"github.com/esoptra/v8go-polyfills/fetch"
 	"github.com/esoptra/v8go-polyfills/internal"
 	"github.com/esoptra/v8go-polyfills/textDecoder"
@@ -35,7 +37,55 @@ import (
 	"github.com/esoptra/v8go"
 )
 
-func InjectToGlobalObjectWithCustomFetch(iso *v8go.Isolate, global *v8go.ObjectTemplate, fetcher *fetch.Fetch) error {
+type withoutCrypto struct{}
+
+// WithoutCrypto leaves crypto out of the polyfills injected to the global
+// object or the context
+func WithoutCrypto() interface{} {
+	return withoutCrypto{}
+}
+
+// cryptoOptions returns the crypto.Option values of opt, ok is false when
+// crypto is opted out
+func cryptoOptions(opt []interface{}) (cryptoOpts []crypto.Option, ok bool) {
+	for _, o := range opt {
+		switch t := o.(type) {
+		case withoutCrypto:
+			return nil, false
+		case crypto.Option:
+			cryptoOpts = append(cryptoOpts, t)
+		}
+	}
+
+	return cryptoOpts, true
+}
+
+// injectCrypto adds crypto to the global object, unless opted out, with the
+// crypto.Option values of opt
+func injectCrypto(iso *v8go.Isolate, global *v8go.ObjectTemplate, opt []interface{}) error {
+	cryptoOpts, ok := cryptoOptions(opt)
+	if !ok {
+		return nil
+	}
+
+	return crypto.InjectToGlobal(iso, global, cryptoOpts...)
+}
+
+// injectCryptoWith adds crypto to an existing context like injectCrypto, the
+// contexts created from a global object with crypto keep theirs and set it up
+func injectCryptoWith(ctx *v8go.Context, iso *v8go.Isolate, opt []interface{}) error {
+	cryptoOpts, ok := cryptoOptions(opt)
+	if !ok {
+		return nil
+	}
+	if ctx.Global().Has("crypto") {
+		return crypto.InitContext(ctx)
+	}
+
+	return crypto.InjectWith(iso, ctx, cryptoOpts...)
+}
+
+func InjectToGlobalObjectWithCustomFetch(iso *v8go.Isolate, global *v8go.ObjectTemplate, fetcher *fetch.Fetch, opt ...interface{}) error {
 
 	if err := fetch.InjectWithFetcherTo(iso, global, fetcher); err != nil {
 		return err
@@ -56,6 +106,10 @@ func InjectToGlobalObjectWithCustomFetch(iso *v8go.Isolate, global *v8go.ObjectT
 		return err
 	}
 
+	if err := injectCrypto(iso, global, opt); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -87,6 +141,10 @@ func InjectToGlobalObject(iso *v8go.Isolate, global *v8go.ObjectTemplate, opt ..
 	if err := textDecoder.InjectWith(iso, global); err != nil {
 		return err
 	}
+
+	if err := injectCrypto(iso, global, opt); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -102,15 +160,17 @@ func InjectToContext(ctx *v8go.Context, iso *v8go.Isolate, opt ...interface{}) e
 
 	for _, p := range []func(*v8go.Context) error{
 		url.InjectTo,
+		domexception.InjectTo,
 	} {
 		if err := p(ctx); err != nil {
 			return err
 		}
 	}
 
-	// if err := crypto.InjectWith(iso, ctx); err != nil {
-	// 	return err
-	// }
+	if err := injectCryptoWith(ctx, iso, opt); err != nil {
+		return err
+	}
+
 	if err := console.InjectTo(ctx, consoleOpts...); err != nil {
 		return err
 	}
@@ -0,0 +1,112 @@
+/*
+ * Copyright (c) 2021 Xingwang Liao
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package polyfills
+
+import (
+	"testing"
+
+	"github.com/esoptra/v8go"
+	"github.com/esoptra/v8go-polyfills/eventloop"
+)
+
+func TestInjectToGlobalObject(t *testing.T) {
+	for _, tc := range []struct {
+		Name     string
+		Opt      []interface{}
+		Expected string
+	}{
+		{Name: "default", Expected: "object,function,function,function"},
+		{Name: "without crypto", Opt: []interface{}{WithoutCrypto()}, Expected: "undefined,undefined,undefined,undefined"},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			iso := v8go.NewIsolate()
+			defer iso.Dispose()
+
+			global := v8go.NewObjectTemplate(iso)
+			if err := InjectToGlobalObject(iso, global, tc.Opt...); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := v8go.NewContext(iso, global)
+			defer eventloop.Close(ctx)
+
+			val, err := ctx.RunScript(`[typeof crypto, typeof (globalThis.crypto && crypto.subtle.digest), typeof globalThis.CryptoKey, typeof globalThis.SubtleCrypto].join()`, "inject.js")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if val.String() != tc.Expected {
+				t.Errorf("expected %s but got %s", tc.Expected, val.String())
+			}
+		})
+	}
+}
+
+func TestInjectToContext(t *testing.T) {
+	for _, tc := range []struct {
+		Name     string
+		Global   bool
+		Opt      []interface{}
+		Expected string
+	}{
+		{Name: "default", Expected: "object,function,function,function"},
+		{Name: "without crypto", Opt: []interface{}{WithoutCrypto()}, Expected: "undefined,undefined,undefined,undefined"},
+		{Name: "from global object", Global: true, Expected: "object,function,function,function"},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			iso := v8go.NewIsolate()
+			defer iso.Dispose()
+
+			global := v8go.NewObjectTemplate(iso)
+			if tc.Global {
+				if err := InjectToGlobalObject(iso, global); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			ctx := v8go.NewContext(iso, global)
+			defer eventloop.Close(ctx)
+
+			if _, err := ctx.RunScript(`const before = globalThis.crypto`, "before.js"); err != nil {
+				t.Fatal(err)
+			}
+			if err := InjectToContext(ctx, iso, tc.Opt...); err != nil {
+				t.Fatal(err)
+			}
+
+			val, err := ctx.RunScript(`[typeof crypto, typeof (globalThis.crypto && crypto.subtle.digest), typeof globalThis.CryptoKey, typeof globalThis.SubtleCrypto].join()`, "inject.js")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if val.String() != tc.Expected {
+				t.Errorf("expected %s but got %s", tc.Expected, val.String())
+			}
+
+			// the crypto of the global object, with its host keys, is kept and set up
+			if kept, err := ctx.RunScript(`before === undefined || before === crypto`, "kept.js"); err != nil || !kept.Boolean() {
+				t.Errorf("crypto of the global object was replaced: %v", err)
+			}
+			if ready, err := ctx.RunScript(`globalThis.crypto === undefined || crypto instanceof Crypto`, "ready.js"); err != nil || !ready.Boolean() {
+				t.Errorf("crypto is not set up: %v", err)
+			}
+		})
+	}
+}
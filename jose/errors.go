@@ -0,0 +1,154 @@
+/*
+ * Copyright (c) 2021 Twintag
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package jose
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/esoptra/v8go"
+)
+
+// Kinds of jose failures, match them with errors.Is
+var (
+	ErrJWSInvalid          = errors.New("invalid JWS")
+	ErrJWEInvalid          = errors.New("invalid JWE")
+	ErrJWTInvalid          = errors.New("invalid JWT")
+	ErrJWTExpired          = errors.New("JWT expired")
+	ErrClaimValidation     = errors.New("JWT claim validation failed")
+	ErrSignatureInvalid    = errors.New("signature verification failed")
+	ErrDecryptionFailed    = errors.New("decryption failed")
+	ErrAlgorithmNotAllowed = errors.New("algorithm not allowed")
+	ErrNotSupported        = errors.New("not supported")
+	ErrJWKSInvalid         = errors.New("invalid JWKS")
+	ErrJWKSFetch           = errors.New("JWKS fetch failed")
+	ErrNoMatchingKey       = errors.New("no matching key")
+)
+
+// errorCodes names the kinds the way the jose npm package does, so scripts
+// written against it can switch on err.code
+var errorCodes = []struct {
+	Kind error
+	Name string
+	Code string
+}{
+	{Kind: ErrJWSInvalid, Name: "JWSInvalid", Code: "ERR_JWS_INVALID"},
+	{Kind: ErrJWEInvalid, Name: "JWEInvalid", Code: "ERR_JWE_INVALID"},
+	{Kind: ErrJWTInvalid, Name: "JWTInvalid", Code: "ERR_JWT_INVALID"},
+	{Kind: ErrJWTExpired, Name: "JWTExpired", Code: "ERR_JWT_EXPIRED"},
+	{Kind: ErrClaimValidation, Name: "JWTClaimValidationFailed", Code: "ERR_JWT_CLAIM_VALIDATION_FAILED"},
+	{Kind: ErrSignatureInvalid, Name: "JWSSignatureVerificationFailed", Code: "ERR_JWS_SIGNATURE_VERIFICATION_FAILED"},
+	{Kind: ErrDecryptionFailed, Name: "JWEDecryptionFailed", Code: "ERR_JWE_DECRYPTION_FAILED"},
+	{Kind: ErrAlgorithmNotAllowed, Name: "JOSEAlgNotAllowed", Code: "ERR_JOSE_ALG_NOT_ALLOWED"},
+	{Kind: ErrNotSupported, Name: "JOSENotSupported", Code: "ERR_JOSE_NOT_SUPPORTED"},
+	{Kind: ErrJWKSInvalid, Name: "JWKSInvalid", Code: "ERR_JWKS_INVALID"},
+	{Kind: ErrJWKSFetch, Name: "JWKSFetchFailed", Code: "ERR_JWKS_FETCH_FAILED"},
+	{Kind: ErrNoMatchingKey, Name: "JWKSNoMatchingKey", Code: "ERR_JWKS_NO_MATCHING_KEY"},
+}
+
+// Error is the failure of a jose call. Scripts receive it as an Error whose
+// name and code tell the kind, claim names the JWT claim which failed.
+type Error struct {
+	Kind  error
+	Claim string
+	Err   error
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Kind.Error()
+	}
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Is(target error) bool {
+	return e.Kind == target
+}
+
+func newError(kind error, format string, a ...interface{}) *Error {
+	return &Error{Kind: kind, Err: fmt.Errorf(format, a...)}
+}
+
+func newClaimError(kind error, claim string, format string, a ...interface{}) *Error {
+	return &Error{Kind: kind, Claim: claim, Err: fmt.Errorf(format, a...)}
+}
+
+// rejectValue creates the value a promise of the method is rejected with,
+// errors which aren't an *Error are invalid arguments and become a TypeError
+func rejectValue(ctx *v8go.Context, method string, err error) *v8go.Value {
+	msg := fmt.Sprintf("jose.%s: %v", method, err)
+
+	var je *Error
+	if !errors.As(err, &je) {
+		return newErrorValue(ctx, "TypeError", msg)
+	}
+
+	val := newErrorValue(ctx, "Error", msg)
+	obj, err := val.AsObject()
+	if err != nil {
+		return val
+	}
+
+	for _, c := range errorCodes {
+		if c.Kind == je.Kind {
+			_ = obj.Set("name", c.Name)
+			_ = obj.Set("code", c.Code)
+			break
+		}
+	}
+	if je.Claim != "" {
+		_ = obj.Set("claim", je.Claim)
+	}
+
+	return val
+}
+
+// newErrorValue creates an instance of the error constructor ctorName,
+// falling back to a string
+func newErrorValue(ctx *v8go.Context, ctorName string, msg string) *v8go.Value {
+	iso := ctx.Isolate()
+
+	msgVal, err := v8go.NewValue(iso, msg)
+	if err != nil {
+		return nil
+	}
+
+	ctor, err := ctx.Global().Get(ctorName)
+	if err != nil {
+		return msgVal
+	}
+	fn, err := ctor.AsFunction()
+	if err != nil {
+		return msgVal
+	}
+	obj, err := fn.NewInstance(msgVal)
+	if err != nil {
+		return msgVal
+	}
+
+	return obj.Value
+}
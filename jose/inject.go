@@ -0,0 +1,87 @@
+/*
+ * Copyright (c) 2021 Twintag
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package jose
+
+import (
+	"fmt"
+
+	"github.com/esoptra/v8go"
+)
+
+// newTemplate creates the jose object
+func (j *Jose) newTemplate(iso *v8go.Isolate) (*v8go.ObjectTemplate, error) {
+	methods := []struct {
+		Name string
+		Cb   v8go.FunctionCallback
+	}{
+		{Name: "jwtVerify", Cb: j.jwtVerifyCallback()},
+		{Name: "sign", Cb: j.signCallback()},
+		{Name: "decrypt", Cb: j.decryptCallback()},
+	}
+
+	tmpl := v8go.NewObjectTemplate(iso)
+	for _, m := range methods {
+		if err := tmpl.Set(m.Name, v8go.NewFunctionTemplate(iso, m.Cb), v8go.ReadOnly); err != nil {
+			return nil, fmt.Errorf("v8go-polyfills/jose %s: %w", m.Name, err)
+		}
+	}
+
+	return tmpl, nil
+}
+
+// InjectTo injects the jose global into a global object template
+func InjectTo(iso *v8go.Isolate, global *v8go.ObjectTemplate, opt ...Option) error {
+	return InjectWithJoseTo(iso, global, New(opt...))
+}
+
+// InjectWithJoseTo injects j as the jose global, isolates sharing j share
+// its JWKS cache
+func InjectWithJoseTo(iso *v8go.Isolate, global *v8go.ObjectTemplate, j *Jose) error {
+	tmpl, err := j.newTemplate(iso)
+	if err != nil {
+		return err
+	}
+
+	if err := global.Set("jose", tmpl, v8go.ReadOnly); err != nil {
+		return fmt.Errorf("v8go-polyfills/jose: %w", err)
+	}
+	return nil
+}
+
+// InjectWith injects the jose global into the global object of ctx
+func InjectWith(iso *v8go.Isolate, ctx *v8go.Context, opt ...Option) error {
+	tmpl, err := New(opt...).newTemplate(iso)
+	if err != nil {
+		return err
+	}
+
+	obj, err := tmpl.NewInstance(ctx)
+	if err != nil {
+		return fmt.Errorf("v8go-polyfills/jose: %w", err)
+	}
+
+	if err := ctx.Global().Set("jose", obj); err != nil {
+		return fmt.Errorf("v8go-polyfills/jose: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,520 @@
+/*
+ * Copyright (c) 2021 Twintag
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package jose
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/esoptra/v8go"
+	"github.com/esoptra/v8go-polyfills/eventloop"
+	"github.com/esoptra/v8go-polyfills/fetch"
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwe"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/lestrrat-go/jwx/jws"
+	"github.com/lestrrat-go/jwx/jwt"
+)
+
+// Jose backs the jose global of scripts: JWTs are verified, JWS signed and
+// JWE decrypted in Go with lestrrat-go/jwx, remote JWKS are loaded with the
+// fetcher and cached
+type Jose struct {
+	// Fetcher loads the remote JWKS, relative URLs are served by its local handler
+	Fetcher *fetch.Fetch
+	// JWKSCacheTTL is how long a JWKS is cached when its response has no
+	// Cache-Control max-age
+	JWKSCacheTTL time.Duration
+	// JWKSRefreshInterval is the minimum age of a cached JWKS reloaded
+	// because no key matches a token, e.g. after the issuer rotated its keys
+	JWKSRefreshInterval time.Duration
+	// Now is the clock the exp, nbf and iat claims are checked against
+	Now func() time.Time
+
+	jwksMu sync.Mutex
+	jwks   map[string]*jwksEntry
+}
+
+func New(opt ...Option) *Jose {
+	j := &Jose{
+		JWKSCacheTTL:        10 * time.Minute,
+		JWKSRefreshInterval: 30 * time.Second,
+		Now:                 time.Now,
+	}
+
+	for _, o := range opt {
+		o.apply(j)
+	}
+
+	if j.Fetcher == nil {
+		j.Fetcher = fetch.NewFetcher()
+	}
+
+	return j
+}
+
+// stringList is a JSON string or an array of strings
+type stringList []string
+
+func (l *stringList) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*l = stringList{s}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(l))
+}
+
+func (l stringList) contains(s string) bool {
+	for _, v := range l {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// seconds is a JSON number of seconds or a duration string such as "30s"
+type seconds time.Duration
+
+func (s *seconds) UnmarshalJSON(data []byte) error {
+	var n float64
+	if err := json.Unmarshal(data, &n); err == nil {
+		*s = seconds(n * float64(time.Second))
+		return nil
+	}
+
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return fmt.Errorf("expected seconds or a duration string")
+	}
+	d, err := time.ParseDuration(str)
+	if err != nil {
+		return err
+	}
+	*s = seconds(d)
+	return nil
+}
+
+type verifyOptions struct {
+	Issuer         stringList `json:"issuer"`
+	Audience       stringList `json:"audience"`
+	Subject        string     `json:"subject"`
+	Algorithms     stringList `json:"algorithms"`
+	ClockTolerance seconds    `json:"clockTolerance"`
+}
+
+type signOptions struct {
+	Alg    string                 `json:"alg"`
+	Kid    string                 `json:"kid"`
+	Typ    string                 `json:"typ"`
+	Header map[string]interface{} `json:"header"`
+}
+
+type decryptOptions struct {
+	KeyManagementAlgorithms     stringList `json:"keyManagementAlgorithms"`
+	ContentEncryptionAlgorithms stringList `json:"contentEncryptionAlgorithms"`
+}
+
+type verifyResult struct {
+	Payload         json.RawMessage `json:"payload"`
+	ProtectedHeader json.RawMessage `json:"protectedHeader"`
+}
+
+type decryptResult struct {
+	Plaintext       string          `json:"plaintext"`
+	ProtectedHeader json.RawMessage `json:"protectedHeader"`
+}
+
+// getOptions decodes the optional options argument into opts
+func getOptions(args []*v8go.Value, i int, opts interface{}) error {
+	if len(args) <= i || args[i].IsUndefined() || args[i].IsNull() {
+		return nil
+	}
+	if !args[i].IsObject() {
+		return fmt.Errorf("options must be an object")
+	}
+
+	data, err := args[i].MarshalJSON()
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, opts); err != nil {
+		return fmt.Errorf("invalid options: %v", err)
+	}
+	return nil
+}
+
+// allowed reports whether alg is in the allow list, an empty list allows any
+func allowed(algs stringList, alg string) bool {
+	return len(algs) == 0 || algs.contains(alg)
+}
+
+type jwsHeader struct {
+	Alg  string   `json:"alg"`
+	Kid  string   `json:"kid"`
+	Crit []string `json:"crit"`
+}
+
+// verifyJWS verifies a compact JWS with the keys of src, it returns the
+// payload and the protected header
+func (j *Jose) verifyJWS(token string, src *keySource, algorithms stringList) ([]byte, []byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, nil, newError(ErrJWSInvalid, "a compact JWS has 3 parts, got %d", len(parts))
+	}
+
+	var header jwsHeader
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err == nil {
+		err = json.Unmarshal(headerJSON, &header)
+	}
+	if err != nil {
+		return nil, nil, newError(ErrJWSInvalid, "invalid protected header: %v", err)
+	}
+
+	if len(header.Crit) > 0 {
+		return nil, nil, newError(ErrNotSupported, "critical header parameters %v aren't supported", header.Crit)
+	}
+	if header.Alg == "" || header.Alg == string(jwa.NoSignature) || !allowed(algorithms, header.Alg) {
+		return nil, nil, newError(ErrAlgorithmNotAllowed, "alg %q isn't allowed", header.Alg)
+	}
+
+	keys, err := j.candidateKeys(src, header.Kid, header.Alg, "sig")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, key := range keys {
+		raw, err := rawKey(key)
+		if err != nil {
+			continue
+		}
+		if payload, err := jws.Verify([]byte(token), jwa.SignatureAlgorithm(header.Alg), raw); err == nil {
+			return payload, headerJSON, nil
+		}
+	}
+
+	return nil, nil, newError(ErrSignatureInvalid, "signature verification failed")
+}
+
+// validateClaims checks the exp and nbf claims of a JWT payload, allowing the
+// clock tolerance, and the expected issuer, audience and subject. Like the
+// jose npm package, timestamps are compared in whole seconds.
+func (j *Jose) validateClaims(payload []byte, opts *verifyOptions) error {
+	tok := jwt.New()
+	if err := json.Unmarshal(payload, tok); err != nil {
+		return newError(ErrJWTInvalid, "the payload isn't a JSON object of claims: %v", err)
+	}
+
+	now := j.Now().Truncate(time.Second)
+	tolerance := time.Duration(opts.ClockTolerance)
+
+	if exp := tok.Expiration(); !exp.IsZero() && !now.Before(exp.Add(tolerance)) {
+		return newClaimError(ErrJWTExpired, jwt.ExpirationKey, `"exp" claim timestamp check failed`)
+	}
+
+	if nbf := tok.NotBefore(); !nbf.IsZero() && nbf.After(now.Add(tolerance)) {
+		return newClaimError(ErrClaimValidation, jwt.NotBeforeKey, `"nbf" claim timestamp check failed`)
+	}
+
+	if len(opts.Issuer) > 0 && !opts.Issuer.contains(tok.Issuer()) {
+		return newClaimError(ErrClaimValidation, jwt.IssuerKey, `unexpected "iss" claim value`)
+	}
+
+	if opts.Subject != "" && tok.Subject() != opts.Subject {
+		return newClaimError(ErrClaimValidation, jwt.SubjectKey, `unexpected "sub" claim value`)
+	}
+
+	if len(opts.Audience) > 0 {
+		found := false
+		for _, aud := range tok.Audience() {
+			if opts.Audience.contains(aud) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return newClaimError(ErrClaimValidation, jwt.AudienceKey, `unexpected "aud" claim value`)
+		}
+	}
+
+	return nil
+}
+
+// signJWS signs payload into a compact JWS, alg and kid default to the
+// members of the key
+func (j *Jose) signJWS(payload []byte, key jwk.Key, opts *signOptions) (string, error) {
+	alg := opts.Alg
+	if alg == "" {
+		alg = key.Algorithm()
+	}
+	if alg == "" {
+		return "", fmt.Errorf("alg is required when the key has none")
+	}
+	if alg == string(jwa.NoSignature) {
+		return "", newError(ErrAlgorithmNotAllowed, "alg %q isn't allowed", alg)
+	}
+
+	hdrs := jws.NewHeaders()
+	for k, v := range opts.Header {
+		if err := hdrs.Set(k, v); err != nil {
+			return "", fmt.Errorf("invalid header %q: %v", k, err)
+		}
+	}
+
+	kid := opts.Kid
+	if kid == "" {
+		kid = key.KeyID()
+	}
+	if kid != "" {
+		_ = hdrs.Set(jws.KeyIDKey, kid)
+	}
+	if opts.Typ != "" {
+		_ = hdrs.Set(jws.TypeKey, opts.Typ)
+	}
+
+	raw, err := rawKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	signed, err := jws.Sign(payload, jwa.SignatureAlgorithm(alg), raw, jws.WithHeaders(hdrs))
+	if err != nil {
+		return "", fmt.Errorf("can't sign with a %s key and alg %q: %v", key.KeyType(), alg, err)
+	}
+	return string(signed), nil
+}
+
+// decryptJWE decrypts a JWE with the keys of src, it returns the plaintext
+// and the protected header
+func (j *Jose) decryptJWE(token []byte, src *keySource, opts *decryptOptions) ([]byte, []byte, error) {
+	msg, err := jwe.Parse(token)
+	if err != nil {
+		return nil, nil, newError(ErrJWEInvalid, "%v", err)
+	}
+
+	h := msg.ProtectedHeaders()
+	alg := string(h.Algorithm())
+	if !allowed(opts.KeyManagementAlgorithms, alg) {
+		return nil, nil, newError(ErrAlgorithmNotAllowed, "alg %q isn't allowed", alg)
+	}
+	if enc := string(h.ContentEncryption()); !allowed(opts.ContentEncryptionAlgorithms, enc) {
+		return nil, nil, newError(ErrAlgorithmNotAllowed, "enc %q isn't allowed", enc)
+	}
+
+	headerJSON, err := json.Marshal(h)
+	if err != nil {
+		return nil, nil, newError(ErrJWEInvalid, "invalid protected header: %v", err)
+	}
+
+	keys, err := j.candidateKeys(src, h.KeyID(), alg, "enc")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, key := range keys {
+		raw, err := rawKey(key)
+		if err != nil {
+			continue
+		}
+		if plaintext, err := jwe.Decrypt(token, h.Algorithm(), raw); err == nil {
+			return plaintext, headerJSON, nil
+		}
+	}
+
+	return nil, nil, newError(ErrDecryptionFailed, "decryption failed")
+}
+
+// work is the part of a jose method running off the event loop, its result is
+// passed to the script as JSON
+type work func() (interface{}, error)
+
+// promiseCallback creates the callback of a jose method: prepare checks the
+// arguments synchronously, the work it returns settles the promise
+func promiseCallback(method string, minArgs int, prepare func(args []*v8go.Value) (work, error)) v8go.FunctionCallback {
+	return func(info *v8go.FunctionCallbackInfo) *v8go.Value {
+		ctx := info.Context()
+		iso := ctx.Isolate()
+		resolver, err := v8go.NewPromiseResolver(ctx)
+		if err != nil {
+			strErr, _ := v8go.NewValue(iso, fmt.Sprintf("error creating newPromiseResolver with ctx: %#v", err))
+			return iso.ThrowException(strErr)
+		}
+
+		args := info.Args()
+		if len(args) < minArgs {
+			resolver.Reject(rejectValue(ctx, method, fmt.Errorf("%d arguments required, but only %d present", minArgs, len(args))))
+			return resolver.GetPromise().Value
+		}
+
+		do, err := prepare(args)
+		if err != nil {
+			resolver.Reject(rejectValue(ctx, method, err))
+			return resolver.GetPromise().Value
+		}
+
+		eventloop.For(ctx).Go(func() func() {
+			result, err := do()
+			var data []byte
+			if err == nil {
+				data, err = json.Marshal(result)
+			}
+
+			return func() {
+				if err != nil {
+					resolver.Reject(rejectValue(ctx, method, err))
+					return
+				}
+
+				val, err := v8go.JSONParse(ctx, string(data))
+				if err != nil {
+					resolver.Reject(rejectValue(ctx, method, err))
+					return
+				}
+				resolver.Resolve(val)
+			}
+		})
+
+		return resolver.GetPromise().Value
+	}
+}
+
+// jwtVerifyCallback implements jose.jwtVerify(jwt, key, options), it fulfills
+// with the payload and the protected header of a valid JWT:
+//
+//	const { payload } = await jose.jwtVerify(token, "https://issuer.example/jwks.json", { issuer, audience, clockTolerance: 30 });
+func (j *Jose) jwtVerifyCallback() v8go.FunctionCallback {
+	return promiseCallback("jwtVerify", 2, func(args []*v8go.Value) (work, error) {
+		if !args[0].IsString() {
+			return nil, fmt.Errorf("the JWT must be a string")
+		}
+		token := strings.TrimSpace(args[0].String())
+
+		src, err := getKeySource(args[1])
+		if err != nil {
+			return nil, err
+		}
+
+		opts := &verifyOptions{}
+		if err := getOptions(args, 2, opts); err != nil {
+			return nil, err
+		}
+
+		return func() (interface{}, error) {
+			payload, header, err := j.verifyJWS(token, src, opts.Algorithms)
+			if err != nil {
+				return nil, err
+			}
+			if err := j.validateClaims(payload, opts); err != nil {
+				return nil, err
+			}
+			return &verifyResult{Payload: payload, ProtectedHeader: header}, nil
+		}, nil
+	})
+}
+
+// signCallback implements jose.sign(payload, key, options), it fulfills with
+// a compact JWS of the payload, objects are signed as JSON:
+//
+//	const jwt = await jose.sign({ sub: "42", exp }, privateJwk, { alg: "ES256", typ: "JWT" });
+func (j *Jose) signCallback() v8go.FunctionCallback {
+	return promiseCallback("sign", 2, func(args []*v8go.Value) (work, error) {
+		var payload []byte
+		switch {
+		case args[0].IsString():
+			payload = []byte(args[0].String())
+		case args[0].IsObject():
+			data, err := args[0].MarshalJSON()
+			if err != nil {
+				return nil, err
+			}
+			payload = data
+		default:
+			return nil, fmt.Errorf("the payload must be a string or an object")
+		}
+
+		src, err := getKeySource(args[1])
+		if err != nil {
+			return nil, err
+		}
+		if src.URL != "" || src.Set.Len() != 1 {
+			return nil, fmt.Errorf("sign needs a single private key")
+		}
+		key, _ := src.Set.Get(0)
+
+		opts := &signOptions{}
+		if err := getOptions(args, 2, opts); err != nil {
+			return nil, err
+		}
+
+		return func() (interface{}, error) {
+			return j.signJWS(payload, key, opts)
+		}, nil
+	})
+}
+
+// decryptCallback implements jose.decrypt(jwe, key, options), it fulfills
+// with the plaintext, decoded as UTF-8, and the protected header of the JWE:
+//
+//	const { plaintext } = await jose.decrypt(jwe, privateJwk, { keyManagementAlgorithms: ["RSA-OAEP-256"] });
+func (j *Jose) decryptCallback() v8go.FunctionCallback {
+	return promiseCallback("decrypt", 2, func(args []*v8go.Value) (work, error) {
+		var token []byte
+		switch {
+		case args[0].IsString():
+			token = []byte(strings.TrimSpace(args[0].String()))
+		case args[0].IsObject():
+			// JSON serialization
+			data, err := args[0].MarshalJSON()
+			if err != nil {
+				return nil, err
+			}
+			token = data
+		default:
+			return nil, fmt.Errorf("the JWE must be a string or an object")
+		}
+
+		src, err := getKeySource(args[1])
+		if err != nil {
+			return nil, err
+		}
+
+		opts := &decryptOptions{}
+		if err := getOptions(args, 2, opts); err != nil {
+			return nil, err
+		}
+
+		return func() (interface{}, error) {
+			plaintext, header, err := j.decryptJWE(token, src, opts)
+			if err != nil {
+				return nil, err
+			}
+			return &decryptResult{Plaintext: string(plaintext), ProtectedHeader: header}, nil
+		}, nil
+	})
+}
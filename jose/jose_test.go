@@ -0,0 +1,298 @@
+/*
+ * Copyright (c) 2021 Twintag
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package jose
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/esoptra/v8go"
+	"github.com/esoptra/v8go-polyfills/eventloop"
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwe"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/lestrrat-go/jwx/jws"
+)
+
+func runAsync(ctx *v8go.Context, script string) (*v8go.Value, error) {
+	val, err := ctx.RunScript(script, "jose_async.js")
+	if err != nil {
+		return nil, err
+	}
+
+	if !val.IsPromise() {
+		return val, nil
+	}
+
+	proms, err := val.AsPromise()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := eventloop.For(ctx).RunFor(time.Second * 10); err != nil {
+		return nil, err
+	}
+
+	if proms.State() == v8go.Rejected {
+		return nil, fmt.Errorf("promise rejected: %s", proms.Result().DetailString())
+	}
+
+	return proms.Result(), nil
+}
+
+func newV8ContextWithJose(opt ...Option) (*v8go.Context, error) {
+	iso := v8go.NewIsolate()
+	global := v8go.NewObjectTemplate(iso)
+
+	if err := InjectTo(iso, global, opt...); err != nil {
+		return nil, err
+	}
+
+	return v8go.NewContext(iso, global), nil
+}
+
+// signJWT signs claims in Go, the way an issuer does
+func signJWT(t *testing.T, claims map[string]interface{}, alg jwa.SignatureAlgorithm, key interface{}, kid string) string {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hdrs := jws.NewHeaders()
+	_ = hdrs.Set(jws.KeyIDKey, kid)
+	_ = hdrs.Set(jws.TypeKey, "JWT")
+
+	token, err := jws.Sign(payload, alg, key, jws.WithHeaders(hdrs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(token)
+}
+
+func publicJWKS(t *testing.T, keys map[string]interface{}) []byte {
+	set := jwk.NewSet()
+	for kid, raw := range keys {
+		key, err := jwk.New(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = key.Set(jwk.KeyIDKey, kid)
+		set.Add(key)
+	}
+
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestJWTVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	key1, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key2, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var hits int32
+	jwks := publicJWKS(t, map[string]interface{}{"k1": &key1.PublicKey})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("Cache-Control", "public, max-age=600")
+		_, _ = w.Write(jwks)
+	}))
+	defer srv.Close()
+
+	ctx, err := newV8ContextWithJose(WithClock(func() time.Time { return now }), WithJWKSRefreshInterval(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ctx.Isolate().Dispose()
+	defer eventloop.Close(ctx)
+
+	claims := func(exp time.Duration, aud string) map[string]interface{} {
+		return map[string]interface{}{"iss": "https://issuer.example", "aud": aud, "sub": "42", "exp": now.Add(exp).Unix()}
+	}
+	tokens := map[string]string{
+		"valid":   signJWT(t, claims(time.Hour, "api"), jwa.RS256, key1, "k1"),
+		"expired": signJWT(t, claims(-10*time.Second, "api"), jwa.RS256, key1, "k1"),
+		"other":   signJWT(t, claims(time.Hour, "web"), jwa.RS256, key1, "k1"),
+		"rotated": signJWT(t, claims(time.Hour, "api"), jwa.ES256, key2, "k2"),
+		"unknown": signJWT(t, claims(time.Hour, "api"), jwa.RS256, key1, "k3"),
+		"early":   signJWT(t, map[string]interface{}{"nbf": now.Add(time.Minute).Unix()}, jwa.RS256, key1, "k1"),
+	}
+	tokens["tampered"] = tokens["valid"][:len(tokens["valid"])-4] + "AAAA"
+	tokens["none"] = "eyJhbGciOiJub25lIn0.eyJzdWIiOiI0MiJ9."
+
+	tokensJSON, _ := json.Marshal(tokens)
+	if _, err := ctx.RunScript(fmt.Sprintf("const tokens = %s; const jwks = %q;", tokensJSON, srv.URL+"/jwks.json"), "tokens.js"); err != nil {
+		t.Fatal(err)
+	}
+
+	val, err := runAsync(ctx, `
+	const opts = { issuer: ["https://other.example", "https://issuer.example"], audience: "api" };
+	const failure = (p) => p.then(() => "none", (e) => [e.name, e.code, e.claim].filter(Boolean).join(" "));
+	(async () => {
+		const { payload, protectedHeader } = await jose.jwtVerify(tokens.valid, jwks, opts);
+		await jose.jwtVerify(tokens.valid, jwks, opts);
+		return JSON.stringify({
+			sub: payload.sub,
+			header: protectedHeader,
+			tolerated: (await jose.jwtVerify(tokens.expired, jwks, { clockTolerance: "30s" })).payload.sub,
+			expired: await failure(jose.jwtVerify(tokens.expired, jwks, opts)),
+			audience: await failure(jose.jwtVerify(tokens.other, jwks, opts)),
+			issuer: await failure(jose.jwtVerify(tokens.valid, jwks, { issuer: "https://other.example" })),
+			subject: await failure(jose.jwtVerify(tokens.valid, jwks, { subject: "43" })),
+			early: await failure(jose.jwtVerify(tokens.early, jwks)),
+			tolerant: (await jose.jwtVerify(tokens.early, jwks, { clockTolerance: 60 })).payload.nbf > 0,
+			tampered: await failure(jose.jwtVerify(tokens.tampered, jwks)),
+			none: await failure(jose.jwtVerify(tokens.none, jwks)),
+			algorithms: await failure(jose.jwtVerify(tokens.valid, jwks, { algorithms: ["ES256"] })),
+			invalid: await failure(jose.jwtVerify("not.a-jwt", jwks)),
+			key: await failure(jose.jwtVerify(tokens.valid, 42)),
+		});
+	})()`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"sub":"42","header":{"alg":"RS256","kid":"k1","typ":"JWT"},"tolerated":"42",` +
+		`"expired":"JWTExpired ERR_JWT_EXPIRED exp",` +
+		`"audience":"JWTClaimValidationFailed ERR_JWT_CLAIM_VALIDATION_FAILED aud",` +
+		`"issuer":"JWTClaimValidationFailed ERR_JWT_CLAIM_VALIDATION_FAILED iss",` +
+		`"subject":"JWTClaimValidationFailed ERR_JWT_CLAIM_VALIDATION_FAILED sub",` +
+		`"early":"JWTClaimValidationFailed ERR_JWT_CLAIM_VALIDATION_FAILED nbf",` +
+		`"tolerant":true,` +
+		`"tampered":"JWSSignatureVerificationFailed ERR_JWS_SIGNATURE_VERIFICATION_FAILED",` +
+		`"none":"JOSEAlgNotAllowed ERR_JOSE_ALG_NOT_ALLOWED",` +
+		`"algorithms":"JOSEAlgNotAllowed ERR_JOSE_ALG_NOT_ALLOWED",` +
+		`"invalid":"JWSInvalid ERR_JWS_INVALID",` +
+		`"key":"TypeError"}`
+	if val.String() != expected {
+		t.Errorf("expected %s but got %s", expected, val.String())
+	}
+	if n := atomic.LoadInt32(&hits); n != 1 {
+		t.Errorf("expected the JWKS to be fetched once, got %d", n)
+	}
+
+	// the issuer rotates its keys, a token with an unknown kid reloads the set
+	mu.Lock()
+	jwks = publicJWKS(t, map[string]interface{}{"k1": &key1.PublicKey, "k2": &key2.PublicKey})
+	mu.Unlock()
+
+	val, err = runAsync(ctx, `
+	(async () => {
+		const { payload } = await jose.jwtVerify(tokens.rotated, jwks, { audience: "api" });
+		const unknown = await jose.jwtVerify(tokens.unknown, jwks).then(() => "none", (e) => e.code);
+		return JSON.stringify([payload.sub, unknown]);
+	})()`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `["42","ERR_JWKS_NO_MATCHING_KEY"]`; val.String() != expected {
+		t.Errorf("expected %s but got %s", expected, val.String())
+	}
+	if n := atomic.LoadInt32(&hits); n != 3 {
+		t.Errorf("expected the JWKS to be fetched 3 times, got %d", n)
+	}
+}
+
+func TestSignAndDecrypt(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecJWK, _ := jwk.New(ecKey)
+	_ = ecJWK.Set(jwk.KeyIDKey, "sig-1")
+	_ = ecJWK.Set(jwk.AlgorithmKey, "ES256")
+	ecPublicJWK, _ := jwk.PublicKeyOf(ecJWK)
+	rsaJWK, _ := jwk.New(rsaKey)
+
+	encrypted, err := jwe.Encrypt([]byte(`{"secret":"s3cr3t"}`), jwa.RSA_OAEP_256, &rsaKey.PublicKey, jwa.A256GCM, jwa.NoCompress)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, err := newV8ContextWithJose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ctx.Isolate().Dispose()
+	defer eventloop.Close(ctx)
+
+	keys, _ := json.Marshal(map[string]interface{}{"ec": ecJWK, "ecPublic": ecPublicJWK, "rsa": rsaJWK})
+	if _, err := ctx.RunScript(fmt.Sprintf("const keys = %s; const encrypted = %q;", keys, encrypted), "keys.js"); err != nil {
+		t.Fatal(err)
+	}
+
+	val, err := runAsync(ctx, `
+	const failure = (p) => p.then(() => "none", (e) => [e.name, e.code].filter(Boolean).join(" "));
+	(async () => {
+		const exp = Math.floor(Date.now() / 1000) + 60;
+		const token = await jose.sign({ sub: "42", exp }, keys.ec, { typ: "JWT" });
+		const { payload, protectedHeader } = await jose.jwtVerify(token, { keys: [keys.ecPublic] });
+		const { plaintext } = await jose.decrypt(encrypted, keys.rsa);
+		return JSON.stringify({
+			signed: [payload.sub, protectedHeader],
+			plaintext: JSON.parse(plaintext),
+			publicKey: await failure(jose.sign("data", keys.ecPublic)),
+			url: await failure(jose.sign("data", "https://issuer.example/jwks.json")),
+			alg: await failure(jose.decrypt(encrypted, keys.rsa, { keyManagementAlgorithms: ["RSA-OAEP"] })),
+			wrongKey: await failure(jose.decrypt(encrypted, keys.ec)),
+		});
+	})()`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"signed":["42",{"alg":"ES256","kid":"sig-1","typ":"JWT"}],"plaintext":{"secret":"s3cr3t"},` +
+		`"publicKey":"TypeError","url":"TypeError",` +
+		`"alg":"JOSEAlgNotAllowed ERR_JOSE_ALG_NOT_ALLOWED",` +
+		`"wrongKey":"JWKSNoMatchingKey ERR_JWKS_NO_MATCHING_KEY"}`
+	if val.String() != expected {
+		t.Errorf("expected %s but got %s", expected, val.String())
+	}
+}
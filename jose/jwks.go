@@ -0,0 +1,281 @@
+/*
+ * Copyright (c) 2021 Twintag
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package jose
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/esoptra/v8go"
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
+)
+
+// maxJWKSSize caps the body of a remote JWKS
+const maxJWKSSize = 1 << 20
+
+// keySource is the key argument of a jose call: the URL of a JWKS, loaded
+// through the cache, or the keys given by the script
+type keySource struct {
+	URL string
+	Set jwk.Set
+}
+
+// getKeySource accepts a JWKS URL (relative URLs are served by the local
+// handler of the fetcher), PEM encoded keys, a JWK or a JWKS object
+func getKeySource(v *v8go.Value) (*keySource, error) {
+	if v == nil || v.IsUndefined() || v.IsNull() {
+		return nil, fmt.Errorf("a key or JWKS is required")
+	}
+
+	if v.IsString() {
+		s := strings.TrimSpace(v.String())
+		if strings.HasPrefix(s, "-----BEGIN") {
+			set, err := jwk.Parse([]byte(s), jwk.WithPEM(true))
+			if err != nil {
+				return nil, newError(ErrJWKSInvalid, "invalid PEM key: %v", err)
+			}
+			return &keySource{Set: set}, nil
+		}
+
+		u, err := url.Parse(s)
+		if err != nil || (!u.IsAbs() && !strings.HasPrefix(u.Path, "/")) {
+			return nil, fmt.Errorf("%q is neither a JWKS URL nor a PEM key", s)
+		}
+		return &keySource{URL: u.String()}, nil
+	}
+
+	if !v.IsObject() {
+		return nil, fmt.Errorf("a key must be a JWK, a JWKS, a PEM string or a JWKS URL")
+	}
+
+	data, err := v.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	set, err := jwk.Parse(data)
+	if err != nil {
+		return nil, newError(ErrJWKSInvalid, "%v", err)
+	}
+	return &keySource{Set: set}, nil
+}
+
+// jwksEntry is a cached remote JWKS. mu holds a token while the entry is used,
+// concurrent calls wait for one load of the set.
+type jwksEntry struct {
+	mu      chan struct{}
+	set     jwk.Set
+	fetched time.Time
+	expires time.Time
+}
+
+// keySet returns the keys of src. A remote set is served from the cache until
+// it expires, refresh reloads it when it's older than the refresh interval,
+// e.g. after the issuer rotated its keys. A cached set outlives failed loads.
+func (j *Jose) keySet(src *keySource, refresh bool) (jwk.Set, error) {
+	if src.URL == "" {
+		return src.Set, nil
+	}
+
+	entry := j.jwksEntry(src.URL)
+	entry.mu <- struct{}{}
+	defer func() { <-entry.mu }()
+
+	now := j.Now()
+	switch {
+	case entry.set == nil:
+	case now.After(entry.expires):
+	case refresh && now.Sub(entry.fetched) >= j.JWKSRefreshInterval:
+	default:
+		return entry.set, nil
+	}
+
+	set, ttl, err := j.fetchJWKS(src.URL)
+	if err != nil {
+		if entry.set != nil {
+			return entry.set, nil
+		}
+		return nil, err
+	}
+
+	entry.set = set
+	entry.fetched = now
+	entry.expires = now.Add(ttl)
+	return set, nil
+}
+
+// jwksEntry returns the cache entry of a URL, dropping the expired ones
+// when a new URL is added
+func (j *Jose) jwksEntry(rawURL string) *jwksEntry {
+	j.jwksMu.Lock()
+	defer j.jwksMu.Unlock()
+
+	if entry, ok := j.jwks[rawURL]; ok {
+		return entry
+	}
+
+	now := j.Now()
+	for u, entry := range j.jwks {
+		select {
+		case entry.mu <- struct{}{}:
+			expired := entry.set == nil || now.After(entry.expires)
+			<-entry.mu
+			if expired {
+				delete(j.jwks, u)
+			}
+		default:
+			// being loaded
+		}
+	}
+
+	if j.jwks == nil {
+		j.jwks = make(map[string]*jwksEntry)
+	}
+	entry := &jwksEntry{mu: make(chan struct{}, 1)}
+	j.jwks[rawURL] = entry
+	return entry
+}
+
+// fetchJWKS loads a JWKS, it's cached for the max-age of the response or
+// for JWKSCacheTTL
+func (j *Jose) fetchJWKS(rawURL string) (jwk.Set, time.Duration, error) {
+	req, err := http.NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return nil, 0, newError(ErrJWKSFetch, "%v", err)
+	}
+	req.Header.Set("Accept", "application/jwk-set+json, application/json")
+
+	res, err := j.Fetcher.Do(req)
+	if err != nil {
+		return nil, 0, newError(ErrJWKSFetch, "%s: %v", rawURL, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, 0, newError(ErrJWKSFetch, "%s: unexpected status %s", rawURL, res.Status)
+	}
+
+	data, err := ioutil.ReadAll(http.MaxBytesReader(nil, res.Body, maxJWKSSize))
+	if err != nil {
+		return nil, 0, newError(ErrJWKSFetch, "%s: %v", rawURL, err)
+	}
+
+	set, err := jwk.Parse(data)
+	if err != nil {
+		return nil, 0, newError(ErrJWKSInvalid, "%s: %v", rawURL, err)
+	}
+
+	return set, maxAge(res.Header, j.JWKSCacheTTL), nil
+}
+
+// maxAge returns the max-age of a Cache-Control header, or def
+func maxAge(h http.Header, def time.Duration) time.Duration {
+	for _, directive := range strings.Split(h.Get("Cache-Control"), ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		if !strings.HasPrefix(directive, "max-age=") {
+			continue
+		}
+		if secs, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age=")); err == nil && secs >= 0 {
+			return time.Duration(secs) * time.Second
+		}
+	}
+	return def
+}
+
+// keyType returns the type of the keys an algorithm works with, an empty
+// type matches any key
+func keyType(alg string) jwa.KeyType {
+	switch {
+	case strings.HasPrefix(alg, "RS"), strings.HasPrefix(alg, "PS"):
+		return jwa.RSA
+	case strings.HasPrefix(alg, "ES"):
+		return jwa.EC
+	case alg == string(jwa.EdDSA):
+		return jwa.OKP
+	case strings.HasPrefix(alg, "HS"), strings.HasPrefix(alg, "A"), alg == string(jwa.DIRECT), strings.HasPrefix(alg, "PBES2"):
+		return jwa.OctetSeq
+	default:
+		// ECDH-ES works with EC and OKP keys
+		return ""
+	}
+}
+
+// matchingKeys returns the keys of the set a JOSE object with the kid and alg
+// header may be verified or decrypted with. Keys without a kid match any kid.
+func matchingKeys(set jwk.Set, kid string, alg string, use string) []jwk.Key {
+	kty := keyType(alg)
+
+	var keys []jwk.Key
+	for i := 0; i < set.Len(); i++ {
+		key, _ := set.Get(i)
+		switch {
+		case kid != "" && key.KeyID() != "" && key.KeyID() != kid:
+		case kty != "" && key.KeyType() != kty:
+		case key.Algorithm() != "" && key.Algorithm() != alg:
+		case key.KeyUsage() != "" && key.KeyUsage() != use:
+		default:
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// candidateKeys returns the keys of src matching the header, a remote set
+// without a match is reloaded once in case the issuer rotated its keys
+func (j *Jose) candidateKeys(src *keySource, kid string, alg string, use string) ([]jwk.Key, error) {
+	set, err := j.keySet(src, false)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := matchingKeys(set, kid, alg, use)
+	if len(keys) == 0 && src.URL != "" {
+		if set, err = j.keySet(src, true); err != nil {
+			return nil, err
+		}
+		keys = matchingKeys(set, kid, alg, use)
+	}
+
+	if len(keys) == 0 {
+		if kid != "" {
+			return nil, newError(ErrNoMatchingKey, "no %s key with kid %q", alg, kid)
+		}
+		return nil, newError(ErrNoMatchingKey, "no %s key", alg)
+	}
+	return keys, nil
+}
+
+// rawKey returns the Go key of a JWK, e.g. an *rsa.PublicKey or the []byte
+// of an oct key
+func rawKey(key jwk.Key) (interface{}, error) {
+	var raw interface{}
+	if err := key.Raw(&raw); err != nil {
+		return nil, newError(ErrJWKSInvalid, "%v", err)
+	}
+	return raw, nil
+}
@@ -0,0 +1,70 @@
+/*
+ * Copyright (c) 2021 Twintag
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package jose
+
+import (
+	"time"
+
+	"github.com/esoptra/v8go-polyfills/fetch"
+)
+
+type Option interface {
+	apply(j *Jose)
+}
+
+type optionFunc func(j *Jose)
+
+func (f optionFunc) apply(j *Jose) {
+	f(j)
+}
+
+// WithFetcher loads the remote JWKS with f, so they go through its
+// transport, proxy and per-host settings and relative URLs reach its
+// local handler
+func WithFetcher(f *fetch.Fetch) Option {
+	return optionFunc(func(j *Jose) {
+		j.Fetcher = f
+	})
+}
+
+// WithJWKSCacheTTL sets how long a JWKS without a Cache-Control max-age is cached
+func WithJWKSCacheTTL(ttl time.Duration) Option {
+	return optionFunc(func(j *Jose) {
+		j.JWKSCacheTTL = ttl
+	})
+}
+
+// WithJWKSRefreshInterval sets the minimum age of a cached JWKS reloaded
+// because no key matches a token
+func WithJWKSRefreshInterval(d time.Duration) Option {
+	return optionFunc(func(j *Jose) {
+		j.JWKSRefreshInterval = d
+	})
+}
+
+// WithClock sets the clock the exp, nbf and iat claims are checked against
+func WithClock(now func() time.Time) Option {
+	return optionFunc(func(j *Jose) {
+		j.Now = now
+	})
+}
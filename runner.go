@@ -5,6 +5,8 @@ import (
 	"fmt"
 
 	"github.com/esoptra/v8go"
+	"github.com/esoptra/v8go-polyfills/eventloop"
+	"github.com/esoptra/v8go-polyfills/fetch"
 )
 
 type Runner struct {
@@ -54,6 +56,8 @@ func NewRunner(iso *v8go.Isolate, global *v8go.ObjectTemplate) (*Runner, error)
 // RunPromise runs a function that resolves a promise and waits for the
 // promise to resolve, reject or for the context to timeout.
 // Make sure the script includes 'let res = epsilon(data);'
+// The event loop of v8ctx runs while waiting, close v8ctx with
+// eventloop.Close.
 func (r *Runner) RunPromise(ctx context.Context, v8ctx *v8go.Context, script string) (*v8go.Value, error) {
 	code := script + `
 	Promise.resolve(res)`
@@ -66,12 +70,23 @@ func (r *Runner) RunPromise(ctx context.Context, v8ctx *v8go.Context, script str
 	}
 	//fmt.Println("end RunScript")
 
-	select {
-	case res := <-r.resCh:
-		return res, nil
-	case errVal := <-r.errCh:
-		return nil, fmt.Errorf("%v", errVal)
-	case <-ctx.Done():
-		return nil, fmt.Errorf("timeout in RunPromise: %v", ctx.Err())
+	// the timers and the async polyfills settle their promises here, on the
+	// goroutine using v8ctx
+	loop := eventloop.For(v8ctx)
+	for {
+		select {
+		case res := <-r.resCh:
+			return res, nil
+		case errVal := <-r.errCh:
+			// keep fetch failures matchable with errors.Is(err, fetch.ErrTimeout) etc.
+			if fe, ok := fetch.AsError(errVal); ok {
+				return nil, fe
+			}
+			return nil, fmt.Errorf("%v", errVal)
+		case <-loop.Ready():
+			loop.RunOnce()
+		case <-ctx.Done():
+			return nil, fmt.Errorf("timeout in RunPromise: %v", ctx.Err())
+		}
 	}
 }
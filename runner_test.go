@@ -10,6 +10,7 @@ import (
 
 	"github.com/esoptra/v8go"
 	"github.com/esoptra/v8go-polyfills/console"
+	"github.com/esoptra/v8go-polyfills/eventloop"
 	"github.com/esoptra/v8go-polyfills/fetch"
 	"github.com/esoptra/v8go-polyfills/uuid"
 
@@ -110,6 +111,7 @@ func runTestRunner(t *testing.T, script string) {
 	}
 
 	ctx := v8go.NewContext(iso, global)
+	defer eventloop.Close(ctx)
 	if err := crypto.InjectTo(ctx); err != nil {
 		panic(err)
 	}
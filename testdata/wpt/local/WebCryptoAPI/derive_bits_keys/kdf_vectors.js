@@ -0,0 +1,36 @@
+// PBKDF2 and HKDF test vectors, 256 bits derived with each hash
+
+function getTestVectors() {
+  const salt = asciiToBytes("saltSALTsaltSALT");
+  const derived = {
+    PBKDF2: {
+      "SHA-1": "35f27c48f646079208e604250bde43bba26b931b3b5d5bc83a53ccda5a6d2020",
+      "SHA-256": "46f895baaa185f0265c1da708d799953de592f576c4538b7eba99ced700ee75b",
+      "SHA-384": "c2414c5d73815f3fc0ec7420b823f15193faa8a24e8a9b554c334c1f30536d95",
+      "SHA-512": "2febe385f6399aa2a20a9926d1822e2f499daa76ce5e1630fefef84942441307",
+    },
+    HKDF: {
+      "SHA-1": "f64f1b29ab0e32e9a7e5b74446a85224f2d70352780d1f991c0850d1e78cba3d",
+      "SHA-256": "ca8b3fb6a398f4dd8e0c2cfbfcffe7af48e5c34fb30bd9fa90b91ba7d524b1e2",
+      "SHA-384": "cb84871d4f8a6fb24eaefa63baf499d8ccc12b61ce086a6b5677a085380dac01",
+      "SHA-512": "91a958eff155bfc04b301787be73f14eab6165fefde698544484e06bd15704ad",
+    },
+  };
+
+  const vectors = [];
+  for (const hash of Object.keys(derived.PBKDF2)) {
+    vectors.push({
+      name: "PBKDF2 with " + hash,
+      keyBuffer: asciiToBytes("password"),
+      algorithm: { name: "PBKDF2", salt, iterations: 1000, hash },
+      derivation: hexToBytes(derived.PBKDF2[hash]),
+    });
+    vectors.push({
+      name: "HKDF with " + hash,
+      keyBuffer: asciiToBytes("input key material"),
+      algorithm: { name: "HKDF", salt, info: asciiToBytes("info"), hash },
+      derivation: hexToBytes(derived.HKDF[hash]),
+    });
+  }
+  return vectors;
+}
@@ -0,0 +1,70 @@
+// META: script=../util/helpers.js
+// META: script=kdf_vectors.js
+// Tests for PBKDF2 and HKDF deriveBits and deriveKey
+
+function importBaseKey(vector, usages) {
+  return crypto.subtle.importKey("raw", vector.keyBuffer, vector.algorithm.name, false, usages);
+}
+
+for (const vector of getTestVectors()) {
+  promise_test(function () {
+    return importBaseKey(vector, ["deriveBits"]).then(function (key) {
+      return crypto.subtle.deriveBits(vector.algorithm, key, 256);
+    }).then(function (bits) {
+      assert_equals(bytesToHex(bits), bytesToHex(vector.derivation));
+    });
+  }, vector.name + " 256 bits");
+
+  promise_test(function () {
+    return importBaseKey(vector, ["deriveBits"]).then(function (key) {
+      return crypto.subtle.deriveBits(vector.algorithm, key, 128);
+    }).then(function (bits) {
+      assert_equals(bytesToHex(bits), bytesToHex(vector.derivation.slice(0, 16)));
+    });
+  }, vector.name + " 128 bits");
+
+  promise_test(function (t) {
+    return importBaseKey(vector, ["deriveBits"]).then(function (key) {
+      return promise_rejects_dom(t, "OperationError", crypto.subtle.deriveBits(vector.algorithm, key, null));
+    });
+  }, vector.name + " with null length");
+
+  promise_test(function () {
+    return importBaseKey(vector, ["deriveKey"]).then(function (key) {
+      return crypto.subtle.deriveKey(vector.algorithm, key, { name: "AES-CBC", length: 256 }, true, ["encrypt"]);
+    }).then(function (key) {
+      assert_equals(key.algorithm.name, "AES-CBC");
+      assert_equals(key.algorithm.length, 256);
+      return crypto.subtle.exportKey("raw", key);
+    }).then(function (raw) {
+      assert_equals(bytesToHex(raw), bytesToHex(vector.derivation));
+    });
+  }, vector.name + " deriveKey AES-CBC 256");
+
+  promise_test(function (t) {
+    return importBaseKey(vector, ["deriveKey"]).then(function (key) {
+      return promise_rejects_dom(t, "InvalidAccessError", crypto.subtle.deriveBits(vector.algorithm, key, 256));
+    });
+  }, vector.name + " deriveBits without deriveBits usage");
+
+  promise_test(function (t) {
+    return importBaseKey(vector, ["deriveKey"]).then(function (key) {
+      return promise_rejects_dom(t, "NotSupportedError", crypto.subtle.deriveKey(vector.algorithm, key, { name: "ECDSA", namedCurve: "P-256" }, true, ["sign"]));
+    });
+  }, vector.name + " deriveKey with a non-derivable algorithm");
+}
+
+promise_test(function (t) {
+  return promise_rejects_dom(t, "SyntaxError", crypto.subtle.importKey("raw", asciiToBytes("password"), "PBKDF2", true, ["deriveBits"]));
+}, "PBKDF2 keys must not be extractable");
+
+promise_test(function (t) {
+  return promise_rejects_dom(t, "SyntaxError", crypto.subtle.importKey("raw", asciiToBytes("password"), "HKDF", false, ["encrypt"]));
+}, "HKDF keys with bad usages");
+
+promise_test(function (t) {
+  return importBaseKey(getTestVectors()[0], ["deriveBits"]).then(function (key) {
+    const algorithm = Object.assign({}, getTestVectors()[0].algorithm, { iterations: 0 });
+    return promise_rejects_dom(t, "OperationError", crypto.subtle.deriveBits(algorithm, key, 256));
+  });
+}, "PBKDF2 with 0 iterations");
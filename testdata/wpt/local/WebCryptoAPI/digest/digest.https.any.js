@@ -0,0 +1,75 @@
+// META: script=../util/helpers.js
+// Tests for crypto.subtle.digest()
+
+const sourceData = {
+  empty: new Uint8Array(0),
+  short: asciiToBytes("The quick brown fox jumps over the lazy dog"),
+  medium: Uint8Array.from({ length: 1000 }, (_, i) => i % 251),
+};
+
+const digestedData = {
+  "SHA-1": {
+    empty: "da39a3ee5e6b4b0d3255bfef95601890afd80709",
+    short: "2fd4e1c67a2d28fced849ee1bb76e7391b93eb12",
+    medium: "c9c960a0b925474fab83942cc27d504fc24ac37b",
+  },
+  "SHA-256": {
+    empty: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+    short: "d7a8fbb307d7809469ca9abcb0082e4f8d5651e46d3cdb762d02d0bf37c9e592",
+    medium: "4e4c294b331f7a2099a379bec34b9f9fc03dc46ab465d998f4d683da53487e6d",
+  },
+  "SHA-384": {
+    empty: "38b060a751ac96384cd9327eb1b1e36a21fdb71114be07434c0cc7bf63f6e1da274edebfe76f65fbd51ad2f14898b95b",
+    short: "ca737f1014a48f4c0b6dd43cb177b0afd9e5169367544c494011e3317dbf9a509cb1e5dc1e85a941bbee3d7f2afbc9b1",
+    medium: "7a2f8c7f12344964a13cb9260492b845e56615d6152b9eb9e54b580fc88405e64f31813bfda10de2a642fdf1676c61b4",
+  },
+  "SHA-512": {
+    empty: "cf83e1357eefb8bdf1542850d66d8007d620e4050b5715dc83f4a921d36ce9ce47d0d13c5d85f2b0ff8318d2877eec2f63b931bd47417a81a538327af927da3e",
+    short: "07e547d9586f6a73f73fbac0435ed76951218fb7d0c8d788a309d785436bbb642e93a252a954f23912547d1e8a3b5ed6e1bfd7097821233fa0538f3db854fee6",
+    medium: "5096498d96f50f9a137c4db5b8b0cd38383ad55350fb5a98805fedc31fa1262f1f0cf4d6f12d7ecd8dedd933a4c9126344fe22e937a8ad35fdeae1e876ae698b",
+  },
+};
+
+for (const alg of Object.keys(digestedData)) {
+  for (const size of Object.keys(sourceData)) {
+    for (const name of [alg, alg.toLowerCase(), { name: alg }]) {
+      const label = typeof name === "string" ? name : "{ name: " + alg + " }";
+      promise_test(function () {
+        return crypto.subtle.digest(name, sourceData[size]).then(function (result) {
+          assert_true(result instanceof ArrayBuffer, "result is an ArrayBuffer");
+          assert_equals(bytesToHex(result), digestedData[alg][size]);
+        });
+      }, label + " with " + size + " source data");
+    }
+
+    promise_test(function () {
+      const copy = sourceData[size].slice();
+      const promise = crypto.subtle.digest(alg, copy);
+      copy.fill(0xff);
+      return promise.then(function (result) {
+        assert_equals(bytesToHex(result), digestedData[alg][size]);
+      });
+    }, alg + " with " + size + " source data and altered buffer after call");
+  }
+
+  promise_test(function () {
+    const view = new DataView(sourceData.short.buffer);
+    return crypto.subtle.digest(alg, view).then(function (result) {
+      assert_equals(bytesToHex(result), digestedData[alg].short);
+    });
+  }, alg + " with a DataView");
+}
+
+for (const name of ["AES-GCM", "HMAC", "SHA-224", "MD5"]) {
+  promise_test(function (t) {
+    return promise_rejects_dom(t, "NotSupportedError", crypto.subtle.digest(name, sourceData.short));
+  }, "digest with unsupported algorithm " + name);
+}
+
+promise_test(function (t) {
+  return promise_rejects_js(t, TypeError, crypto.subtle.digest("SHA-256"));
+}, "digest with missing data");
+
+promise_test(function (t) {
+  return promise_rejects_js(t, TypeError, crypto.subtle.digest("SHA-256", "not a buffer"));
+}, "digest with a string as data");
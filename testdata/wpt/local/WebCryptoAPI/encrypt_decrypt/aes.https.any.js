@@ -0,0 +1,73 @@
+// META: script=../util/helpers.js
+// META: script=aes_vectors.js
+// Tests for AES-CTR, AES-CBC and AES-GCM encrypt and decrypt
+
+function importVectorKey(vector, usages) {
+  return crypto.subtle.importKey("raw", vector.keyBuffer, { name: vector.algorithm.name }, false, usages);
+}
+
+for (const vector of getTestVectors()) {
+  promise_test(function () {
+    return importVectorKey(vector, ["encrypt"]).then(function (key) {
+      return crypto.subtle.encrypt(vector.algorithm, key, vector.plaintext);
+    }).then(function (result) {
+      assert_equals(bytesToHex(result), bytesToHex(vector.result));
+    });
+  }, vector.name);
+
+  promise_test(function () {
+    return importVectorKey(vector, ["decrypt"]).then(function (key) {
+      return crypto.subtle.decrypt(vector.algorithm, key, vector.result);
+    }).then(function (plaintext) {
+      assert_equals(bytesToHex(plaintext), bytesToHex(vector.plaintext));
+    });
+  }, vector.name + " decryption");
+
+  promise_test(function () {
+    const plaintext = vector.plaintext.slice();
+    return importVectorKey(vector, ["encrypt"]).then(function (key) {
+      const promise = crypto.subtle.encrypt(vector.algorithm, key, plaintext);
+      plaintext[0] = 255 - plaintext[0];
+      return promise;
+    }).then(function (result) {
+      assert_equals(bytesToHex(result), bytesToHex(vector.result));
+    });
+  }, vector.name + " with altered plaintext");
+
+  promise_test(function (t) {
+    return importVectorKey(vector, ["decrypt"]).then(function (key) {
+      return promise_rejects_dom(t, "InvalidAccessError", crypto.subtle.encrypt(vector.algorithm, key, vector.plaintext));
+    });
+  }, vector.name + " without encrypt usage");
+
+  promise_test(function (t) {
+    return crypto.subtle.generateKey({ name: "HMAC", hash: "SHA-256" }, false, ["sign"]).then(function (key) {
+      return promise_rejects_dom(t, "InvalidAccessError", crypto.subtle.encrypt(vector.algorithm, key, vector.plaintext));
+    });
+  }, vector.name + " with mismatched key and algorithm");
+}
+
+promise_test(function (t) {
+  const vector = getTestVectors().find((v) => v.algorithm.name === "AES-GCM");
+  const tampered = vector.result.slice();
+  tampered[tampered.length - 1] ^= 1;
+  return importVectorKey(vector, ["decrypt"]).then(function (key) {
+    return promise_rejects_dom(t, "OperationError", crypto.subtle.decrypt(vector.algorithm, key, tampered));
+  });
+}, "AES-GCM decryption with a tampered tag");
+
+promise_test(function (t) {
+  const vector = getTestVectors().find((v) => v.algorithm.name === "AES-CBC");
+  const algorithm = { name: "AES-CBC", iv: new Uint8Array(8) };
+  return importVectorKey(vector, ["encrypt"]).then(function (key) {
+    return promise_rejects_dom(t, "OperationError", crypto.subtle.encrypt(algorithm, key, vector.plaintext));
+  });
+}, "AES-CBC with a short iv");
+
+promise_test(function (t) {
+  const vector = getTestVectors().find((v) => v.algorithm.name === "AES-CTR");
+  const algorithm = { name: "AES-CTR", counter: vector.algorithm.counter, length: 0 };
+  return importVectorKey(vector, ["encrypt"]).then(function (key) {
+    return promise_rejects_dom(t, "OperationError", crypto.subtle.encrypt(algorithm, key, vector.plaintext));
+  });
+}, "AES-CTR with a counter length of 0");
@@ -0,0 +1,45 @@
+// AES test vectors, the key prefixes of one 256 bits key encrypt the same plaintext
+
+function getTestVectors() {
+  const plaintext = asciiToBytes("The quick brown fox jumps over the lazy dog");
+  const keyBytes = hexToBytes("000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f");
+  const iv = keyBytes.slice(0, 16);
+
+  const ciphertexts = {
+    "AES-CTR": {
+      128: "5efc6e95301b99269ae3f62aa924847a640c94b40c6d1fe6e9fa92792ed62fa87248b4df7066dcd8d9adaf",
+      192: "5408dade37f622dbb17c9bd470854e8e4f981bc8cb00abcfd674fbff77f665813ba230959d5e85c1ff20ff",
+      256: "0e066177798e18f59b0e374f6db4c8b2069c68f5a9f0352d26369427179700bb740057375bbfb584df8e6c",
+    },
+    "AES-CBC": {
+      128: "d5f239401cf82914474428e33d8b1c9e380a8f51f8800d23a97775715faf4ba9184136f0641c6aa50af279b95be10423",
+      192: "10acab422ae42b3528294371bdbbc03761516108d758216e7c8b8f8049cc9c08db59bb4584e45fbf11584090f1c8c693",
+      256: "4846f83aa211e239aa62a21f527f089ee9ddbead30ee15d4e79b607a621b97be038b06d28923c94bca2c60df36761146",
+    },
+    "AES-GCM": {
+      128: "c704c2ee176e9e3720f203f859d41e28d54962c63998908695019e5b71368218edc1fb9b95facec3249b6ed9a28cc80267d235ecf138f981365690",
+      192: "b29147bbe8cca06dbb13bef090deb25068f04b2b52d43bce0c7f044ea8e40128bf11d71d7b26742b97c876889088ee81b93377e89404cf693395a5",
+      256: "136ab33bb490ab78e661f5f9de9e164de5b9ff149a0e320c4b478af3781b20c669758e90cebb6bb810cb18866f8a0c8718bacd8fbfea3908d156bc",
+    },
+  };
+
+  const algorithms = {
+    "AES-CTR": { name: "AES-CTR", counter: iv, length: 64 },
+    "AES-CBC": { name: "AES-CBC", iv },
+    "AES-GCM": { name: "AES-GCM", iv: iv.slice(0, 12), additionalData: asciiToBytes("additional data"), tagLength: 128 },
+  };
+
+  const vectors = [];
+  for (const name of Object.keys(ciphertexts)) {
+    for (const length of [128, 192, 256]) {
+      vectors.push({
+        name: name + " " + length + "-bit key",
+        keyBuffer: keyBytes.slice(0, length / 8),
+        algorithm: algorithms[name],
+        plaintext,
+        result: hexToBytes(ciphertexts[name][length]),
+      });
+    }
+  }
+  return vectors;
+}
@@ -0,0 +1,52 @@
+// Shared generateKey failure tests, run_test checks the error each bad
+// algorithm, usage and extractable combination rejects with
+
+function run_test(algorithmNames) {
+  const allAlgorithms = {
+    "AES-CTR": { name: "AES-CTR", length: 128, usages: ["encrypt", "decrypt", "wrapKey", "unwrapKey"] },
+    "AES-CBC": { name: "AES-CBC", length: 128, usages: ["encrypt", "decrypt", "wrapKey", "unwrapKey"] },
+    "AES-GCM": { name: "AES-GCM", length: 128, usages: ["encrypt", "decrypt", "wrapKey", "unwrapKey"] },
+    "AES-KW": { name: "AES-KW", length: 128, usages: ["wrapKey", "unwrapKey"] },
+    "HMAC": { name: "HMAC", hash: "SHA-256", usages: ["sign", "verify"] },
+    "ECDSA": { name: "ECDSA", namedCurve: "P-256", usages: ["sign", "verify"] },
+    "ECDH": { name: "ECDH", namedCurve: "P-256", usages: ["deriveKey", "deriveBits"] },
+    "Ed25519": { name: "Ed25519", usages: ["sign", "verify"] },
+    "X25519": { name: "X25519", usages: ["deriveKey", "deriveBits"] },
+  };
+  const allUsages = ["encrypt", "decrypt", "sign", "verify", "wrapKey", "unwrapKey", "deriveKey", "deriveBits"];
+
+  function params(algorithm) {
+    const result = Object.assign({}, algorithm);
+    delete result.usages;
+    return result;
+  }
+
+  function testError(algorithm, extractable, usages, expected, label) {
+    promise_test(function (t) {
+      const promise = crypto.subtle.generateKey(algorithm, extractable, usages);
+      if (expected === "TypeError") {
+        return promise_rejects_js(t, TypeError, promise);
+      }
+      return promise_rejects_dom(t, expected, promise);
+    }, "Bad " + label + ": generateKey(" + format_value(algorithm.name || algorithm) + ", " + extractable + ", " + format_value(usages) + ")");
+  }
+
+  // Algorithms normalize before anything else is checked
+  testError("AES", true, ["encrypt"], "NotSupportedError", "algorithm");
+  testError({ name: "EC", namedCurve: "P-256" }, true, ["sign"], "NotSupportedError", "algorithm");
+  testError("PBKDF2", false, ["deriveBits"], "NotSupportedError", "algorithm");
+  testError("HKDF", false, ["deriveBits"], "NotSupportedError", "algorithm");
+  testError({}, true, ["sign"], "TypeError", "algorithm");
+
+  for (const name of algorithmNames) {
+    const algorithm = allAlgorithms[name];
+
+    for (const usage of allUsages) {
+      if (algorithm.usages.indexOf(usage) === -1) {
+        testError(params(algorithm), true, [usage], "SyntaxError", "usages");
+      }
+    }
+
+    testError(params(algorithm), true, [], "SyntaxError", "usages");
+  }
+}
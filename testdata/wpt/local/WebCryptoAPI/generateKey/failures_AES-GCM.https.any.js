@@ -0,0 +1,12 @@
+// META: script=failures.js
+run_test(["AES-GCM"]);
+
+for (const length of [64, 127, 129, 512]) {
+  promise_test(function (t) {
+    return promise_rejects_dom(t, "OperationError", crypto.subtle.generateKey({ name: "AES-GCM", length }, true, ["encrypt"]));
+  }, "Bad algorithm property: generateKey({ name: AES-GCM, length: " + length + " })");
+}
+
+promise_test(function (t) {
+  return promise_rejects_js(t, TypeError, crypto.subtle.generateKey({ name: "AES-GCM" }, true, ["encrypt"]));
+}, "Missing algorithm property: generateKey({ name: AES-GCM })");
@@ -0,0 +1,2 @@
+// META: script=failures.js
+run_test(["ECDH"]);
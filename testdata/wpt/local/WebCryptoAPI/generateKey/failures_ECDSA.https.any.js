@@ -0,0 +1,10 @@
+// META: script=failures.js
+run_test(["ECDSA"]);
+
+promise_test(function (t) {
+  return promise_rejects_js(t, TypeError, crypto.subtle.generateKey({ name: "ECDSA" }, true, ["sign"]));
+}, "Missing algorithm property: generateKey({ name: ECDSA })");
+
+promise_test(function (t) {
+  return promise_rejects_dom(t, "NotSupportedError", crypto.subtle.generateKey({ name: "ECDSA", namedCurve: "P-192" }, true, ["sign"]));
+}, "Bad algorithm property: generateKey({ name: ECDSA, namedCurve: P-192 })");
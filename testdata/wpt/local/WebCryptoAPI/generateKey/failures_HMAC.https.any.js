@@ -0,0 +1,10 @@
+// META: script=failures.js
+run_test(["HMAC"]);
+
+promise_test(function (t) {
+  return promise_rejects_js(t, TypeError, crypto.subtle.generateKey({ name: "HMAC" }, true, ["sign"]));
+}, "Missing algorithm property: generateKey({ name: HMAC })");
+
+promise_test(function (t) {
+  return promise_rejects_dom(t, "NotSupportedError", crypto.subtle.generateKey({ name: "HMAC", hash: "SHA-224" }, true, ["sign"]));
+}, "Bad algorithm property: generateKey({ name: HMAC, hash: SHA-224 })");
@@ -0,0 +1,47 @@
+// Tests for crypto.getRandomValues()
+
+const integerArrays = [
+  Int8Array, Int16Array, Int32Array,
+  Uint8Array, Uint8ClampedArray, Uint16Array, Uint32Array,
+  BigInt64Array, BigUint64Array,
+];
+
+for (const array of integerArrays) {
+  test(function () {
+    const a = new array(8);
+    assert_equals(crypto.getRandomValues(a), a, "returns its argument");
+  }, "Integer array: " + array.name);
+
+  test(function () {
+    const maxLength = 65536 / array.BYTES_PER_ELEMENT;
+    assert_throws_dom("QuotaExceededError", function () {
+      crypto.getRandomValues(new array(maxLength + 1));
+    });
+    crypto.getRandomValues(new array(maxLength));
+  }, "Large length: " + array.name);
+}
+
+for (const array of [Float32Array, Float64Array]) {
+  test(function () {
+    assert_throws_dom("TypeMismatchError", function () {
+      crypto.getRandomValues(new array(6));
+    });
+  }, "Float arrays: " + array.name);
+}
+
+test(function () {
+  assert_throws_dom("TypeMismatchError", function () {
+    crypto.getRandomValues(new DataView(new ArrayBuffer(6)));
+  });
+}, "DataView");
+
+test(function () {
+  const a = new Uint8Array(0);
+  assert_equals(crypto.getRandomValues(a), a);
+}, "Empty array");
+
+test(function () {
+  const a = new Uint8Array(1024);
+  crypto.getRandomValues(a);
+  assert_true(a.some((b) => b !== 0), "some bytes are set");
+}, "Fills the array");
@@ -0,0 +1,89 @@
+// META: script=../util/helpers.js
+// Tests for importing and exporting AES and HMAC keys
+
+const keyData = {
+  128: hexToBytes("000102030405060708090a0b0c0d0e0f"),
+  192: hexToBytes("000102030405060708090a0b0c0d0e0f1011121314151617"),
+  256: hexToBytes("000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"),
+};
+
+const algorithms = [
+  { name: "AES-CTR", usages: ["encrypt", "decrypt"] },
+  { name: "AES-CBC", usages: ["encrypt", "decrypt"] },
+  { name: "AES-GCM", usages: ["encrypt", "decrypt"] },
+  { name: "AES-KW", usages: ["wrapKey", "unwrapKey"] },
+];
+
+for (const algorithm of algorithms) {
+  for (const length of [128, 192, 256]) {
+    const label = algorithm.name + " " + length + " bits";
+
+    promise_test(function () {
+      return crypto.subtle.importKey("raw", keyData[length], algorithm.name, true, algorithm.usages).then(function (key) {
+        assert_class_string(key, "CryptoKey");
+        assert_equals(key.type, "secret");
+        assert_equals(key.extractable, true);
+        assert_equals(key.algorithm.name, algorithm.name);
+        assert_equals(key.algorithm.length, length);
+        assert_array_equals(key.usages, algorithm.usages);
+        return crypto.subtle.exportKey("raw", key);
+      }).then(function (raw) {
+        assert_equals(bytesToHex(raw), bytesToHex(keyData[length]));
+      });
+    }, "Good parameters: " + label + " raw");
+
+    promise_test(function () {
+      return crypto.subtle.importKey("raw", keyData[length], algorithm.name, true, algorithm.usages).then(function (key) {
+        return crypto.subtle.exportKey("jwk", key);
+      }).then(function (jwk) {
+        assert_equals(jwk.kty, "oct");
+        assert_equals(jwk.ext, true);
+        return crypto.subtle.importKey("jwk", jwk, algorithm.name, true, algorithm.usages);
+      }).then(function (key) {
+        return crypto.subtle.exportKey("raw", key);
+      }).then(function (raw) {
+        assert_equals(bytesToHex(raw), bytesToHex(keyData[length]));
+      });
+    }, "Good parameters: " + label + " jwk round trip");
+
+    promise_test(function (t) {
+      return crypto.subtle.importKey("raw", keyData[length], algorithm.name, false, algorithm.usages).then(function (key) {
+        assert_equals(key.extractable, false);
+        return promise_rejects_dom(t, "InvalidAccessError", crypto.subtle.exportKey("raw", key));
+      });
+    }, "Non-extractable: " + label);
+  }
+
+  promise_test(function (t) {
+    return promise_rejects_dom(t, "DataError", crypto.subtle.importKey("raw", new Uint8Array(20), algorithm.name, true, algorithm.usages));
+  }, "Bad key length: " + algorithm.name + " 160 bits");
+
+  promise_test(function (t) {
+    return promise_rejects_dom(t, "SyntaxError", crypto.subtle.importKey("raw", keyData[128], algorithm.name, true, ["sign"]));
+  }, "Bad usages: " + algorithm.name);
+
+  promise_test(function (t) {
+    return promise_rejects_dom(t, "NotSupportedError", crypto.subtle.importKey("spki", keyData[128], algorithm.name, true, algorithm.usages));
+  }, "Unsupported format: " + algorithm.name + " spki");
+}
+
+for (const hash of ["SHA-1", "SHA-256", "SHA-384", "SHA-512"]) {
+  promise_test(function () {
+    return crypto.subtle.importKey("raw", keyData[256], { name: "HMAC", hash }, true, ["sign", "verify"]).then(function (key) {
+      assert_equals(key.algorithm.name, "HMAC");
+      assert_equals(key.algorithm.hash.name, hash);
+      assert_equals(key.algorithm.length, 256);
+      return crypto.subtle.exportKey("raw", key);
+    }).then(function (raw) {
+      assert_equals(bytesToHex(raw), bytesToHex(keyData[256]));
+    });
+  }, "Good parameters: HMAC " + hash + " raw");
+}
+
+promise_test(function (t) {
+  return promise_rejects_dom(t, "DataError", crypto.subtle.importKey("raw", new Uint8Array(0), { name: "HMAC", hash: "SHA-256" }, true, ["sign"]));
+}, "Empty key: HMAC");
+
+promise_test(function (t) {
+  return promise_rejects_js(t, TypeError, crypto.subtle.importKey("raw", keyData[128], { name: "HMAC" }, true, ["sign"]));
+}, "Missing hash: HMAC");
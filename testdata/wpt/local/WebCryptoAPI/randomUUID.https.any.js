@@ -0,0 +1,22 @@
+// Tests for crypto.randomUUID()
+
+const uuidRegex = /^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$/;
+
+test(function () {
+  assert_equals(typeof crypto.randomUUID(), "string");
+}, "namespace object should have a randomUUID method");
+
+test(function () {
+  for (let i = 0; i < 100; i++) {
+    const uuid = crypto.randomUUID();
+    assert_true(uuidRegex.test(uuid), "UUID " + uuid + " is a version 4 UUID");
+  }
+}, "randomUUID generates a version 4 UUID");
+
+test(function () {
+  const seen = new Set();
+  for (let i = 0; i < 100; i++) {
+    seen.add(crypto.randomUUID());
+  }
+  assert_equals(seen.size, 100);
+}, "randomUUID generates distinct values");
@@ -0,0 +1,73 @@
+// META: script=../util/helpers.js
+// META: script=hmac_vectors.js
+// Tests for HMAC sign and verify
+
+function importVectorKey(vector, usages) {
+  return crypto.subtle.importKey("raw", vector.keyBuffer, { name: "HMAC", hash: vector.hash }, false, usages);
+}
+
+for (const vector of getTestVectors()) {
+  promise_test(function () {
+    return importVectorKey(vector, ["verify"]).then(function (key) {
+      return crypto.subtle.verify("HMAC", key, vector.signature, vector.plaintext);
+    }).then(function (isVerified) {
+      assert_true(isVerified, "Signature verified");
+    });
+  }, vector.name + " verification");
+
+  promise_test(function () {
+    return importVectorKey(vector, ["sign"]).then(function (key) {
+      return crypto.subtle.sign("HMAC", key, vector.plaintext);
+    }).then(function (signature) {
+      assert_equals(bytesToHex(signature), bytesToHex(vector.signature));
+    });
+  }, vector.name + " round trip");
+
+  promise_test(function () {
+    const plaintext = vector.plaintext.slice();
+    return importVectorKey(vector, ["verify"]).then(function (key) {
+      const promise = crypto.subtle.verify("HMAC", key, vector.signature, plaintext);
+      plaintext[0] = 255 - plaintext[0];
+      return promise;
+    }).then(function (isVerified) {
+      assert_true(isVerified, "Signature verified");
+    });
+  }, vector.name + " verification with altered plaintext after call");
+
+  promise_test(function () {
+    const plaintext = vector.plaintext.slice();
+    plaintext[0] = 255 - plaintext[0];
+    return importVectorKey(vector, ["verify"]).then(function (key) {
+      return crypto.subtle.verify("HMAC", key, vector.signature, plaintext);
+    }).then(function (isVerified) {
+      assert_false(isVerified, "Signature is not verified");
+    });
+  }, vector.name + " verification failure due to wrong plaintext");
+
+  promise_test(function () {
+    const signature = vector.signature.slice(0, vector.signature.length - 1);
+    return importVectorKey(vector, ["verify"]).then(function (key) {
+      return crypto.subtle.verify("HMAC", key, signature, vector.plaintext);
+    }).then(function (isVerified) {
+      assert_false(isVerified, "Signature is not verified");
+    });
+  }, vector.name + " verification failure due to short signature");
+
+  promise_test(function (t) {
+    return importVectorKey(vector, ["sign"]).then(function (key) {
+      return promise_rejects_dom(t, "InvalidAccessError", crypto.subtle.verify("HMAC", key, vector.signature, vector.plaintext));
+    });
+  }, vector.name + " verifying with wrong usage");
+
+  promise_test(function (t) {
+    return importVectorKey(vector, ["verify"]).then(function (key) {
+      return promise_rejects_dom(t, "InvalidAccessError", crypto.subtle.sign("HMAC", key, vector.plaintext));
+    });
+  }, vector.name + " signing with wrong usage");
+
+  promise_test(function (t) {
+    return crypto.subtle.generateKey({ name: "AES-GCM", length: 128 }, false, ["encrypt"]).then(function (key) {
+      return promise_rejects_dom(t, "InvalidAccessError", crypto.subtle.sign({ name: "HMAC", hash: vector.hash }, key, vector.plaintext));
+    });
+  }, vector.name + " signing with a non-HMAC key");
+}
@@ -0,0 +1,17 @@
+// HMAC test vectors, the same key and plaintext for each hash
+
+function getTestVectors() {
+  const plaintext = asciiToBytes("The quick brown fox jumps over the lazy dog");
+  const keyBytes = asciiToBytes("0123456789abcdef0123456789abcdef");
+
+  return [
+    { name: "HMAC with SHA-1", hash: "SHA-1", keyBuffer: keyBytes, plaintext,
+      signature: hexToBytes("4854ae6663091d75da5ee912db66992fae8a9f26") },
+    { name: "HMAC with SHA-256", hash: "SHA-256", keyBuffer: keyBytes, plaintext,
+      signature: hexToBytes("854e55263cca493bc884e2dc0f3b271fa072461cd0392bb6b5dc4797951e0295") },
+    { name: "HMAC with SHA-384", hash: "SHA-384", keyBuffer: keyBytes, plaintext,
+      signature: hexToBytes("4632025f99adfe8fc9a05decbc7c53d398015746e68c42f9276a5c2f994df9204bd9a9311fec682d5bf1dea6a7a9d43b") },
+    { name: "HMAC with SHA-512", hash: "SHA-512", keyBuffer: keyBytes, plaintext,
+      signature: hexToBytes("46e26906be6c05ed28ff3e6a1cc1e02dfc3aa788c25a763610834ab2d772f16f124262b6924ff235e48d5418e64c245b8122c79a58a0a87b96671e65c95f14c7") },
+  ];
+}
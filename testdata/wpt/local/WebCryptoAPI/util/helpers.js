@@ -0,0 +1,21 @@
+// Byte helpers shared by the WebCryptoAPI tests
+
+function hexToBytes(hex) {
+  const bytes = new Uint8Array(hex.length / 2);
+  for (let i = 0; i < bytes.length; i++) {
+    bytes[i] = parseInt(hex.substr(i * 2, 2), 16);
+  }
+  return bytes;
+}
+
+function bytesToHex(buffer) {
+  return Array.from(new Uint8Array(buffer), (b) => b.toString(16).padStart(2, "0")).join("");
+}
+
+function asciiToBytes(s) {
+  return new Uint8Array(Array.from(s, (c) => c.charCodeAt(0)));
+}
+
+function equalBuffers(a, b) {
+  return bytesToHex(a) === bytesToHex(b);
+}
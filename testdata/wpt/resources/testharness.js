@@ -0,0 +1,341 @@
+// Minimal stand-in for the web-platform-tests testharness.js, covering the
+// test(), async_test(), promise_test() and assert_* API of the WebCryptoAPI
+// test files. Subtests run one after the other once the test files are
+// loaded, the Go harness calls __wpt_run() and reads the results it resolves
+// with. Like upstream, a subtest taking longer than the test timeout is a
+// TIMEOUT and the subtests left when the file runs out of time are NOTRUN.
+(function (global) {
+  "use strict";
+
+  const tests = [];
+  const testTimeout = 10000;
+  let explicitDone = false;
+  let signalDone;
+  const allDone = new Promise((resolve) => { signalDone = resolve; });
+
+  class AssertionError extends Error {
+    constructor(message) {
+      super(message);
+      this.name = "AssertionError";
+    }
+  }
+
+  class PreconditionFailedError extends Error {
+    constructor(message) {
+      super(message);
+      this.name = "PreconditionFailedError";
+    }
+  }
+
+  function format_value(v) {
+    if (typeof v === "string") {
+      return JSON.stringify(v);
+    }
+    if (v instanceof ArrayBuffer || ArrayBuffer.isView(v)) {
+      return Object.prototype.toString.call(v) + "[" + v.byteLength + "]";
+    }
+    if (Array.isArray(v)) {
+      return "[" + v.map(format_value).join(", ") + "]";
+    }
+    return String(v);
+  }
+
+  function assert(cond, name, description, message) {
+    if (!cond) {
+      throw new AssertionError(name + ": " + (description ? description + " " : "") + message);
+    }
+  }
+
+  function same_value(a, b) {
+    return Object.is(a, b);
+  }
+
+  class Test {
+    constructor(name, async) {
+      this.name = name;
+      this.cleanups = [];
+      this.async = async;
+      // set while an async_test or promise_test runs, steps failing outside
+      // of the test body end it through them
+      this.finish = null;
+      this.fail = null;
+      // the outcome of an async_test driven before its turn
+      this.completed = false;
+      this.error = null;
+    }
+
+    step(fn, thisObj, ...args) {
+      try {
+        return fn.apply(thisObj === undefined ? this : thisObj, args);
+      } catch (e) {
+        if (this.fail) {
+          this.fail(e);
+        } else if (this.async) {
+          this.error = this.error || e;
+        } else {
+          throw e;
+        }
+      }
+    }
+
+    step_func(fn, thisObj) {
+      return (...args) => this.step(fn, thisObj, ...args);
+    }
+
+    step_func_done(fn, thisObj) {
+      return (...args) => {
+        if (fn) {
+          this.step(fn, thisObj, ...args);
+        }
+        this.done();
+      };
+    }
+
+    step_timeout(fn, timeout, ...args) {
+      return setTimeout(this.step_func(fn), timeout, ...args);
+    }
+
+    unreached_func(description) {
+      return this.step_func(() => assert_unreached(description));
+    }
+
+    add_cleanup(fn) {
+      this.cleanups.push(fn);
+    }
+
+    done() {
+      this.completed = true;
+      if (this.finish) {
+        this.finish();
+      }
+    }
+  }
+
+  function add(kind, fn, name) {
+    if (typeof name !== "string" || name === "") {
+      name = "subtest " + (tests.length + 1);
+    }
+    tests.push({ kind, fn, name });
+  }
+
+  global.test = (fn, name) => add("sync", fn, name);
+  global.async_test = (fn, name) => {
+    if (typeof fn === "string") {
+      // async_test(name) returns the test, the file drives it with steps
+      const t = new Test(fn, true);
+      add("async", () => {}, fn);
+      tests[tests.length - 1].test = t;
+      return t;
+    }
+    add("async", fn, name);
+  };
+  global.promise_test = (fn, name) => add("promise", fn, name);
+  global.setup = (fn, options) => {
+    if (typeof fn !== "function") {
+      options = fn;
+    } else {
+      fn();
+    }
+    explicitDone = explicitDone || !!(options && options.explicit_done);
+  };
+  global.done = () => signalDone();
+  global.step_timeout = (fn, timeout, ...args) => setTimeout(fn, timeout, ...args);
+  global.format_value = format_value;
+
+  // the tests check where they run, and subset-tests.js reads the variant
+  if (global.self === undefined) {
+    global.self = global;
+  }
+  global.GLOBAL = {
+    isWindow: () => false,
+    isWorker: () => false,
+    isShadowRealm: () => false,
+  };
+  if (global.location === undefined) {
+    global.location = { search: "", hash: "" };
+  }
+
+  global.assert_true = (actual, description) =>
+    assert(actual === true, "assert_true", description, "expected true got " + format_value(actual));
+  global.assert_false = (actual, description) =>
+    assert(actual === false, "assert_false", description, "expected false got " + format_value(actual));
+  global.assert_equals = (actual, expected, description) =>
+    assert(same_value(actual, expected), "assert_equals", description,
+      "expected " + format_value(expected) + " but got " + format_value(actual));
+  global.assert_not_equals = (actual, expected, description) =>
+    assert(!same_value(actual, expected), "assert_not_equals", description,
+      "got disallowed value " + format_value(actual));
+  global.assert_in_array = (actual, expected, description) =>
+    assert(expected.indexOf(actual) !== -1, "assert_in_array", description,
+      "value " + format_value(actual) + " not in array " + format_value(expected));
+  global.assert_array_equals = (actual, expected, description) => {
+    assert(actual && typeof actual.length === "number", "assert_array_equals", description,
+      "value is " + format_value(actual) + ", expected array");
+    assert(actual.length === expected.length, "assert_array_equals", description,
+      "lengths differ, expected " + expected.length + " got " + actual.length);
+    for (let i = 0; i < expected.length; i++) {
+      assert(same_value(actual[i], expected[i]), "assert_array_equals", description,
+        "expected " + format_value(expected[i]) + " but got " + format_value(actual[i]) + " at index " + i);
+    }
+  };
+  global.assert_own_property = (object, name, description) =>
+    assert(Object.prototype.hasOwnProperty.call(object, name), "assert_own_property", description,
+      "expected property " + format_value(name) + " missing");
+  global.assert_class_string = (object, expected, description) =>
+    assert(Object.prototype.toString.call(object) === "[object " + expected + "]", "assert_class_string", description,
+      "expected [object " + expected + "] but got " + Object.prototype.toString.call(object));
+  global.assert_not_own_property = (object, name, description) =>
+    assert(!Object.prototype.hasOwnProperty.call(object, name), "assert_not_own_property", description,
+      "unexpected property " + format_value(name) + " found");
+  global.assert_unreached = (description) =>
+    assert(false, "assert_unreached", description, "reached unreachable code");
+  global.assert_greater_than = (actual, expected, description) =>
+    assert(actual > expected, "assert_greater_than", description,
+      "expected a number greater than " + format_value(expected) + " but got " + format_value(actual));
+  global.assert_greater_than_equal = (actual, expected, description) =>
+    assert(actual >= expected, "assert_greater_than_equal", description,
+      "expected a number greater than or equal to " + format_value(expected) + " but got " + format_value(actual));
+  global.assert_less_than = (actual, expected, description) =>
+    assert(actual < expected, "assert_less_than", description,
+      "expected a number less than " + format_value(expected) + " but got " + format_value(actual));
+  global.assert_less_than_equal = (actual, expected, description) =>
+    assert(actual <= expected, "assert_less_than_equal", description,
+      "expected a number less than or equal to " + format_value(expected) + " but got " + format_value(actual));
+  global.assert_approx_equals = (actual, expected, epsilon, description) =>
+    assert(Math.abs(actual - expected) <= epsilon, "assert_approx_equals", description,
+      "expected " + format_value(expected) + " +/- " + format_value(epsilon) + " but got " + format_value(actual));
+  global.assert_regexp_match = (actual, expected, description) =>
+    assert(expected.test(actual), "assert_regexp_match", description,
+      "expected " + String(expected) + " but got " + format_value(actual));
+  global.assert_implements = (condition, description) =>
+    assert(!!condition, "assert_implements", description, "");
+  global.assert_implements_optional = (condition, description) => {
+    if (!condition) {
+      throw new PreconditionFailedError(description);
+    }
+  };
+
+  function check_thrown(e, name, description, constructor, expected) {
+    assert(typeof e === "object" && e !== null, name, description,
+      "thrown value " + format_value(e) + " is not an object");
+    if (constructor) {
+      assert(e.constructor === constructor, name, description,
+        "expected " + constructor.name + " but got " + (e.constructor && e.constructor.name) + ": " + e.message);
+    } else {
+      assert(e.name === expected, name, description,
+        "expected " + expected + " but got " + e.name + ": " + e.message);
+    }
+  }
+
+  global.assert_throws_js = (constructor, fn, description) => {
+    try {
+      fn();
+    } catch (e) {
+      check_thrown(e, "assert_throws_js", description, constructor);
+      return;
+    }
+    assert(false, "assert_throws_js", description, fn + " did not throw");
+  };
+  global.assert_throws_dom = (type, fn, description) => {
+    try {
+      fn();
+    } catch (e) {
+      check_thrown(e, "assert_throws_dom", description, null, type);
+      return;
+    }
+    assert(false, "assert_throws_dom", description, fn + " did not throw");
+  };
+  global.assert_throws_exactly = (exception, fn, description) => {
+    try {
+      fn();
+    } catch (e) {
+      assert(same_value(e, exception), "assert_throws_exactly", description,
+        "expected " + format_value(exception) + " but got " + format_value(e));
+      return;
+    }
+    assert(false, "assert_throws_exactly", description, fn + " did not throw");
+  };
+  global.promise_rejects_exactly = (t, exception, promise, description) =>
+    promise.then(
+      () => assert(false, "promise_rejects_exactly", description, "promise should have rejected"),
+      (e) => assert(same_value(e, exception), "promise_rejects_exactly", description,
+        "expected " + format_value(exception) + " but got " + format_value(e)));
+  global.promise_rejects_js = (t, constructor, promise, description) =>
+    promise.then(
+      () => assert(false, "promise_rejects_js", description, "promise should have rejected"),
+      (e) => check_thrown(e, "promise_rejects_js", description, constructor));
+  global.promise_rejects_dom = (t, type, promise, description) =>
+    promise.then(
+      () => assert(false, "promise_rejects_dom", description, "promise should have rejected"),
+      (e) => check_thrown(e, "promise_rejects_dom", description, null, type));
+
+  // runTest runs a subtest body and settles once it's done, async_test and
+  // promise_test bodies get testTimeout to finish
+  function runTest(kind, fn, t) {
+    if (kind === "sync") {
+      fn.call(t, t);
+      return Promise.resolve("PASS");
+    }
+
+    let timer;
+    return new Promise((resolve, reject) => {
+      if (t.error) {
+        throw t.error;
+      }
+      if (t.completed) {
+        return resolve("PASS");
+      }
+      t.finish = () => resolve("PASS");
+      t.fail = reject;
+      timer = setTimeout(() => resolve("TIMEOUT"), testTimeout);
+
+      if (kind === "promise") {
+        const p = t.step(fn, t, t);
+        assert(p && typeof p.then === "function", "promise_test", "", "test body must return a promise");
+        p.then(t.finish, reject);
+      } else {
+        t.step(fn, t, t);
+      }
+    }).finally(() => clearTimeout(timer));
+  }
+
+  global.__wpt_run = async function (budget) {
+    const deadline = Date.now() + budget;
+    const results = [];
+    const outOfTime = () => Date.now() >= deadline;
+    for (let i = 0; ; i++) {
+      if (i === tests.length && explicitDone && !outOfTime()) {
+        // tests may be added until done() is called
+        let timer;
+        await Promise.race([allDone, new Promise((resolve) => { timer = setTimeout(resolve, deadline - Date.now()); })]);
+        clearTimeout(timer);
+        explicitDone = false;
+      }
+      if (i >= tests.length) {
+        break;
+      }
+
+      const { kind, fn, name } = tests[i];
+      if (outOfTime()) {
+        results.push({ name, status: "NOTRUN", message: "the test file timed out" });
+        continue;
+      }
+
+      const t = tests[i].test || new Test(name, kind !== "sync");
+      let status;
+      let message = "";
+      try {
+        status = await runTest(kind, fn, t);
+      } catch (e) {
+        status = e instanceof PreconditionFailedError ? "PRECONDITION_FAILED" : "FAIL";
+        message = e && e.name ? e.name + ": " + e.message : String(e);
+      }
+      t.finish = t.fail = null;
+      for (const cleanup of t.cleanups) {
+        try { cleanup(); } catch (e) {}
+      }
+      results.push({ name, status, message });
+    }
+    return JSON.stringify(results);
+  };
+})(globalThis);
@@ -0,0 +1,63 @@
+#!/bin/sh
+# Copies the upstream web-platform-tests files run by TestWPT into upstream/,
+# with the WPT license and the commit they come from in upstream/REVISION.
+#
+# usage: testdata/wpt/vendor.sh [ref]
+#
+# ref is a branch, tag or commit of https://github.com/web-platform-tests/wpt,
+# master by default. Record the results afterwards with
+# go test -run TestWPT -wpt.update
+set -eu
+
+ref=${1:-master}
+wpt=$(cd "$(dirname "$0")" && pwd)
+dest=$wpt/upstream
+
+# the files of the WebCryptoAPI tests the polyfill is checked against, with
+# the resources they include
+files="
+LICENSE.md
+common/subset-tests.js
+WebCryptoAPI/getRandomValues.any.js
+WebCryptoAPI/randomUUID.https.any.js
+WebCryptoAPI/util/helpers.js
+WebCryptoAPI/digest
+WebCryptoAPI/sign_verify/hmac.https.any.js
+WebCryptoAPI/sign_verify/hmac.js
+WebCryptoAPI/sign_verify/hmac_vectors.js
+WebCryptoAPI/encrypt_decrypt
+WebCryptoAPI/derive_bits_keys
+WebCryptoAPI/generateKey
+WebCryptoAPI/import_export/symmetric_importKey.https.any.js
+"
+
+tmp=$(mktemp -d)
+trap 'rm -rf "$tmp"' EXIT
+
+git -C "$tmp" init -q
+git -C "$tmp" fetch -q --depth 1 --filter=blob:none https://github.com/web-platform-tests/wpt.git "$ref"
+# shellcheck disable=SC2086
+git -C "$tmp" checkout -q FETCH_HEAD -- $files
+
+rm -rf "$dest"
+mkdir -p "$dest"
+for f in $files; do
+	case $f in
+	WebCryptoAPI/encrypt_decrypt)
+		# the AES files only
+		mkdir -p "$dest/$f"
+		cp "$tmp/$f"/aes*.js "$dest/$f/"
+		;;
+	WebCryptoAPI/generateKey)
+		mkdir -p "$dest/$f"
+		cp "$tmp/$f"/failures*.js "$dest/$f/"
+		;;
+	*)
+		mkdir -p "$dest/$(dirname "$f")"
+		cp -R "$tmp/$f" "$dest/$f"
+		;;
+	esac
+done
+
+git -C "$tmp" rev-parse FETCH_HEAD >"$dest/REVISION"
+echo "vendored web-platform-tests $(cat "$dest/REVISION") into $dest"
@@ -24,9 +24,10 @@ package timers
 
 import (
 	"errors"
+	"time"
 
 	"github.com/esoptra/v8go"
-	"github.com/esoptra/v8go-polyfills/timers/internal"
+	"github.com/esoptra/v8go-polyfills/eventloop"
 )
 
 type Timers interface {
@@ -37,25 +38,18 @@ type Timers interface {
 	GetClearIntervalFunctionCallback() v8go.FunctionCallback
 }
 
-type timers struct {
-	Items      map[int32]*internal.Item
-	NextItemID int32
-}
-
-const initNextItemID = 1
+// timers keeps no state, the timers of each context live on its event loop
+type timers struct{}
 
 func NewTimers() Timers {
-	return &timers{
-		Items:      make(map[int32]*internal.Item),
-		NextItemID: initNextItemID,
-	}
+	return &timers{}
 }
 
 func (t *timers) GetSetTimeoutFunctionCallback() v8go.FunctionCallback {
 	return func(info *v8go.FunctionCallbackInfo) *v8go.Value {
 		ctx := info.Context()
 
-		id, err := t.startNewTimer(info.This(), info.Args(), false)
+		id, err := t.startNewTimer(eventloop.For(ctx), info.This(), info.Args(), false)
 		if err != nil {
 			return newInt32Value(ctx, 0)
 		}
@@ -68,7 +62,7 @@ func (t *timers) GetSetIntervalFunctionCallback() v8go.FunctionCallback {
 	return func(info *v8go.FunctionCallbackInfo) *v8go.Value {
 		ctx := info.Context()
 
-		id, err := t.startNewTimer(info.This(), info.Args(), true)
+		id, err := t.startNewTimer(eventloop.For(ctx), info.This(), info.Args(), true)
 		if err != nil {
 			return newInt32Value(ctx, 0)
 		}
@@ -81,7 +75,7 @@ func (t *timers) GetClearTimeoutFunctionCallback() v8go.FunctionCallback {
 	return func(info *v8go.FunctionCallbackInfo) *v8go.Value {
 		args := info.Args()
 		if len(args) > 0 && args[0].IsInt32() {
-			t.clear(args[0].Int32(), false)
+			eventloop.For(info.Context()).ClearTimeout(args[0].Int32())
 		}
 
 		return nil
@@ -92,24 +86,14 @@ func (t *timers) GetClearIntervalFunctionCallback() v8go.FunctionCallback {
 	return func(info *v8go.FunctionCallbackInfo) *v8go.Value {
 		args := info.Args()
 		if len(args) > 0 && args[0].IsInt32() {
-			t.clear(args[0].Int32(), true)
+			eventloop.For(info.Context()).ClearInterval(args[0].Int32())
 		}
 
 		return nil
 	}
 }
 
-func (t *timers) clear(id int32, interval bool) {
-	if id < initNextItemID {
-		return
-	}
-
-	if item, ok := t.Items[id]; ok && item.Interval == interval {
-		item.Clear()
-	}
-}
-
-func (t *timers) startNewTimer(this v8go.Valuer, args []*v8go.Value, interval bool) (int32, error) {
+func (t *timers) startNewTimer(loop *eventloop.Loop, this v8go.Valuer, args []*v8go.Value, interval bool) (int32, error) {
 	if len(args) <= 0 {
 		return 0, errors.New("1 argument required, but only 0 present")
 	}
@@ -135,26 +119,13 @@ func (t *timers) startNewTimer(this v8go.Valuer, args []*v8go.Value, interval bo
 		}
 	}
 
-	item := &internal.Item{
-		ID:       t.NextItemID,
-		Done:     false,
-		Cleared:  false,
-		Delay:    delay,
-		Interval: interval,
-		FunctionCB: func() {
-			_, _ = fn.Call(this, restArgs...)
-		},
-		ClearCB: func(id int32) {
-			delete(t.Items, id)
-		},
+	callback := func() {
+		_, _ = fn.Call(this, restArgs...)
 	}
-
-	t.NextItemID++
-	t.Items[item.ID] = item
-
-	item.Start()
-
-	return item.ID, nil
+	if interval {
+		return loop.SetInterval(callback, time.Duration(delay)*time.Millisecond), nil
+	}
+	return loop.SetTimeout(callback, time.Duration(delay)*time.Millisecond), nil
 }
 
 func newInt32Value(ctx *v8go.Context, i int32) *v8go.Value {
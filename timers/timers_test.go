@@ -23,11 +23,13 @@
 package timers
 
 import (
+	"context"
 	"testing"
 	"time"
 
 	"github.com/esoptra/v8go"
 	"github.com/esoptra/v8go-polyfills/console"
+	"github.com/esoptra/v8go-polyfills/eventloop"
 )
 
 func Test_SetTimeout(t *testing.T) {
@@ -36,6 +38,7 @@ func Test_SetTimeout(t *testing.T) {
 		t.Error(err)
 		return
 	}
+	defer eventloop.Close(ctx)
 
 	if err := console.InjectTo(ctx); err != nil {
 		t.Error(err)
@@ -63,7 +66,70 @@ func Test_SetTimeout(t *testing.T) {
 		t.Errorf("except 1 but got %d", id)
 	}
 
-	time.Sleep(time.Second * 6)
+	loop := eventloop.For(ctx)
+	if n := loop.Pending(); n != 1 {
+		t.Errorf("except 1 pending timer but got %d", n)
+	}
+
+	timeout, cancel := context.WithTimeout(context.Background(), time.Second*6)
+	defer cancel()
+	if err := loop.Run(timeout); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_SetInterval(t *testing.T) {
+	ctx, err := newV8ContextWithTimers()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer eventloop.Close(ctx)
+
+	if _, err := ctx.RunScript(`
+	const calls = [];
+	let ticks = 0;
+	const interval = setInterval(() => {
+		calls.push("interval");
+		Promise.resolve().then(() => calls.push("microtask"));
+		if (++ticks === 3) {
+			clearInterval(interval);
+		}
+	}, 20);
+	const cleared = setTimeout(() => calls.push("cleared"), 30);
+	clearTimeout(cleared);
+	setTimeout((name) => calls.push(name), 100, "timeout");`, "event_loop.js"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	timeout, cancel := context.WithTimeout(context.Background(), time.Second*2)
+	defer cancel()
+	if err := eventloop.For(ctx).Run(timeout); err != nil {
+		t.Error(err)
+		return
+	}
+
+	val, err := ctx.RunScript("calls.join()", "calls.js")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	expected := "interval,microtask,interval,microtask,interval,microtask,timeout"
+	if val.String() != expected {
+		t.Errorf("expected %s but got %s", expected, val.String())
+	}
+
+	if _, err := ctx.RunScript(`setInterval(() => {}, 10)`, "forever.js"); err != nil {
+		t.Error(err)
+		return
+	}
+	short, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	if err := eventloop.For(ctx).Run(short); err != context.DeadlineExceeded {
+		t.Errorf("expected the interval to keep the loop running but got %v", err)
+	}
 }
 
 func newV8ContextWithTimers() (*v8go.Context, error) {
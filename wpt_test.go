@@ -0,0 +1,230 @@
+package polyfills
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/esoptra/v8go"
+	"github.com/esoptra/v8go-polyfills/eventloop"
+)
+
+// The WebCryptoAPI tests in the web-platform-tests format live in testdata/wpt,
+// the upstream files vendored by testdata/wpt/vendor.sh in upstream/ and ours
+// in local/. Run "go test -run TestWPT -wpt.update" to record the current
+// results as the expectations once a change is known to be an improvement.
+var updateWPT = flag.Bool("wpt.update", false, "rewrite testdata/wpt/expectations.json with the current results")
+
+const (
+	wptRoot         = "testdata/wpt"
+	wptExpectations = "testdata/wpt/expectations.json"
+	wptFileTimeout  = 30 * time.Second
+	// wptRunBudget is the time the subtests of a file get before the rest of
+	// them are NOTRUN, the harness finishes before wptFileTimeout
+	wptRunBudget = 25 * time.Second
+)
+
+// wptResult is the outcome of a subtest, as reported by the testharness.js shim
+type wptResult struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// wptExpectation maps the test files, relative to the wpt root, to the status
+// of each of their subtests
+type wptExpectation map[string]map[string]string
+
+func TestWPT(t *testing.T) {
+	files, err := wptTestFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := wptExpectation{}
+	if data, err := ioutil.ReadFile(wptExpectations); err == nil {
+		if err := json.Unmarshal(data, &expected); err != nil {
+			t.Fatalf("%s: %v", wptExpectations, err)
+		}
+	} else if !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+
+	actual := wptExpectation{}
+	for _, file := range files {
+		results, err := runWPTFile(file)
+		if err != nil {
+			results = []wptResult{{Name: file, Status: "ERROR", Message: err.Error()}}
+		}
+
+		statuses := make(map[string]string, len(results))
+		passed := 0
+		for _, r := range results {
+			statuses[r.Name] = r.Status
+			if r.Status == "PASS" {
+				passed++
+			}
+		}
+		actual[file] = statuses
+		t.Logf("%s: %d/%d subtests pass", file, passed, len(results))
+
+		if *updateWPT {
+			continue
+		}
+
+		for _, r := range results {
+			want, ok := expected[file][r.Name]
+			switch {
+			case !ok:
+				t.Errorf("%s: new subtest %q %s, run with -wpt.update to record it", file, r.Name, r.Status)
+			case want != r.Status && r.Status == "PASS":
+				t.Errorf("%s: %q passes now, run with -wpt.update to record the progress", file, r.Name)
+			case want != r.Status:
+				t.Errorf("%s: %q regressed from %s to %s: %s", file, r.Name, want, r.Status, r.Message)
+			}
+		}
+		for name := range expected[file] {
+			if _, ok := statuses[name]; !ok {
+				t.Errorf("%s: subtest %q is gone, run with -wpt.update to drop it", file, name)
+			}
+		}
+	}
+
+	if *updateWPT {
+		data, err := json.MarshalIndent(actual, "", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(wptExpectations, append(data, '\n'), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	for file := range expected {
+		if _, ok := actual[file]; !ok {
+			t.Errorf("%s: test file is gone, run with -wpt.update to drop it", file)
+		}
+	}
+}
+
+// wptTestFiles lists the .any.js test files under the wpt root
+func wptTestFiles() ([]string, error) {
+	var files []string
+	err := filepath.Walk(wptRoot, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && strings.HasSuffix(path, ".any.js") {
+			rel, err := filepath.Rel(wptRoot, path)
+			if err != nil {
+				return err
+			}
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+// runWPTFile runs a test file in a new isolate with the polyfills, after the
+// testharness.js shim and the scripts of its "// META: script=" lines
+func runWPTFile(file string) ([]wptResult, error) {
+	iso := v8go.NewIsolate()
+	defer iso.Dispose()
+
+	global := v8go.NewObjectTemplate(iso)
+	if err := InjectToGlobalObject(iso, global); err != nil {
+		return nil, err
+	}
+	ctx := v8go.NewContext(iso, global)
+	defer eventloop.Close(ctx)
+	if err := InjectToContext(ctx, iso); err != nil {
+		return nil, err
+	}
+
+	scripts, err := wptScripts(file)
+	if err != nil {
+		return nil, err
+	}
+	for _, script := range append([]string{"resources/testharness.js"}, scripts...) {
+		source, err := ioutil.ReadFile(filepath.Join(wptRoot, filepath.FromSlash(script)))
+		if err != nil {
+			return nil, err
+		}
+		if _, err := ctx.RunScript(string(source), script); err != nil {
+			return nil, fmt.Errorf("%s: %w", script, err)
+		}
+	}
+
+	val, err := ctx.RunScript(fmt.Sprintf("__wpt_run(%d)", wptRunBudget.Milliseconds()), "wpt_run.js")
+	if err != nil {
+		return nil, err
+	}
+	promise, err := val.AsPromise()
+	if err != nil {
+		return nil, err
+	}
+
+	loop := eventloop.For(ctx)
+	if err := loop.RunFor(wptFileTimeout); err != nil {
+		return nil, fmt.Errorf("timed out after %v", wptFileTimeout)
+	}
+	if promise.State() == v8go.Pending {
+		return nil, fmt.Errorf("harness never settled")
+	}
+	if promise.State() == v8go.Rejected {
+		return nil, fmt.Errorf("harness error: %s", promise.Result().DetailString())
+	}
+
+	var results []wptResult
+	if err := json.Unmarshal([]byte(promise.Result().String()), &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// wptScripts returns the scripts a test file includes with "// META: script="
+// lines followed by the file itself, relative to the wpt root. Absolute
+// script paths are relative to the suite of the file, upstream or local.
+func wptScripts(file string) ([]string, error) {
+	f, err := os.Open(filepath.Join(wptRoot, filepath.FromSlash(file)))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var scripts []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "// META:") {
+			break
+		}
+		meta := strings.TrimSpace(strings.TrimPrefix(line, "// META:"))
+		if !strings.HasPrefix(meta, "script=") {
+			continue
+		}
+		src := strings.TrimPrefix(meta, "script=")
+		if strings.HasPrefix(src, "/") {
+			suite := strings.SplitN(file, "/", 2)[0]
+			scripts = append(scripts, suite+src)
+		} else {
+			scripts = append(scripts, filepath.ToSlash(filepath.Join(filepath.Dir(file), src)))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return append(scripts, file), nil
+}